@@ -1,17 +1,32 @@
 package moqtransport
 
-import "github.com/mengelbart/moqtransport/internal/wire"
+import (
+	"errors"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+)
 
 type Announcement struct {
-	responseCh chan trackNamespacer
+	response   *pendingResponse[trackNamespacer]
 	namespace  string
 	parameters wire.Parameters // TODO: This is unexported, need better API?
+	session    *Session
 }
 
 func (a *Announcement) Namespace() string {
 	return a.namespace
 }
 
+// Cancel sends an ANNOUNCE_CANCEL message to withdraw an announcement received
+// from the peer. Draft 05 does not transmit code and reason to the peer, they
+// are only logged locally.
+func (a *Announcement) Cancel(code uint64, reason string) error {
+	if a.session == nil {
+		return errors.New("only announcements received from the peer can be canceled")
+	}
+	return a.session.cancelAnnouncement(a, code, reason)
+}
+
 type AnnouncementResponseWriter interface {
 	Accept()
 	Reject(code uint64, reason string)
@@ -21,6 +36,28 @@ type AnnouncementHandler interface {
 	HandleAnnouncement(*Session, *Announcement, AnnouncementResponseWriter)
 }
 
+// An UnannouncementHandler is notified when the peer withdraws an
+// announcement. If the AnnouncementHandler of a Session implements
+// UnannouncementHandler, HandleUnannouncement is called for every UNANNOUNCE
+// message received for a known announcement.
+type UnannouncementHandler interface {
+	HandleUnannouncement(*Session, *Announcement)
+}
+
+// An AnnouncementCancelHandler is notified when the peer cancels an
+// announcement made with Session.Announce. Afterwards, the peer does not send
+// new subscriptions to tracks in the namespace, existing subscriptions are not
+// affected.
+type AnnouncementCancelHandler interface {
+	HandleAnnouncementCancel(s *Session, namespace string)
+}
+
+type AnnouncementCancelHandlerFunc func(*Session, string)
+
+func (f AnnouncementCancelHandlerFunc) HandleAnnouncementCancel(s *Session, namespace string) {
+	f(s, namespace)
+}
+
 type AnnouncementHandlerFunc func(*Session, *Announcement, AnnouncementResponseWriter)
 
 func (f AnnouncementHandlerFunc) HandleAnnouncement(s *Session, a *Announcement, arw AnnouncementResponseWriter) {
@@ -18,6 +18,25 @@ type SendStream interface {
 	io.WriteCloser
 }
 
+// A ResettableSendStream is a SendStream that can be reset, that is, closed
+// abruptly without delivering data that was not yet received by the peer. If
+// the streams opened by OpenUniStream implement ResettableSendStream, streams
+// of groups that are not delivered anymore are reset instead of closed.
+type ResettableSendStream interface {
+	SendStream
+	CancelWrite(code uint64)
+}
+
+// A CancelableReceiveStream is a ReceiveStream that can stop receiving, that
+// is, ask the peer to stop sending data on the stream. If the streams accepted
+// by AcceptUniStream implement CancelableReceiveStream, streams carrying the
+// payload of objects that are dropped before they were read are canceled.
+// Other streams are read until they end and their data is discarded.
+type CancelableReceiveStream interface {
+	ReceiveStream
+	CancelRead(code uint64)
+}
+
 type Connection interface {
 	OpenStream() (Stream, error)
 	OpenStreamSync(context.Context) (Stream, error)
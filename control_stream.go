@@ -10,25 +10,44 @@ import (
 
 type parser interface {
 	Parse() (wire.Message, error)
+	SetVersion(wire.Version)
 }
 
 type controlStream struct {
 	logger    *slog.Logger
 	stream    Stream
+	reader    *streamReader
 	handle    messageHandler
+	onError   func(error)
+	onSent    func(wire.Message)
 	parser    parser
+	version   func() wire.Version
 	sendQueue chan wire.Message
 	closeCh   chan struct{}
 }
 
 type messageHandler func(wire.Message) error
 
-func newControlStream(s Stream, h messageHandler) *controlStream {
+// newControlStream creates a control stream which reads and writes messages
+// using the version returned by version at the time of reading or writing. If
+// parsing or handling a message fails, onError is called with the error and the
+// control stream stops reading. If reading from the stream fails, onError is
+// called with a streamReadError wrapping the error of the stream. onSent is called with every message written to
+// the stream.
+func newControlStream(s Stream, h messageHandler, onError func(error), onSent func(wire.Message), version func() wire.Version) *controlStream {
+	reader := &streamReader{
+		reader: s,
+		err:    nil,
+	}
 	cs := &controlStream{
 		logger:    defaultLogger.WithGroup("MOQ_CONTROL_STREAM"),
 		stream:    s,
+		reader:    reader,
 		handle:    h,
-		parser:    wire.NewControlMessageParser(s),
+		onError:   onError,
+		onSent:    onSent,
+		parser:    wire.NewControlMessageParser(reader),
+		version:   version,
 		sendQueue: make(chan wire.Message, 64),
 		closeCh:   make(chan struct{}),
 	}
@@ -39,17 +58,30 @@ func newControlStream(s Stream, h messageHandler) *controlStream {
 
 func (s *controlStream) readMessages() {
 	for {
+		s.parser.SetVersion(s.version())
 		msg, err := s.parser.Parse()
 		if err != nil {
 			if err == io.EOF {
 				return
 			}
-			s.logger.Error("TODO", "error", err)
+			if s.reader != nil && s.reader.err != nil {
+				s.logger.Info("failed to read from control stream", "error", s.reader.err)
+				s.onError(streamReadError{
+					err: s.reader.err,
+				})
+				return
+			}
+			s.logger.Error("failed to parse control stream message", "error", err)
+			s.onError(ProtocolError{
+				code:    ErrorCodeProtocolViolation,
+				message: "invalid control message",
+			})
 			return
 		}
 		if err = s.handle(msg); err != nil {
 			s.logger.Error("failed to handle control stream message", "error", err)
-			panic("TODO: Close connection")
+			s.onError(err)
+			return
 		}
 	}
 }
@@ -63,13 +95,17 @@ func (s *controlStream) writeMessages() {
 		case msg := <-s.sendQueue:
 			s.logger.Info("sending control message", "type", fmt.Sprintf("%T", msg), "message", msg)
 			buf := make([]byte, 0, 1500)
-			buf = msg.Append(buf)
+			buf = wire.AppendMessage(buf, msg, s.version())
 			if _, err := s.stream.Write(buf); err != nil {
 				if err == io.EOF {
 					s.logger.Info("write stream closed, leaving control stream write loop")
 					return
 				}
 				s.logger.Error("failed to write to control stream", "error", err)
+				continue
+			}
+			if s.onSent != nil {
+				s.onSent(msg)
 			}
 		}
 	}
@@ -86,3 +122,33 @@ func (s *controlStream) enqueue(m wire.Message) {
 func (s *controlStream) close() {
 	close(s.closeCh)
 }
+
+// A streamReadError is passed to onError if reading from the control stream
+// failed, e.g. because the peer closed the connection. It is not caused by an
+// invalid message.
+type streamReadError struct {
+	err error
+}
+
+func (e streamReadError) Error() string {
+	return fmt.Sprintf("failed to read from control stream: %v", e.err)
+}
+
+func (e streamReadError) Unwrap() error {
+	return e.err
+}
+
+// streamReader remembers the last error other than io.EOF returned by reader,
+// so that errors of the stream can be told apart from parse errors.
+type streamReader struct {
+	reader io.Reader
+	err    error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+package moqtransport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestControlStream(t *testing.T) {
+	newTestControlStream := func(p parser, h messageHandler, onError func(error)) *controlStream {
+		return &controlStream{
+			logger:    defaultLogger,
+			stream:    nil,
+			reader:    nil,
+			handle:    h,
+			onError:   onError,
+			onSent:    nil,
+			parser:    p,
+			version:   func() wire.Version { return wire.CurrentVersion },
+			sendQueue: make(chan wire.Message, 1),
+			closeCh:   make(chan struct{}),
+		}
+	}
+	t.Run("parse_error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mp := NewMockParser(ctrl)
+		mp.EXPECT().SetVersion(wire.CurrentVersion)
+		mp.EXPECT().Parse().Return(nil, errors.New("invalid message type"))
+		errCh := make(chan error, 1)
+		cs := newTestControlStream(mp, nil, func(err error) {
+			errCh <- err
+		})
+		go cs.readMessages()
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case err := <-errCh:
+			var pe ProtocolError
+			assert.ErrorAs(t, err, &pe)
+			assert.Equal(t, uint64(ErrorCodeProtocolViolation), pe.Code())
+		}
+	})
+	t.Run("handler_error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mp := NewMockParser(ctrl)
+		mp.EXPECT().SetVersion(wire.CurrentVersion)
+		mp.EXPECT().Parse().Return(&wire.UnsubscribeMessage{SubscribeID: 1}, nil)
+		handlerErr := ProtocolError{
+			code:    ErrorCodeProtocolViolation,
+			message: "unknown subscription",
+		}
+		errCh := make(chan error, 1)
+		cs := newTestControlStream(mp, func(wire.Message) error {
+			return handlerErr
+		}, func(err error) {
+			errCh <- err
+		})
+		go cs.readMessages()
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case err := <-errCh:
+			assert.Equal(t, handlerErr, err)
+		}
+	})
+	t.Run("stream_error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		ms := NewMockStream(ctrl)
+		streamErr := errors.New("connection closed")
+		ms.EXPECT().Read(gomock.Any()).Return(0, streamErr)
+		errCh := make(chan error, 1)
+		cs := newTestControlStream(nil, nil, func(err error) {
+			errCh <- err
+		})
+		cs.reader = &streamReader{
+			reader: ms,
+			err:    nil,
+		}
+		cs.parser = wire.NewControlMessageParser(cs.reader)
+		go cs.readMessages()
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case err := <-errCh:
+			var re streamReadError
+			assert.ErrorAs(t, err, &re)
+			assert.ErrorIs(t, err, streamErr)
+			var pe ProtocolError
+			assert.False(t, errors.As(err, &pe))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package moqtransport
+
+import (
+	"errors"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+)
+
+var (
+	errInvalidWindow   = errors.New("end of delivery window is before its start")
+	errWindowNotNarrow = errors.New("subscribe update must not widen the subscription")
+)
+
+// location identifies an object by its group and object ID.
+type location struct {
+	group  uint64
+	object uint64
+}
+
+func (l location) less(o location) bool {
+	if l.group == o.group {
+		return l.object < o.object
+	}
+	return l.group < o.group
+}
+
+// A deliveryWindow is the range of objects a subscriber requested. start is
+// the first location in the window and end is exclusive. If openEnded is set,
+// end is ignored.
+type deliveryWindow struct {
+	start     location
+	end       location
+	openEnded bool
+}
+
+func openDeliveryWindow() deliveryWindow {
+	return deliveryWindow{
+		start:     location{},
+		end:       location{},
+		openEnded: true,
+	}
+}
+
+// newDeliveryWindow creates a window from the encoding used by
+// SUBSCRIBE_UPDATE: endGroup and endObject are one larger than the last
+// requested group and object. An endGroup of 0 means the window is open-ended
+// and an endObject of 0 means the entire end group is requested.
+func newDeliveryWindow(startGroup, startObject, endGroup, endObject uint64) deliveryWindow {
+	w := deliveryWindow{
+		start: location{
+			group:  startGroup,
+			object: startObject,
+		},
+		end:       location{},
+		openEnded: endGroup == 0,
+	}
+	if w.openEnded {
+		return w
+	}
+	if endObject == 0 {
+		w.end = location{group: endGroup, object: 0}
+	} else {
+		w.end = location{group: endGroup - 1, object: endObject}
+	}
+	return w
+}
+
+// windowFromFilter creates the window requested by a SUBSCRIBE message. Unlike
+// in SUBSCRIBE_UPDATE, endGroup is the last requested group. endObject is one
+// larger than the last requested object and 0 requests the entire end group.
+func windowFromFilter(filter FilterType, startGroup, startObject, endGroup, endObject uint64) deliveryWindow {
+	switch filter {
+	case FilterTypeAbsoluteStart:
+		return newDeliveryWindow(startGroup, startObject, 0, 0)
+	case FilterTypeAbsoluteRange:
+		return newDeliveryWindow(startGroup, startObject, endGroup+1, endObject)
+	}
+	return openDeliveryWindow()
+}
+
+// startAtLatest moves the start of a window created for FilterTypeLatestGroup
+// or FilterTypeLatestObject to the largest location published on the track
+// when the subscription was added. LatestGroup starts at the first object of
+// the largest group and LatestObject at the largest object, i.e., the current
+// object. If the track has no objects yet, the window starts at the
+// beginning.
+func (w deliveryWindow) startAtLatest(filter FilterType, largest location, hasObjects bool) deliveryWindow {
+	if !hasObjects {
+		return w
+	}
+	switch filter {
+	case FilterTypeLatestGroup:
+		w.start = location{group: largest.group, object: 0}
+	case FilterTypeLatestObject:
+		w.start = largest
+	}
+	return w
+}
+
+func windowFromSubscribeUpdate(msg *wire.SubscribeUpdateMessage) deliveryWindow {
+	return newDeliveryWindow(msg.StartGroup, msg.StartObject, msg.EndGroup, msg.EndObject)
+}
+
+func (w deliveryWindow) valid() error {
+	if !w.openEnded && !w.start.less(w.end) {
+		return errInvalidWindow
+	}
+	return nil
+}
+
+func (w deliveryWindow) contains(l location) bool {
+	return !l.less(w.start) && (w.openEnded || l.less(w.end))
+}
+
+// passed returns true if l is beyond the end of the window.
+func (w deliveryWindow) passed(l location) bool {
+	return !w.openEnded && !l.less(w.end)
+}
+
+// last returns true if an object at l with the given status is the last
+// object in the window. If the window ends with an entire group, the last
+// object is the end of that group.
+func (w deliveryWindow) last(l location, status ObjectStatus) bool {
+	if w.openEnded {
+		return false
+	}
+	if w.end.object == 0 {
+		return status == ObjectStatusEndOfGroup && l.group+1 == w.end.group
+	}
+	return l.group == w.end.group && l.object+1 == w.end.object
+}
+
+// narrow returns an error if n contains any object outside of w.
+func (w deliveryWindow) narrow(n deliveryWindow) error {
+	if err := n.valid(); err != nil {
+		return err
+	}
+	if n.start.less(w.start) {
+		return errWindowNotNarrow
+	}
+	if w.openEnded {
+		return nil
+	}
+	if n.openEnded || w.end.less(n.end) {
+		return errWindowNotNarrow
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package moqtransport
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryWindowStartAtLatest(t *testing.T) {
+	cases := []struct {
+		filter     FilterType
+		largest    location
+		hasObjects bool
+		contains   []location
+		excludes   []location
+	}{
+		{
+			filter:     FilterTypeLatestGroup,
+			largest:    location{},
+			hasObjects: false,
+			contains:   []location{{0, 0}, {3, 2}},
+			excludes:   nil,
+		},
+		{
+			filter:     FilterTypeLatestGroup,
+			largest:    location{group: 3, object: 2},
+			hasObjects: true,
+			contains:   []location{{3, 0}, {3, 2}, {4, 0}},
+			excludes:   []location{{2, 5}},
+		},
+		{
+			filter:     FilterTypeLatestObject,
+			largest:    location{},
+			hasObjects: false,
+			contains:   []location{{0, 0}},
+			excludes:   nil,
+		},
+		{
+			filter:     FilterTypeLatestObject,
+			largest:    location{group: 3, object: 2},
+			hasObjects: true,
+			contains:   []location{{3, 2}, {3, 3}, {4, 0}},
+			excludes:   []location{{3, 0}, {3, 1}, {2, 5}},
+		},
+		{
+			filter:     FilterTypeAbsoluteStart,
+			largest:    location{group: 3, object: 2},
+			hasObjects: true,
+			contains:   []location{{1, 0}, {3, 0}},
+			excludes:   []location{{0, 0}},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			w := windowFromFilter(tc.filter, 1, 0, 0, 0).startAtLatest(tc.filter, tc.largest, tc.hasObjects)
+			for _, l := range tc.contains {
+				assert.True(t, w.contains(l), "expected window to contain %v", l)
+			}
+			for _, l := range tc.excludes {
+				assert.False(t, w.contains(l), "expected window to exclude %v", l)
+			}
+		})
+	}
+}
+
+func TestDeliveryWindowLast(t *testing.T) {
+	cases := []struct {
+		window deliveryWindow
+		loc    location
+		status ObjectStatus
+		expect bool
+	}{
+		{
+			window: openDeliveryWindow(),
+			loc:    location{group: 5, object: 0},
+			status: ObjectStatusEndOfGroup,
+			expect: false,
+		},
+		{
+			window: windowFromFilter(FilterTypeAbsoluteRange, 0, 0, 2, 3),
+			loc:    location{group: 2, object: 2},
+			status: ObjectStatusNormal,
+			expect: true,
+		},
+		{
+			window: windowFromFilter(FilterTypeAbsoluteRange, 0, 0, 2, 3),
+			loc:    location{group: 2, object: 1},
+			status: ObjectStatusNormal,
+			expect: false,
+		},
+		{
+			// The window ends with the entire group 2.
+			window: windowFromFilter(FilterTypeAbsoluteRange, 0, 0, 2, 0),
+			loc:    location{group: 2, object: 7},
+			status: ObjectStatusNormal,
+			expect: false,
+		},
+		{
+			window: windowFromFilter(FilterTypeAbsoluteRange, 0, 0, 2, 0),
+			loc:    location{group: 2, object: 8},
+			status: ObjectStatusEndOfGroup,
+			expect: true,
+		},
+		{
+			window: windowFromFilter(FilterTypeAbsoluteRange, 0, 0, 2, 0),
+			loc:    location{group: 1, object: 4},
+			status: ObjectStatusEndOfGroup,
+			expect: false,
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.window.last(tc.loc, tc.status))
+		})
+	}
+}
@@ -38,6 +38,21 @@ func (e ProtocolError) Code() uint64 {
 	return e.code
 }
 
+// A SessionClosedError is returned by calls that were pending when the
+// session ended or that were made after it ended. It wraps the reason the
+// session ended, which is also returned by Session.Err.
+type SessionClosedError struct {
+	cause error
+}
+
+func (e SessionClosedError) Error() string {
+	return fmt.Sprintf("session closed: %v", e.cause)
+}
+
+func (e SessionClosedError) Unwrap() error {
+	return e.cause
+}
+
 type ApplicationError struct {
 	code   uint64
 	mesage string
@@ -46,3 +61,10 @@ type ApplicationError struct {
 func (e ApplicationError) Error() string {
 	return fmt.Sprintf("MoQ Application Error %v: %v", e.code, e.mesage)
 }
+
+// retryTrackAliasError is returned internally if the publisher rejected a
+// subscription with SubscribeErrorRetryTrackAlias.
+type retryTrackAliasError struct {
+	ApplicationError
+	trackAlias uint64
+}
@@ -121,7 +121,7 @@ func (c *Client) handleCatalogDeltas(roomID, username string, previous *chatalog
 			if p == username {
 				continue
 			}
-			t, err := c.session.Subscribe(context.Background(), 2, 0, fmt.Sprintf("moq-chat/%v/participant/%v", roomID, p), "", username)
+			t, err := c.session.Subscribe(context.Background(), fmt.Sprintf("moq-chat/%v/participant/%v", roomID, p), "", username, nil)
 			if err != nil {
 				return err
 			}
@@ -150,7 +150,7 @@ func (c *Client) joinRoom(roomID, username string) error {
 		lt:  lt,
 		rts: []*moqtransport.RemoteTrack{},
 	}
-	catalogTrack, err := c.session.Subscribe(context.Background(), 1, 0, fmt.Sprintf("moq-chat/%v", roomID), "/catalog", username)
+	catalogTrack, err := c.session.Subscribe(context.Background(), fmt.Sprintf("moq-chat/%v", roomID), "/catalog", username, nil)
 	if err != nil {
 		return err
 	}
@@ -175,7 +175,7 @@ func (c *Client) joinRoom(roomID, username string) error {
 		if p == username {
 			continue
 		}
-		t, err := c.session.Subscribe(context.Background(), 2, 0, fmt.Sprintf("moq-chat/%v/participant/%v", roomID, p), "", username)
+		t, err := c.session.Subscribe(context.Background(), fmt.Sprintf("moq-chat/%v/participant/%v", roomID, p), "", username, nil)
 		if err != nil {
 			log.Fatalf("failed to subscribe to participant track: %v", err)
 		}
@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/moqrelay"
 )
 
 type roomID string
@@ -71,11 +72,13 @@ func (r *room) announceUser(username string, s *moqtransport.Session, arw moqtra
 	u, ok := r.findParticipant(username)
 	if !ok {
 		arw.Reject(uint64(errorCodeUnknownParticipant), fmt.Sprintf("username '%v' not found, participant must join before announcing", username))
+		return
 	}
 	arw.Accept()
-	sub, err := s.Subscribe(context.Background(), 0, 0, fmt.Sprintf("moq-chat/%v/participant/%v", r.ID, username), "", "")
+	sub, err := s.Subscribe(context.Background(), fmt.Sprintf("moq-chat/%v/participant/%v", r.ID, username), "", "", nil)
 	if err != nil {
-		panic(err)
+		log.Printf("failed to subscribe to participant track of %v: %v", username, err)
+		return
 	}
 	catalog := r.users.serialize()
 	fmt.Printf("sending catalog: %v\n", catalog)
@@ -88,16 +91,8 @@ func (r *room) announceUser(username string, s *moqtransport.Session, arw moqtra
 	})
 	r.catalogGroup += 1
 	go func(remote *moqtransport.RemoteTrack, local *moqtransport.LocalTrack) {
-		for {
-			obj, err := remote.ReadObject(context.Background())
-			if err != nil {
-				panic(err)
-			}
-			fmt.Printf("relay read object: %v\n", obj)
-			err = local.WriteObject(context.Background(), obj)
-			if err != nil {
-				panic(err)
-			}
+		if err := moqrelay.Forward(context.Background(), remote, local); err != nil {
+			log.Printf("stopped relaying participant track of %v: %v", username, err)
 		}
 	}(sub, u.track)
 }
@@ -6,19 +6,17 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/moqserver"
 	"github.com/mengelbart/moqtransport/quicmoq"
 	"github.com/mengelbart/moqtransport/webtransportmoq"
 	"github.com/quic-go/quic-go"
-	"github.com/quic-go/quic-go/http3"
 	"github.com/quic-go/webtransport-go"
 )
 
 type moqHandler struct {
-	server     bool
 	addr       string
 	tlsConfig  *tls.Config
 	namespace  string
@@ -47,47 +45,23 @@ func (h *moqHandler) runClient(ctx context.Context, wt bool) error {
 }
 
 func (h *moqHandler) runServer(ctx context.Context) error {
-	listener, err := quic.ListenAddr(h.addr, h.tlsConfig, &quic.Config{
-		EnableDatagrams: true,
-	})
-	if err != nil {
-		return err
-	}
-	wt := webtransport.Server{
-		H3: http3.Server{
-			Addr:      h.addr,
-			TLSConfig: h.tlsConfig,
-		},
-	}
 	if h.publish {
 		h.setupDateTrack(ctx)
 	}
-	http.HandleFunc("/moq", func(w http.ResponseWriter, r *http.Request) {
-		session, err := wt.Upgrade(w, r)
-		if err != nil {
-			log.Printf("upgrading to webtransport failed: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		h.handle(r.Context(), webtransportmoq.New(session))
-	})
-	for {
-		conn, err := listener.Accept(ctx)
-		if err != nil {
-			return err
-		}
-		if conn.ConnectionState().TLS.NegotiatedProtocol == "h3" {
-			go wt.ServeQUICConn(conn)
-		}
-		if conn.ConnectionState().TLS.NegotiatedProtocol == "moq-00" {
-			go h.handle(ctx, quicmoq.New(conn))
-		}
+	server := &moqserver.Server{
+		Path:    "/moq",
+		Session: h.session(),
+		OnSession: func(s *moqtransport.Session) {
+			h.subscribeIfEnabled(ctx, s)
+		},
 	}
+	return server.ListenAndServe(h.addr, h.tlsConfig)
 }
 
-func (h *moqHandler) handle(ctx context.Context, conn moqtransport.Connection) {
-	ms := &moqtransport.Session{
-		Conn:            conn,
+// session returns the session configuration used by clients and as the
+// template of server sessions.
+func (h *moqHandler) session() *moqtransport.Session {
+	return &moqtransport.Session{
 		EnableDatagrams: true,
 		LocalRole:       0,
 		RemoteRole:      0,
@@ -109,30 +83,31 @@ func (h *moqHandler) handle(ctx context.Context, conn moqtransport.Connection) {
 		}),
 		Path: "",
 	}
-	if h.server {
-		if err := ms.RunServer(ctx); err != nil {
-			log.Printf("MoQ Session initialization failed: %v", err)
-			ms.CloseWithError(0, "session initialization error")
-			return
-		}
-	} else {
-		if err := ms.RunClient(); err != nil {
-			log.Printf("MoQ Session initialization failed: %v", err)
-			ms.CloseWithError(0, "session initialization error")
-			return
-		}
+}
+
+func (h *moqHandler) handle(ctx context.Context, conn moqtransport.Connection) {
+	ms := h.session()
+	ms.Conn = conn
+	if err := ms.RunClient(); err != nil {
+		log.Printf("MoQ Session initialization failed: %v", err)
+		ms.CloseWithError(0, "session initialization error")
+		return
 	}
+	h.subscribeIfEnabled(ctx, ms)
+}
+
+func (h *moqHandler) subscribeIfEnabled(ctx context.Context, s *moqtransport.Session) {
 	if h.subscribe {
-		if err := h.subscribeAndRead(ctx, ms, h.namespace, h.trackname); err != nil {
+		if err := h.subscribeAndRead(ctx, s, h.namespace, h.trackname); err != nil {
 			log.Printf("failed to subscribe to track :%v", err)
-			ms.CloseWithError(0, "internal error")
+			s.CloseWithError(0, "internal error")
 			return
 		}
 	}
 }
 
 func (h *moqHandler) subscribeAndRead(ctx context.Context, s *moqtransport.Session, namespace, trackname string) error {
-	rs, err := s.Subscribe(context.Background(), 0, 0, namespace, trackname, "")
+	rs, err := s.Subscribe(context.Background(), namespace, trackname, "", nil)
 	if err != nil {
 		return err
 	}
@@ -30,7 +30,6 @@ func main() {
 		tlsConfig = generateTLSConfig()
 	}
 	h := &moqHandler{
-		server:     *server,
 		addr:       *addr,
 		tlsConfig:  tlsConfig,
 		namespace:  *namespace,
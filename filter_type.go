@@ -0,0 +1,12 @@
+package moqtransport
+
+import "github.com/mengelbart/moqtransport/internal/wire"
+
+type FilterType = wire.FilterType
+
+const (
+	FilterTypeLatestGroup   FilterType = wire.FilterTypeLatestGroup
+	FilterTypeLatestObject  FilterType = wire.FilterTypeLatestObject
+	FilterTypeAbsoluteStart FilterType = wire.FilterTypeAbsoluteStart
+	FilterTypeAbsoluteRange FilterType = wire.FilterTypeAbsoluteRange
+)
@@ -0,0 +1,14 @@
+package moqtransport
+
+// A GoAwayHandler is notified when the server asks the client to migrate to a
+// new session. newSessionURI may be empty, in which case the client should
+// reconnect to the current URI.
+type GoAwayHandler interface {
+	HandleGoAway(s *Session, newSessionURI string)
+}
+
+type GoAwayHandlerFunc func(*Session, string)
+
+func (f GoAwayHandlerFunc) HandleGoAway(s *Session, newSessionURI string) {
+	f(s, newSessionURI)
+}
@@ -2,11 +2,15 @@ package moqtransport
 
 import "github.com/mengelbart/moqtransport/internal/wire"
 
+// resetCodeStaleGroup is the error code used to reset streams of groups that
+// are not delivered anymore.
+const resetCodeStaleGroup = 0x00
+
 type groupHeaderStream struct {
 	stream SendStream
 }
 
-func newGroupHeaderStream(stream SendStream, subscribeID, trackAlias, groupID uint64, publisherPriority uint8) (*groupHeaderStream, error) {
+func newGroupHeaderStream(stream SendStream, version wire.Version, subscribeID, trackAlias, groupID uint64, publisherPriority uint8) (*groupHeaderStream, error) {
 	shgm := &wire.StreamHeaderGroupMessage{
 		SubscribeID:       subscribeID,
 		TrackAlias:        trackAlias,
@@ -14,7 +18,7 @@ func newGroupHeaderStream(stream SendStream, subscribeID, trackAlias, groupID ui
 		PublisherPriority: publisherPriority,
 	}
 	buf := make([]byte, 0, 40)
-	buf = shgm.Append(buf)
+	buf = shgm.AppendVersion(buf, version)
 	_, err := stream.Write(buf)
 	if err != nil {
 		return nil, err
@@ -34,6 +38,27 @@ func (s *groupHeaderStream) writeObject(objectID uint64, payload []byte) (int, e
 	return s.stream.Write(buf)
 }
 
+// writeStatus writes an object without payload carrying status.
+func (s *groupHeaderStream) writeStatus(objectID uint64, status wire.ObjectStatus) (int, error) {
+	shgo := wire.StreamHeaderGroupObject{
+		ObjectID:      objectID,
+		ObjectStatus:  status,
+		ObjectPayload: nil,
+	}
+	buf := make([]byte, 0, 16)
+	buf = shgo.Append(buf)
+	return s.stream.Write(buf)
+}
+
+// reset resets the stream if it supports it and closes it otherwise.
+func (s *groupHeaderStream) reset() error {
+	if rs, ok := s.stream.(ResettableSendStream); ok {
+		rs.CancelWrite(resetCodeStaleGroup)
+		return nil
+	}
+	return s.stream.Close()
+}
+
 func (s *groupHeaderStream) Close() error {
 	return s.stream.Close()
 }
@@ -0,0 +1,290 @@
+package integrationtests_test
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/internal/netsim"
+	"github.com/mengelbart/moqtransport/memconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// impairedSessions connects a client to a server publishing track over an in
+// memory connection. The traffic sent by the server is impaired according to
+// config.
+func impairedSessions(t *testing.T, ctx context.Context, config netsim.Config, track *moqtransport.LocalTrack, opts ...moqtransport.AcceptOption) (*moqtransport.Session, *moqtransport.Session, *netsim.Conn) {
+	clientConn, serverConn := memconn.Pipe(nil)
+	sim := netsim.Wrap(serverConn, config)
+	server := &moqtransport.Session{
+		Conn:            sim,
+		EnableDatagrams: true,
+		SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+			srw.Accept(track, opts...)
+		}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, server.RunServer(ctx))
+	}()
+	client := &moqtransport.Session{
+		Conn:            clientConn,
+		EnableDatagrams: true,
+	}
+	assert.NoError(t, client.RunClient())
+	wg.Wait()
+	return client, server, sim
+}
+
+// readObjects reads objects from sub until no object arrives within timeout
+// or the subscription ends.
+func readObjects(t *testing.T, sub *moqtransport.RemoteTrack, timeout time.Duration) ([]moqtransport.Object, error) {
+	objects := []moqtransport.Object{}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		o, err := sub.ReadObject(ctx)
+		cancel()
+		if err != nil {
+			return objects, err
+		}
+		objects = append(objects, o)
+	}
+}
+
+func TestImpairment(t *testing.T) {
+	t.Run("datagram_loss", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, sim := impairedSessions(t, ctx, netsim.Config{
+			DatagramLossRate: 0.3,
+			Seed:             1,
+		}, track)
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for i := uint64(0); i < 50; i++ {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              i,
+				ObjectID:             0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceDatagram,
+				Payload:              []byte("datagram"),
+			}))
+		}
+		objects, err := readObjects(t, sub, 100*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		lost := sim.Stats().LostDatagrams
+		assert.Greater(t, lost, uint64(0))
+		assert.Equal(t, 50-int(lost), len(objects))
+		// Lost datagrams do not end the subscription.
+		assert.Len(t, server.SendSubscriptionStats(), 1)
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("datagram_reordering", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, sim := impairedSessions(t, ctx, netsim.Config{
+			DatagramReorderRate: 0.3,
+			Seed:                1,
+		}, track)
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for i := uint64(0); i < 50; i++ {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              i,
+				ObjectID:             0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceDatagram,
+				Payload:              []byte("datagram"),
+			}))
+		}
+		objects, err := readObjects(t, sub, 100*time.Millisecond)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Greater(t, sim.Stats().ReorderedDatagrams, uint64(0))
+		assert.Len(t, objects, 50)
+		assert.False(t, sort.SliceIsSorted(objects, func(i, j int) bool {
+			return objects[i].GroupID < objects[j].GroupID
+		}))
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("stream_reset_ends_subscription", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, sim := impairedSessions(t, ctx, netsim.Config{
+			StreamResetRate: 1,
+		}, track)
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+			GroupID:              0,
+			ObjectID:             0,
+			ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+			Payload:              []byte("reset"),
+		}))
+		// The publisher ends the failed subscription with SUBSCRIBE_DONE,
+		// which ends the subscription of the client.
+		_, err = sub.ReadObject(ctx)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, uint64(1), sim.Stats().ResetStreams)
+		assert.Empty(t, server.SendSubscriptionStats())
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("delayed_stream_open", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, _ := impairedSessions(t, ctx, netsim.Config{
+			StreamOpenDelay: 20 * time.Millisecond,
+		}, track)
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for g := uint64(0); g < 3; g++ {
+			for o := uint64(0); o < 3; o++ {
+				assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+					GroupID:              g,
+					ObjectID:             o,
+					ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+					Payload:              []byte("delayed"),
+				}))
+			}
+		}
+		assert.NoError(t, track.EndTrack(ctx))
+		objects, err := readObjects(t, sub, time.Second)
+		assert.ErrorIs(t, err, io.EOF)
+		// All objects and the end of track arrive in order within each
+		// group, despite the delay.
+		assert.Len(t, objects, 10)
+		next := map[uint64]uint64{}
+		for _, o := range objects {
+			assert.Equal(t, next[o.GroupID], o.ObjectID)
+			next[o.GroupID]++
+		}
+		assert.Equal(t, moqtransport.ObjectStatusEndOfTrack, objects[len(objects)-1].Status)
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("bandwidth_cap_skips_stale_groups", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, sim := impairedSessions(t, ctx, netsim.Config{
+			Bandwidth: 100_000,
+		}, track, moqtransport.WithSendQueueSize(8), moqtransport.WithSendQueuePolicy(moqtransport.SendQueuePolicyDropStaleGroups))
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		payload := make([]byte, 1000)
+		for g := uint64(0); g < 10; g++ {
+			for o := uint64(0); o < 4; o++ {
+				assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+					GroupID:              g,
+					ObjectID:             o,
+					ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+					Payload:              payload,
+				}))
+			}
+		}
+		objects := []moqtransport.Object{}
+		for len(objects) == 0 || objects[len(objects)-1].GroupID != 9 || objects[len(objects)-1].ObjectID != 3 {
+			o, err := sub.ReadObject(ctx)
+			if !assert.NoError(t, err) {
+				break
+			}
+			objects = append(objects, o)
+		}
+		stats := server.SendSubscriptionStats()
+		assert.Len(t, stats, 1)
+		assert.Greater(t, stats[0].DroppedObjects, uint64(0))
+		assert.Equal(t, 40, len(objects)+int(stats[0].DroppedObjects))
+		assert.Greater(t, sim.Stats().ShapedBytes, uint64(0))
+		groups := map[uint64]bool{}
+		for _, o := range objects {
+			groups[o.GroupID] = true
+		}
+		// The groups written while the link was busy were skipped, but the
+		// latest group was delivered completely.
+		assert.Less(t, len(groups), 10)
+		assert.True(t, groups[9])
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("bandwidth_cap_prioritizes_subscriptions", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server, _ := impairedSessions(t, ctx, netsim.Config{
+			Bandwidth: 100_000,
+		}, track)
+		low, err := client.Subscribe(ctx, "namespace", "track", "", &moqtransport.SubscribeOptions{
+			SubscriberPriority: 2,
+		})
+		assert.NoError(t, err)
+		high, err := client.Subscribe(ctx, "namespace", "track", "", &moqtransport.SubscribeOptions{
+			SubscriberPriority: 1,
+		})
+		assert.NoError(t, err)
+		payload := make([]byte, 1000)
+		for g := uint64(0); g < 10; g++ {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              g,
+				ObjectID:             0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+				Payload:              payload,
+			}))
+		}
+		var lock sync.Mutex
+		received := []uint8{}
+		var wg sync.WaitGroup
+		for priority, sub := range map[uint8]*moqtransport.RemoteTrack{1: high, 2: low} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 10; i++ {
+					_, err := sub.ReadObject(ctx)
+					if !assert.NoError(t, err) {
+						return
+					}
+					lock.Lock()
+					received = append(received, priority)
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		// The link is shared by both subscriptions, but the subscription
+		// with the lower priority value is delivered first. Only objects
+		// that were already being written when the objects of the other
+		// subscription were scheduled are sent before.
+		assert.Len(t, received, 20)
+		last := 0
+		for i, priority := range received {
+			if priority == 1 {
+				last = i
+			}
+		}
+		assert.LessOrEqual(t, last, 11)
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+}
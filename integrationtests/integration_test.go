@@ -1,6 +1,7 @@
 package integrationtests_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
@@ -8,6 +9,7 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"sync"
@@ -83,6 +85,40 @@ func TestIntegration(t *testing.T) {
 		assert.NoError(t, client.Close())
 	})
 
+	t.Run("peer_close", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		var wg sync.WaitGroup
+		listener, addr, teardown := setup()
+		defer teardown()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			server := quicServerSession(t, ctx, listener, nil)
+			assert.NoError(t, server.CloseWithError(moqtransport.ErrorCodeInternal, "shutting down"))
+			<-server.Done()
+			assert.Error(t, server.Err())
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		client := quicClientSession(t, ctx, addr, nil)
+		select {
+		case <-ctx.Done():
+			assert.Fail(t, "client session not done")
+		case <-client.Done():
+		}
+		var appErr *quic.ApplicationError
+		if assert.ErrorAs(t, client.Err(), &appErr) {
+			assert.True(t, appErr.Remote)
+			assert.Equal(t, quic.ApplicationErrorCode(moqtransport.ErrorCodeInternal), appErr.ErrorCode)
+		}
+		_, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		var sce moqtransport.SessionClosedError
+		assert.ErrorAs(t, err, &sce)
+		wg.Wait()
+	})
+
 	t.Run("announce", func(t *testing.T) {
 		defer goleak.VerifyNone(t)
 		var wg sync.WaitGroup
@@ -168,7 +204,7 @@ func TestIntegration(t *testing.T) {
 			close(announcementCh)
 		}))
 		<-announcementCh
-		r, err := client.Subscribe(ctx, 0, 0, "namespace", "track", "auth")
+		r, err := client.Subscribe(ctx, "namespace", "track", "auth", nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, r)
 		close(receivedSubscribeOK)
@@ -176,6 +212,60 @@ func TestIntegration(t *testing.T) {
 		wg.Wait()
 	})
 
+	t.Run("subscribe_timeout", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		var wg sync.WaitGroup
+		listener, addr, teardown := setup()
+		defer teardown()
+		wg.Add(1)
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		acceptedCh := make(chan struct{}, 2)
+		unsubscribedCh := make(chan struct{})
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			conn, err := listener.Accept(ctx)
+			assert.NoError(t, err)
+			server := &moqtransport.Session{
+				Conn:            quicmoq.New(conn),
+				EnableDatagrams: true,
+				SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						srw.Accept(track)
+						acceptedCh <- struct{}{}
+					}()
+				}),
+			}
+			assert.NoError(t, server.RunServer(ctx))
+			<-unsubscribedCh
+			assert.NoError(t, server.Err())
+			assert.NoError(t, server.Close())
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		client := quicClientSession(t, ctx, addr, nil)
+		subscribeCtx, subscribeCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer subscribeCancel()
+		_, err := client.Subscribe(subscribeCtx, "namespace", "track", "", nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		// The late SUBSCRIBE_OK neither ends the session nor leaves the
+		// subscription behind.
+		<-acceptedCh
+		assert.Eventually(t, func() bool {
+			return track.SubscriberCount() == 0
+		}, time.Second, 10*time.Millisecond)
+		assert.NoError(t, client.Err())
+		r, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, r)
+		close(unsubscribedCh)
+		wg.Wait()
+		assert.NoError(t, client.Close())
+	})
+
 	t.Run("send_receive_objects", func(t *testing.T) {
 		defer goleak.VerifyNone(t)
 		var wg sync.WaitGroup
@@ -217,12 +307,184 @@ func TestIntegration(t *testing.T) {
 			close(announcementCh)
 		}))
 		<-announcementCh
-		sub, err := client.Subscribe(ctx, 0, 0, "namespace", "track", "auth")
+		sub, err := client.Subscribe(ctx, "namespace", "track", "auth", nil)
+		assert.NoError(t, err)
+		close(subscribedCh)
+		o, err := sub.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(o.Payload))
+		close(receivedObject)
+		assert.NoError(t, client.Close())
+		wg.Wait()
+	})
+
+	t.Run("stream_object_payload", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		var wg sync.WaitGroup
+		listener, addr, teardown := setup()
+		defer teardown()
+		payload := make([]byte, 4*1024*1024)
+		_, err := rand.Read(payload)
+		assert.NoError(t, err)
+		wg.Add(1)
+		subscribedCh := make(chan struct{})
+		receivedObject := make(chan struct{})
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			server := quicServerSession(t, ctx, listener, nil)
+			track := moqtransport.NewLocalTrack("namespace", "track")
+			defer track.Close()
+			err := server.AddLocalTrack(track)
+			assert.NoError(t, err)
+			err = server.Announce(ctx, "namespace")
+			assert.NoError(t, err)
+			<-subscribedCh
+			w, err := track.OpenObjectWriter(ctx, 1, 2, 3)
+			assert.NoError(t, err)
+			for chunk := 0; chunk < len(payload); chunk += 64 * 1024 {
+				_, err = w.Write(payload[chunk : chunk+64*1024])
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, w.Close())
+			<-receivedObject
+			assert.NoError(t, track.Close())
+			assert.NoError(t, server.Close())
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		announcementCh := make(chan struct{})
+		client := quicClientSession(t, ctx, addr, moqtransport.AnnouncementHandlerFunc(func(_ *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+			arw.Accept()
+			close(announcementCh)
+		}))
+		<-announcementCh
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		close(subscribedCh)
+		o, r, err := sub.AcceptObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), o.GroupID)
+		assert.Equal(t, uint64(2), o.ObjectID)
+		assert.Equal(t, uint8(3), o.PublisherPriority)
+		assert.Equal(t, moqtransport.ObjectForwardingPreferenceStream, o.ForwardingPreference)
+		received, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.True(t, bytes.Equal(payload, received))
+		close(receivedObject)
+		assert.NoError(t, client.Close())
+		wg.Wait()
+	})
+
+	t.Run("negotiate_older_version", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		var wg sync.WaitGroup
+		listener, addr, teardown := setup()
+		defer teardown()
+		wg.Add(1)
+		subscribedCh := make(chan struct{})
+		receivedObject := make(chan struct{})
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			server := quicServerSession(t, ctx, listener, nil)
+			assert.Equal(t, moqtransport.VersionDraft04, server.Version())
+			track := moqtransport.NewLocalTrack("namespace", "track")
+			defer track.Close()
+			err := server.AddLocalTrack(track)
+			assert.NoError(t, err)
+			err = server.Announce(ctx, "namespace")
+			assert.NoError(t, err)
+			<-subscribedCh
+			err = track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              0,
+				ObjectID:             0,
+				PublisherPriority:    7,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+				Payload:              []byte("hello world"),
+			})
+			assert.NoError(t, err)
+			<-receivedObject
+			assert.NoError(t, track.Close())
+			assert.NoError(t, server.Close())
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		conn, err := quic.DialAddr(ctx, addr, generateTLSConfig(), &quic.Config{EnableDatagrams: true})
+		assert.NoError(t, err)
+		announcementCh := make(chan struct{})
+		client := &moqtransport.Session{
+			Conn:            quicmoq.New(conn),
+			EnableDatagrams: true,
+			LocalRole:       wire.RolePubSub,
+			AnnouncementHandler: moqtransport.AnnouncementHandlerFunc(func(_ *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+				arw.Accept()
+				close(announcementCh)
+			}),
+			SupportedVersions: []moqtransport.Version{moqtransport.VersionDraft04},
+		}
+		assert.NoError(t, client.RunClient())
+		<-announcementCh
+		assert.Equal(t, moqtransport.VersionDraft04, client.Version())
+		sub, err := client.Subscribe(ctx, "namespace", "track", "auth", nil)
 		assert.NoError(t, err)
 		close(subscribedCh)
 		o, err := sub.ReadObject(ctx)
 		assert.NoError(t, err)
 		assert.Equal(t, "hello world", string(o.Payload))
+		// Draft 04 does not carry publisher priorities.
+		assert.Equal(t, uint8(0), o.PublisherPriority)
+		close(receivedObject)
+		assert.NoError(t, client.Close())
+		wg.Wait()
+	})
+
+	t.Run("late_join_cached_objects", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		var wg sync.WaitGroup
+		listener, addr, teardown := setup()
+		defer teardown()
+		wg.Add(1)
+		receivedObject := make(chan struct{})
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			server := quicServerSession(t, ctx, listener, nil)
+			track := moqtransport.NewLocalTrack("namespace", "track", moqtransport.WithCache(moqtransport.CacheConfig{MaxGroups: 1}))
+			defer track.Close()
+			err := server.AddLocalTrack(track)
+			assert.NoError(t, err)
+			err = track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              0,
+				ObjectID:             0,
+				PublisherPriority:    0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+				Payload:              []byte("hello world"),
+			})
+			assert.NoError(t, err)
+			err = server.Announce(ctx, "namespace")
+			assert.NoError(t, err)
+			<-receivedObject
+			assert.NoError(t, track.Close())
+			assert.NoError(t, server.Close())
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		announcementCh := make(chan struct{})
+		client := quicClientSession(t, ctx, addr, moqtransport.AnnouncementHandlerFunc(func(_ *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+			assert.Equal(t, "namespace", a.Namespace())
+			arw.Accept()
+			close(announcementCh)
+		}))
+		<-announcementCh
+		sub, err := client.Subscribe(ctx, "namespace", "track", "auth", nil)
+		assert.NoError(t, err)
+		o, err := sub.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(o.Payload))
 		close(receivedObject)
 		assert.NoError(t, client.Close())
 		wg.Wait()
@@ -296,7 +558,7 @@ func TestIntegration(t *testing.T) {
 			close(announcementCh)
 		}))
 		<-announcementCh
-		sub, err := client.Subscribe(ctx, 0, 0, "namespace", "track", "auth")
+		sub, err := client.Subscribe(ctx, "namespace", "track", "auth", nil)
 		assert.NoError(t, err)
 		close(subscribedCh)
 		<-receivedSubscribeCh
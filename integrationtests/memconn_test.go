@@ -0,0 +1,69 @@
+package integrationtests_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/memconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMemconn(t *testing.T) {
+	t.Run("send_receive_objects", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		clientConn, serverConn := memconn.Pipe(&memconn.Options{
+			Latency: 5 * time.Millisecond,
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		server := &moqtransport.Session{
+			Conn:            serverConn,
+			EnableDatagrams: true,
+			SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+				srw.Accept(track)
+			}),
+		}
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, server.RunServer(ctx))
+		}()
+		client := &moqtransport.Session{
+			Conn:            clientConn,
+			EnableDatagrams: true,
+		}
+		assert.NoError(t, client.RunClient())
+		wg.Wait()
+
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for i, fp := range []moqtransport.ObjectForwardingPreference{
+			moqtransport.ObjectForwardingPreferenceDatagram,
+			moqtransport.ObjectForwardingPreferenceStream,
+			moqtransport.ObjectForwardingPreferenceStreamGroup,
+			moqtransport.ObjectForwardingPreferenceStreamTrack,
+		} {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              uint64(i),
+				ObjectID:             0,
+				ForwardingPreference: fp,
+				Payload:              []byte("hello"),
+			}))
+			o, err := sub.ReadObject(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(i), o.GroupID)
+			assert.Equal(t, "hello", string(o.Payload))
+		}
+		assert.NoError(t, client.Close())
+		<-server.Done()
+		assert.Error(t, server.Err())
+	})
+}
@@ -0,0 +1,98 @@
+package integrationtests_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/moqrelay"
+	"github.com/mengelbart/moqtransport/quicmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestRelay(t *testing.T) {
+	defer goleak.VerifyNone(t)
+	listener, err := quic.ListenAddr("localhost:0", generateTLSConfig(), &quic.Config{EnableDatagrams: true})
+	assert.NoError(t, err)
+	defer listener.Close()
+	addr := fmt.Sprintf("localhost:%v", listener.Addr().(*net.UDPAddr).Port)
+
+	relay := moqrelay.New()
+	var relaySessionsLock sync.Mutex
+	relaySessions := []*moqtransport.Session{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 3; i++ {
+			conn, err := listener.Accept(context.Background())
+			assert.NoError(t, err)
+			s := &moqtransport.Session{
+				Conn:                quicmoq.New(conn),
+				EnableDatagrams:     true,
+				AnnouncementHandler: relay,
+				SubscriptionHandler: relay,
+			}
+			assert.NoError(t, s.RunServer(context.Background()))
+			relaySessionsLock.Lock()
+			relaySessions = append(relaySessions, s)
+			relaySessionsLock.Unlock()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	publisher := quicClientSession(t, ctx, addr, nil)
+	track := moqtransport.NewLocalTrack("namespace", "track")
+	defer track.Close()
+	assert.NoError(t, publisher.AddLocalTrack(track))
+	assert.NoError(t, publisher.Announce(ctx, "namespace"))
+
+	subscribers := []*moqtransport.Session{}
+	remoteTracks := []*moqtransport.RemoteTrack{}
+	for i := 0; i < 2; i++ {
+		s := quicClientSession(t, ctx, addr, nil)
+		subscribers = append(subscribers, s)
+		rt, err := s.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		remoteTracks = append(remoteTracks, rt)
+	}
+	assert.Equal(t, 1, track.SubscriberCount())
+
+	err = track.WriteObject(ctx, moqtransport.Object{
+		GroupID:              0,
+		ObjectID:             0,
+		PublisherPriority:    0,
+		ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+		Payload:              []byte("hello world"),
+	})
+	assert.NoError(t, err)
+	for _, rt := range remoteTracks {
+		o, err := rt.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world", string(o.Payload))
+	}
+
+	for _, rt := range remoteTracks {
+		rt.Unsubscribe()
+	}
+	assert.Eventually(t, func() bool {
+		return track.SubscriberCount() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	for _, s := range subscribers {
+		assert.NoError(t, s.Close())
+	}
+	assert.NoError(t, publisher.Close())
+	wg.Wait()
+	for _, s := range relaySessions {
+		assert.NoError(t, s.Close())
+	}
+}
@@ -0,0 +1,183 @@
+package integrationtests_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/moqserver"
+	"github.com/mengelbart/moqtransport/quicmoq"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/webtransport-go"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// startServer serves server on a random local port and returns its address
+// and a channel receiving the error returned by Serve.
+func startServer(t *testing.T, server *moqserver.Server) (string, <-chan error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	assert.NoError(t, err)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Serve(conn, generateTLSConfig())
+	}()
+	return conn.LocalAddr().String(), errCh
+}
+
+func dialQUICSession(t *testing.T, ctx context.Context, addr string, session *moqtransport.Session) {
+	conn, err := quic.DialAddr(ctx, addr, generateTLSConfig(), &quic.Config{EnableDatagrams: true})
+	assert.NoError(t, err)
+	session.Conn = quicmoq.New(conn)
+	assert.NoError(t, session.RunClient())
+}
+
+func webTransportDialer() *webtransport.Dialer {
+	tlsConfig := generateTLSConfig()
+	tlsConfig.NextProtos = nil
+	return &webtransport.Dialer{
+		TLSClientConfig: tlsConfig,
+		QUICConfig: &quic.Config{
+			EnableDatagrams: true,
+		},
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Run("quic_and_webtransport", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		var lock sync.Mutex
+		paths := []string{}
+		roles := []moqtransport.Role{}
+		server := &moqserver.Server{
+			Path: "/moq-test",
+			Session: &moqtransport.Session{
+				EnableDatagrams: true,
+				LocalRole:       moqtransport.RolePublisher,
+				SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+					srw.Accept(track)
+				}),
+			},
+			OnSession: func(s *moqtransport.Session) {
+				lock.Lock()
+				defer lock.Unlock()
+				paths = append(paths, s.Path)
+				roles = append(roles, s.LocalRole)
+			},
+		}
+		addr, errCh := startServer(t, server)
+
+		quicClient := &moqtransport.Session{}
+		dialQUICSession(t, ctx, addr, quicClient)
+
+		dialer := webTransportDialer()
+		rsp, _, err := dialer.Dial(ctx, fmt.Sprintf("https://%v/other", addr), nil)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, rsp.StatusCode)
+		_, wt, err := dialer.Dial(ctx, fmt.Sprintf("https://%v/moq-test", addr), nil)
+		assert.NoError(t, err)
+		wtClient := &moqtransport.Session{
+			Conn: webtransportmoq.New(wt),
+		}
+		assert.NoError(t, wtClient.RunClient())
+
+		for i, client := range []*moqtransport.Session{quicClient, wtClient} {
+			sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+			assert.NoError(t, err)
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              uint64(i),
+				ObjectID:             0,
+				ForwardingPreference: moqtransport.ObjectForwardingPreferenceStreamGroup,
+				Payload:              []byte("hello"),
+			}))
+			o, err := sub.ReadObject(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(o.Payload))
+		}
+		// OnSession runs concurrently to the sessions.
+		assert.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(paths) == 2
+		}, time.Second, 10*time.Millisecond)
+		lock.Lock()
+		assert.ElementsMatch(t, []string{"", "/moq-test"}, paths)
+		assert.Equal(t, []moqtransport.Role{moqtransport.RolePublisher, moqtransport.RolePublisher}, roles)
+		lock.Unlock()
+
+		assert.NoError(t, quicClient.Close())
+		assert.NoError(t, wtClient.Close())
+		assert.NoError(t, dialer.Close())
+		assert.NoError(t, server.Shutdown(ctx))
+		assert.ErrorIs(t, <-errCh, moqserver.ErrServerClosed)
+	})
+	t.Run("shutdown_sends_goaway", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		sessionCh := make(chan *moqtransport.Session, 1)
+		server := &moqserver.Server{
+			OnSession: func(s *moqtransport.Session) {
+				sessionCh <- s
+			},
+		}
+		addr, errCh := startServer(t, server)
+		goAwayCh := make(chan string, 1)
+		client := &moqtransport.Session{
+			GoAwayHandler: moqtransport.GoAwayHandlerFunc(func(s *moqtransport.Session, uri string) {
+				goAwayCh <- uri
+				assert.NoError(t, s.Close())
+			}),
+		}
+		dialQUICSession(t, ctx, addr, client)
+		<-sessionCh
+
+		assert.NoError(t, server.Shutdown(ctx))
+		assert.Equal(t, "", <-goAwayCh)
+		assert.ErrorIs(t, <-errCh, moqserver.ErrServerClosed)
+		<-client.Done()
+	})
+	t.Run("shutdown_timeout", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// A callback which does not return does not block Shutdown.
+		release := make(chan struct{})
+		defer close(release)
+		sessionCh := make(chan *moqtransport.Session, 1)
+		server := &moqserver.Server{
+			OnSession: func(s *moqtransport.Session) {
+				sessionCh <- s
+				<-release
+			},
+		}
+		addr, errCh := startServer(t, server)
+		client := &moqtransport.Session{}
+		dialQUICSession(t, ctx, addr, client)
+		session := <-sessionCh
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer shutdownCancel()
+		err := server.Shutdown(shutdownCtx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, <-errCh, moqserver.ErrServerClosed)
+		<-client.Done()
+		var protocolErr moqtransport.ProtocolError
+		if assert.ErrorAs(t, session.Err(), &protocolErr) {
+			assert.Equal(t, uint64(moqtransport.ErrorCodeGoAwayTimeout), protocolErr.Code())
+		}
+	})
+}
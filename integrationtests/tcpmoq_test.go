@@ -0,0 +1,163 @@
+package integrationtests_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/tcpmoq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// tcpSessions connects a client to a server publishing track over tcpmoq.
+func tcpSessions(t *testing.T, ctx context.Context, listener *tcpmoq.Listener, tlsConfig *tls.Config, track *moqtransport.LocalTrack) (*moqtransport.Session, *moqtransport.Session) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	serverCh := make(chan *moqtransport.Session, 1)
+	go func() {
+		defer wg.Done()
+		conn, err := listener.Accept(ctx)
+		if !assert.NoError(t, err) {
+			return
+		}
+		server := &moqtransport.Session{
+			Conn:            conn,
+			EnableDatagrams: true,
+			SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+				srw.Accept(track)
+			}),
+		}
+		assert.NoError(t, server.RunServer(ctx))
+		serverCh <- server
+	}()
+	conn, err := tcpmoq.Dial(ctx, listener.Addr().String(), tlsConfig)
+	assert.NoError(t, err)
+	client := &moqtransport.Session{
+		Conn:            conn,
+		EnableDatagrams: true,
+	}
+	assert.NoError(t, client.RunClient())
+	wg.Wait()
+	return client, <-serverCh
+}
+
+func TestTCP(t *testing.T) {
+	t.Run("send_receive_objects", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		tlsConfig := generateTLSConfig()
+		tlsConfig.NextProtos = nil
+		listener, err := tcpmoq.Listen("localhost:0", tlsConfig)
+		assert.NoError(t, err)
+		defer listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server := tcpSessions(t, ctx, listener, tlsConfig, track)
+
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for i, fp := range []moqtransport.ObjectForwardingPreference{
+			moqtransport.ObjectForwardingPreferenceDatagram,
+			moqtransport.ObjectForwardingPreferenceStream,
+			moqtransport.ObjectForwardingPreferenceStreamGroup,
+			moqtransport.ObjectForwardingPreferenceStreamTrack,
+		} {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              uint64(i),
+				ObjectID:             0,
+				ForwardingPreference: fp,
+				Payload:              []byte("hello"),
+			}))
+			o, err := sub.ReadObject(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(i), o.GroupID)
+			assert.Equal(t, "hello", string(o.Payload))
+		}
+		assert.NoError(t, client.Close())
+		<-server.Done()
+		assert.Error(t, server.Err())
+	})
+	t.Run("large_object_slow_reader", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		tlsConfig := generateTLSConfig()
+		tlsConfig.NextProtos = nil
+		listener, err := tcpmoq.Listen("localhost:0", tlsConfig)
+		assert.NoError(t, err)
+		defer listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		client, server := tcpSessions(t, ctx, listener, tlsConfig, track)
+
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		payload := make([]byte, 10<<20)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		written := make(chan error, 1)
+		go func() {
+			w, err := track.OpenObjectWriter(ctx, 0, 0, 0)
+			if err != nil {
+				written <- err
+				return
+			}
+			if _, err = w.Write(payload); err != nil {
+				written <- err
+				return
+			}
+			written <- w.Close()
+		}()
+		_, r, err := sub.AcceptObject(ctx)
+		assert.NoError(t, err)
+		// The object exceeds the receive window of the stream, so the
+		// publisher waits until the subscriber reads.
+		time.Sleep(100 * time.Millisecond)
+		buf := make([]byte, len(payload))
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, buf)
+		assert.NoError(t, <-written)
+		assert.NoError(t, client.Close())
+		<-server.Done()
+	})
+	t.Run("stalled_handshake", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		tlsConfig := generateTLSConfig()
+		tlsConfig.NextProtos = nil
+		listener, err := tcpmoq.Listen("localhost:0", tlsConfig)
+		assert.NoError(t, err)
+		defer listener.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// A client which never starts its handshake does not block other
+		// clients.
+		stalled, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+		defer stalled.Close()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := tcpmoq.Dial(ctx, listener.Addr().String(), tlsConfig)
+			if assert.NoError(t, err) {
+				defer conn.CloseWithError(0, "")
+			}
+		}()
+		conn, err := listener.Accept(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, conn.CloseWithError(0, ""))
+		wg.Wait()
+	})
+}
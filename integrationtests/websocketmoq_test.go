@@ -0,0 +1,78 @@
+package integrationtests_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/websocketmoq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestWebSocket(t *testing.T) {
+	t.Run("send_receive_objects", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		upgrader := &websocketmoq.Upgrader{}
+		serverCh := make(chan *moqtransport.Session, 1)
+		httpServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r)
+			if !assert.NoError(t, err) {
+				return
+			}
+			server := &moqtransport.Session{
+				Conn:            conn,
+				EnableDatagrams: true,
+				SubscriptionHandler: moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+					srw.Accept(track)
+				}),
+			}
+			assert.NoError(t, server.RunServer(ctx))
+			serverCh <- server
+		}))
+		defer httpServer.Close()
+
+		url := "wss" + strings.TrimPrefix(httpServer.URL, "https")
+		tlsConfig := httpServer.Client().Transport.(*http.Transport).TLSClientConfig
+		conn, err := websocketmoq.Dial(ctx, url, tlsConfig)
+		assert.NoError(t, err)
+		client := &moqtransport.Session{
+			Conn:            conn,
+			EnableDatagrams: true,
+		}
+		assert.NoError(t, client.RunClient())
+		server := <-serverCh
+
+		sub, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		for i, fp := range []moqtransport.ObjectForwardingPreference{
+			moqtransport.ObjectForwardingPreferenceDatagram,
+			moqtransport.ObjectForwardingPreferenceStream,
+			moqtransport.ObjectForwardingPreferenceStreamGroup,
+			moqtransport.ObjectForwardingPreferenceStreamTrack,
+		} {
+			assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+				GroupID:              uint64(i),
+				ObjectID:             0,
+				ForwardingPreference: fp,
+				Payload:              []byte("hello"),
+			}))
+			o, err := sub.ReadObject(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(i), o.GroupID)
+			assert.Equal(t, "hello", string(o.Payload))
+		}
+		assert.NoError(t, client.Close())
+		<-server.Done()
+		assert.Error(t, server.Err())
+	})
+}
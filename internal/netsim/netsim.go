@@ -0,0 +1,256 @@
+// Package netsim wraps a moqtransport.Connection to impair the traffic sent on
+// it. It is a test harness for running sessions under datagram loss and
+// reordering, stream resets, delayed stream opening and limited bandwidth.
+// Impairments only apply to the sending side of the wrapped connection, wrap
+// both connections of a pair to impair both directions.
+package netsim
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// ErrStreamReset is returned by writes to a stream that was reset by the
+// simulator.
+var ErrStreamReset = errors.New("stream reset by network simulator")
+
+// ResetCode is the error code of streams reset by the simulator.
+const ResetCode = 0x1e
+
+// Config configures the impairments of a connection. The zero value does not
+// impair the connection.
+type Config struct {
+	// DatagramLossRate is the probability in [0, 1] that a datagram is lost.
+	DatagramLossRate float64
+
+	// DatagramReorderRate is the probability in [0, 1] that a datagram is
+	// held back and sent after the next datagram. A held back datagram is
+	// sent after ReorderTimeout if no other datagram follows.
+	DatagramReorderRate float64
+	ReorderTimeout      time.Duration
+
+	// StreamResetRate is the probability in [0, 1] that a unidirectional
+	// stream is reset on its first write. Writes to reset streams fail with
+	// ErrStreamReset.
+	StreamResetRate float64
+
+	// StreamOpenDelay delays opening unidirectional streams.
+	StreamOpenDelay time.Duration
+
+	// Bandwidth limits the bytes per second written to unidirectional
+	// streams and sent in datagrams. Writes to streams wait until the data
+	// fits into the bandwidth, datagrams exceeding it are dropped. If zero,
+	// the bandwidth is not limited.
+	Bandwidth int
+
+	// Seed seeds the random decisions of the simulator, so that runs with
+	// the same seed impair the same datagrams and streams.
+	Seed int64
+}
+
+// Stats count the impairments applied to a connection.
+type Stats struct {
+	LostDatagrams      uint64
+	ReorderedDatagrams uint64
+	ResetStreams       uint64
+	ShapedBytes        uint64
+}
+
+// A Conn is a moqtransport.Connection whose outgoing traffic is impaired.
+type Conn struct {
+	moqtransport.Connection
+	config Config
+
+	lock   sync.Mutex
+	random *rand.Rand
+	held   []byte
+	timer  *time.Timer
+	stats  Stats
+
+	// nextSend is the time at which the bandwidth allows sending the next
+	// byte.
+	nextSend time.Time
+}
+
+var _ moqtransport.Connection = (*Conn)(nil)
+
+// Wrap returns conn with its outgoing traffic impaired according to config.
+func Wrap(conn moqtransport.Connection, config Config) *Conn {
+	if config.ReorderTimeout <= 0 {
+		config.ReorderTimeout = 10 * time.Millisecond
+	}
+	return &Conn{
+		Connection: conn,
+		config:     config,
+		lock:       sync.Mutex{},
+		random:     rand.New(rand.NewSource(config.Seed)),
+		held:       nil,
+		timer:      nil,
+		stats:      Stats{},
+		nextSend:   time.Time{},
+	}
+}
+
+// Stats returns the impairments applied so far.
+func (c *Conn) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
+
+// chance returns true with probability p. It must be called with the lock
+// held.
+func (c *Conn) chance(p float64) bool {
+	return p > 0 && c.random.Float64() < p
+}
+
+// reserve reserves n bytes of the bandwidth and returns how long the caller
+// must wait before sending them. It must be called with the lock held.
+func (c *Conn) reserve(n int) time.Duration {
+	if c.config.Bandwidth <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if c.nextSend.Before(now) {
+		c.nextSend = now
+	}
+	wait := c.nextSend.Sub(now)
+	c.nextSend = c.nextSend.Add(time.Duration(n) * time.Second / time.Duration(c.config.Bandwidth))
+	return wait
+}
+
+func (c *Conn) SendDatagram(b []byte) error {
+	c.lock.Lock()
+	if c.chance(c.config.DatagramLossRate) {
+		c.stats.LostDatagrams++
+		c.lock.Unlock()
+		return nil
+	}
+	if c.config.Bandwidth > 0 && c.nextSend.After(time.Now()) {
+		// Datagrams are not queued, they are lost if the link is busy.
+		c.stats.LostDatagrams++
+		c.lock.Unlock()
+		return nil
+	}
+	c.reserve(len(b))
+	if c.held == nil && c.chance(c.config.DatagramReorderRate) {
+		c.stats.ReorderedDatagrams++
+		c.held = append([]byte{}, b...)
+		c.timer = time.AfterFunc(c.config.ReorderTimeout, c.flushHeld)
+		c.lock.Unlock()
+		return nil
+	}
+	held := c.held
+	c.held = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.lock.Unlock()
+	if err := c.Connection.SendDatagram(b); err != nil {
+		return err
+	}
+	if held != nil {
+		return c.Connection.SendDatagram(held)
+	}
+	return nil
+}
+
+// flushHeld sends a held back datagram that was not followed by another
+// datagram in time.
+func (c *Conn) flushHeld() {
+	c.lock.Lock()
+	held := c.held
+	c.held = nil
+	c.timer = nil
+	c.lock.Unlock()
+	if held != nil {
+		_ = c.Connection.SendDatagram(held)
+	}
+}
+
+func (c *Conn) OpenUniStream() (moqtransport.SendStream, error) {
+	time.Sleep(c.config.StreamOpenDelay)
+	s, err := c.Connection.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapStream(s), nil
+}
+
+func (c *Conn) OpenUniStreamSync(ctx context.Context) (moqtransport.SendStream, error) {
+	select {
+	case <-time.After(c.config.StreamOpenDelay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	s, err := c.Connection.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.wrapStream(s), nil
+}
+
+func (c *Conn) wrapStream(s moqtransport.SendStream) *sendStream {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return &sendStream{
+		stream: s,
+		conn:   c,
+		reset:  c.chance(c.config.StreamResetRate),
+		failed: false,
+	}
+}
+
+// sendStream is a unidirectional stream whose writes are shaped to the
+// bandwidth of the connection and which may be reset on its first write.
+type sendStream struct {
+	stream moqtransport.SendStream
+	conn   *Conn
+	reset  bool
+	failed bool
+}
+
+var _ moqtransport.ResettableSendStream = (*sendStream)(nil)
+
+func (s *sendStream) Write(b []byte) (int, error) {
+	if s.failed {
+		return 0, ErrStreamReset
+	}
+	if s.reset {
+		s.failed = true
+		s.conn.lock.Lock()
+		s.conn.stats.ResetStreams++
+		s.conn.lock.Unlock()
+		s.CancelWrite(ResetCode)
+		return 0, ErrStreamReset
+	}
+	s.conn.lock.Lock()
+	wait := s.conn.reserve(len(b))
+	if wait > 0 {
+		s.conn.stats.ShapedBytes += uint64(len(b))
+	}
+	s.conn.lock.Unlock()
+	time.Sleep(wait)
+	return s.stream.Write(b)
+}
+
+func (s *sendStream) Close() error {
+	if s.failed {
+		return nil
+	}
+	return s.stream.Close()
+}
+
+func (s *sendStream) CancelWrite(code uint64) {
+	if rs, ok := s.stream.(moqtransport.ResettableSendStream); ok {
+		rs.CancelWrite(code)
+		return
+	}
+	_ = s.stream.Close()
+}
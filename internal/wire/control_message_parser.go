@@ -8,15 +8,22 @@ import (
 )
 
 type ControlMessageParser struct {
-	reader messageReader
+	reader  messageReader
+	version Version
 }
 
 func NewControlMessageParser(r io.Reader) *ControlMessageParser {
 	return &ControlMessageParser{
-		reader: bufio.NewReader(r),
+		reader:  bufio.NewReader(r),
+		version: CurrentVersion,
 	}
 }
 
+// SetVersion sets the version used to parse subsequent messages.
+func (p *ControlMessageParser) SetVersion(v Version) {
+	p.version = v
+}
+
 func (p *ControlMessageParser) Parse() (Message, error) {
 	mt, err := quicvarint.Read(p.reader)
 	var m Message
@@ -59,6 +66,10 @@ func (p *ControlMessageParser) Parse() (Message, error) {
 	default:
 		return nil, errInvalidMessageType
 	}
-	err = m.parse(p.reader)
+	if vm, ok := m.(VersionedMessage); ok {
+		err = vm.parseVersion(p.reader, p.version)
+	} else {
+		err = m.parse(p.reader)
+	}
 	return m, err
 }
@@ -13,6 +13,22 @@ type Message interface {
 	parse(messageReader) error
 }
 
+// A VersionedMessage is a Message whose encoding differs between protocol
+// versions. Append and parse of a VersionedMessage use CurrentVersion.
+type VersionedMessage interface {
+	Message
+	AppendVersion([]byte, Version) []byte
+	parseVersion(messageReader, Version) error
+}
+
+// AppendMessage appends m to buf using the encoding of version v.
+func AppendMessage(buf []byte, m Message, v Version) []byte {
+	if vm, ok := m.(VersionedMessage); ok {
+		return vm.AppendVersion(buf, v)
+	}
+	return m.Append(buf)
+}
+
 type ObjectMessageType uint64
 
 // Object message types
@@ -0,0 +1,197 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendMessageVersion(t *testing.T) {
+	cases := []struct {
+		msg     Message
+		version Version
+		expect  []byte
+	}{
+		{
+			msg: &SubscribeMessage{
+				SubscribeID:        1,
+				TrackAlias:         2,
+				TrackNamespace:     "ns",
+				TrackName:          "t",
+				SubscriberPriority: 7,
+				GroupOrder:         1,
+				FilterType:         FilterTypeLatestGroup,
+				Parameters:         Parameters{},
+			},
+			version: Draft_ietf_moq_transport_05,
+			expect:  []byte{byte(subscribeMessageType), 0x01, 0x02, 0x02, 'n', 's', 0x01, 't', 0x07, 0x01, 0x01, 0x00},
+		},
+		{
+			msg: &SubscribeMessage{
+				SubscribeID:        1,
+				TrackAlias:         2,
+				TrackNamespace:     "ns",
+				TrackName:          "t",
+				SubscriberPriority: 7,
+				GroupOrder:         1,
+				FilterType:         FilterTypeLatestGroup,
+				Parameters:         Parameters{},
+			},
+			version: Draft_ietf_moq_transport_04,
+			expect:  []byte{byte(subscribeMessageType), 0x01, 0x02, 0x02, 'n', 's', 0x01, 't', 0x01, 0x00},
+		},
+		{
+			msg: &SubscribeOkMessage{
+				SubscribeID:   1,
+				Expires:       0,
+				GroupOrder:    1,
+				ContentExists: false,
+			},
+			version: Draft_ietf_moq_transport_05,
+			expect:  []byte{byte(subscribeOkMessageType), 0x01, 0x00, 0x01, 0x00},
+		},
+		{
+			msg: &SubscribeOkMessage{
+				SubscribeID:   1,
+				Expires:       0,
+				GroupOrder:    0,
+				ContentExists: false,
+			},
+			version: Draft_ietf_moq_transport_04,
+			expect:  []byte{byte(subscribeOkMessageType), 0x01, 0x00, 0x00},
+		},
+		{
+			msg: &SubscribeUpdateMessage{
+				SubscribeID:        1,
+				StartGroup:         1,
+				StartObject:        2,
+				EndGroup:           3,
+				EndObject:          4,
+				SubscriberPriority: 7,
+				Parameters:         Parameters{},
+			},
+			version: Draft_ietf_moq_transport_05,
+			expect:  []byte{byte(subscribeUpdateMessageType), 0x01, 0x01, 0x02, 0x03, 0x04, 0x07, 0x00},
+		},
+		{
+			msg: &SubscribeUpdateMessage{
+				SubscribeID:        1,
+				StartGroup:         1,
+				StartObject:        2,
+				EndGroup:           3,
+				EndObject:          4,
+				SubscriberPriority: 7,
+				Parameters:         Parameters{},
+			},
+			version: Draft_ietf_moq_transport_04,
+			expect:  []byte{byte(subscribeUpdateMessageType), 0x01, 0x01, 0x02, 0x03, 0x04, 0x00},
+		},
+		{
+			msg: &UnsubscribeMessage{
+				SubscribeID: 1,
+			},
+			version: Draft_ietf_moq_transport_04,
+			expect:  []byte{byte(unsubscribeMessageType), 0x01},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			res := AppendMessage([]byte{}, tc.msg, tc.version)
+			assert.Equal(t, tc.expect, res)
+
+			p := NewControlMessageParser(bytes.NewReader(res))
+			p.SetVersion(tc.version)
+			msg, err := p.Parse()
+			assert.NoError(t, err)
+			assert.Equal(t, res, AppendMessage([]byte{}, msg, tc.version))
+		})
+	}
+}
+
+func TestObjectMessagesVersion(t *testing.T) {
+	cases := []struct {
+		data    []byte
+		version Version
+		expect  *ObjectMessage
+	}{
+		{
+			data: (&ObjectMessage{
+				Type:              ObjectStreamMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 5,
+				ObjectPayload:     []byte{'a'},
+			}).AppendVersion([]byte{}, Draft_ietf_moq_transport_04),
+			version: Draft_ietf_moq_transport_04,
+			expect: &ObjectMessage{
+				Type:              ObjectStreamMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 0,
+				ObjectPayload:     []byte{'a'},
+			},
+		},
+		{
+			data: append(
+				(&StreamHeaderTrackMessage{
+					SubscribeID:       1,
+					TrackAlias:        2,
+					PublisherPriority: 5,
+				}).AppendVersion([]byte{}, Draft_ietf_moq_transport_04),
+				(&StreamHeaderTrackObject{
+					GroupID:       3,
+					ObjectID:      4,
+					ObjectPayload: []byte{'a'},
+				}).Append([]byte{})...,
+			),
+			version: Draft_ietf_moq_transport_04,
+			expect: &ObjectMessage{
+				Type:              StreamHeaderTrackMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 0,
+				ObjectPayload:     []byte{'a'},
+			},
+		},
+		{
+			data: append(
+				(&StreamHeaderGroupMessage{
+					SubscribeID:       1,
+					TrackAlias:        2,
+					GroupID:           3,
+					PublisherPriority: 5,
+				}).AppendVersion([]byte{}, Draft_ietf_moq_transport_05),
+				(&StreamHeaderGroupObject{
+					ObjectID:      4,
+					ObjectPayload: []byte{'a'},
+				}).Append([]byte{})...,
+			),
+			version: Draft_ietf_moq_transport_05,
+			expect: &ObjectMessage{
+				Type:              StreamHeaderGroupMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 5,
+				ObjectPayload:     []byte{'a'},
+			},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			p := NewObjectStreamParser(bytes.NewReader(tc.data), tc.version)
+			res, err := p.Parse()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, res)
+		})
+	}
+}
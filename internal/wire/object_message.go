@@ -28,6 +28,10 @@ type ObjectMessage struct {
 }
 
 func (m *ObjectMessage) Append(buf []byte) []byte {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *ObjectMessage) AppendVersion(buf []byte, v Version) []byte {
 	if m.Type == ObjectDatagramMessageType {
 		buf = quicvarint.Append(buf, uint64(ObjectDatagramMessageType))
 	} else {
@@ -37,13 +41,50 @@ func (m *ObjectMessage) Append(buf []byte) []byte {
 	buf = quicvarint.Append(buf, m.TrackAlias)
 	buf = quicvarint.Append(buf, m.GroupID)
 	buf = quicvarint.Append(buf, m.ObjectID)
-	buf = append(buf, m.PublisherPriority)
+	if v.hasPriorities() {
+		buf = append(buf, m.PublisherPriority)
+	}
 	buf = quicvarint.Append(buf, uint64(m.ObjectStatus))
 	buf = append(buf, m.ObjectPayload...)
 	return buf
 }
 
-func (m *ObjectMessage) parse(data []byte) (parsed int, err error) {
+// parseHeader reads all fields of an object message except for the payload
+// from r.
+func (m *ObjectMessage) parseHeader(r messageReader, v Version) (err error) {
+	m.SubscribeID, err = quicvarint.Read(r)
+	if err != nil {
+		return
+	}
+	m.TrackAlias, err = quicvarint.Read(r)
+	if err != nil {
+		return
+	}
+	m.GroupID, err = quicvarint.Read(r)
+	if err != nil {
+		return
+	}
+	m.ObjectID, err = quicvarint.Read(r)
+	if err != nil {
+		return
+	}
+	if v.hasPriorities() {
+		m.PublisherPriority, err = r.ReadByte()
+		if err != nil {
+			return
+		}
+	}
+	var status uint64
+	status, err = quicvarint.Read(r)
+	m.ObjectStatus = ObjectStatus(status)
+	return
+}
+
+func (m *ObjectMessage) parse(data []byte) (int, error) {
+	return m.parseVersion(data, CurrentVersion)
+}
+
+func (m *ObjectMessage) parseVersion(data []byte, v Version) (parsed int, err error) {
 	var n int
 	m.SubscribeID, n, err = quicvarint.Parse(data)
 	parsed += n
@@ -69,12 +110,14 @@ func (m *ObjectMessage) parse(data []byte) (parsed int, err error) {
 		return
 	}
 	data = data[n:]
-	if len(data) == 0 {
-		return parsed, io.EOF
+	if v.hasPriorities() {
+		if len(data) == 0 {
+			return parsed, io.EOF
+		}
+		m.PublisherPriority = data[0]
+		parsed += 1
+		data = data[1:]
 	}
-	m.PublisherPriority = data[0]
-	parsed += 1
-	data = data[1:]
 	var status uint64
 	status, n, err = quicvarint.Parse(data)
 	parsed += n
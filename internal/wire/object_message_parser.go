@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bufio"
+	"bytes"
 	"io"
 
 	"github.com/quic-go/quic-go/quicvarint"
@@ -9,6 +10,7 @@ import (
 
 type ObjectStreamParser struct {
 	reader     messageReader
+	version    Version
 	gotHeader  bool
 	streamType ObjectMessageType
 
@@ -18,9 +20,10 @@ type ObjectStreamParser struct {
 	groupID           uint64
 }
 
-func NewObjectStreamParser(r io.Reader) *ObjectStreamParser {
+func NewObjectStreamParser(r io.Reader, v Version) *ObjectStreamParser {
 	return &ObjectStreamParser{
 		reader:            bufio.NewReader(r),
+		version:           v,
 		gotHeader:         false,
 		streamType:        0,
 		subscribeID:       0,
@@ -30,35 +33,72 @@ func NewObjectStreamParser(r io.Reader) *ObjectStreamParser {
 	}
 }
 
-func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
+// ParseStream is like Parse, except that it does not read the payload of an
+// object sent on an object stream into memory. Instead, it returns the object
+// without payload and a reader of the payload, which is the remainder of the
+// stream. For objects of all other types, the returned reader reads from the
+// payload of the returned object.
+func (p *ObjectStreamParser) ParseStream() (*ObjectMessage, io.Reader, error) {
 	if !p.gotHeader {
-		mt, err := quicvarint.Read(p.reader)
-		if err != nil {
-			return nil, err
+		if err := p.parseStreamHeader(); err != nil {
+			return nil, nil, err
 		}
-		p.streamType = ObjectMessageType(mt)
-		p.gotHeader = true
-		switch p.streamType {
-		case StreamHeaderTrackMessageType:
-			shtm := &StreamHeaderTrackMessage{}
-			if err := shtm.parse(p.reader); err != nil {
-				return nil, err
+		if p.streamType == ObjectStreamMessageType {
+			om := &ObjectMessage{
+				Type: ObjectStreamMessageType,
 			}
-			p.subscribeID = shtm.SubscribeID
-			p.trackAlias = shtm.TrackAlias
-			p.publisherPriority = shtm.PublisherPriority
-		case StreamHeaderGroupMessageType:
-			shgm := &StreamHeaderGroupMessage{}
-			if err := shgm.parse(p.reader); err != nil {
-				return nil, err
+			if err := om.parseHeader(p.reader, p.version); err != nil {
+				return nil, nil, err
 			}
-			p.subscribeID = shgm.SubscribeID
-			p.trackAlias = shgm.TrackAlias
-			p.publisherPriority = shgm.PublisherPriority
-			p.groupID = shgm.GroupID
+			return om, p.reader, nil
+		}
+	}
+	om, err := p.Parse()
+	if err != nil {
+		return nil, nil, err
+	}
+	return om, bytes.NewReader(om.ObjectPayload), nil
+}
+
+func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
+	if !p.gotHeader {
+		if err := p.parseStreamHeader(); err != nil {
+			return nil, err
 		}
 	}
+	return p.parseObject()
+}
+
+func (p *ObjectStreamParser) parseStreamHeader() error {
+	mt, err := quicvarint.Read(p.reader)
+	if err != nil {
+		return err
+	}
+	p.streamType = ObjectMessageType(mt)
+	p.gotHeader = true
+	switch p.streamType {
+	case StreamHeaderTrackMessageType:
+		shtm := &StreamHeaderTrackMessage{}
+		if err := shtm.parseVersion(p.reader, p.version); err != nil {
+			return err
+		}
+		p.subscribeID = shtm.SubscribeID
+		p.trackAlias = shtm.TrackAlias
+		p.publisherPriority = shtm.PublisherPriority
+	case StreamHeaderGroupMessageType:
+		shgm := &StreamHeaderGroupMessage{}
+		if err := shgm.parseVersion(p.reader, p.version); err != nil {
+			return err
+		}
+		p.subscribeID = shgm.SubscribeID
+		p.trackAlias = shgm.TrackAlias
+		p.publisherPriority = shgm.PublisherPriority
+		p.groupID = shgm.GroupID
+	}
+	return nil
+}
 
+func (p *ObjectStreamParser) parseObject() (*ObjectMessage, error) {
 	switch p.streamType {
 	case ObjectStreamMessageType:
 		om := &ObjectMessage{
@@ -69,7 +109,7 @@ func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
 		if err != nil {
 			return nil, err
 		}
-		_, err = om.parse(buf)
+		_, err = om.parseVersion(buf, p.version)
 		return om, err
 
 	case ObjectDatagramMessageType:
@@ -81,7 +121,7 @@ func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
 		if err != nil {
 			return nil, err
 		}
-		if _, err = om.parse(buf); err != nil {
+		if _, err = om.parseVersion(buf, p.version); err != nil {
 			return nil, err
 		}
 		return om, nil
@@ -98,6 +138,7 @@ func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
 			GroupID:           om.GroupID,
 			ObjectID:          om.ObjectID,
 			PublisherPriority: p.publisherPriority,
+			ObjectStatus:      om.ObjectStatus,
 			ObjectPayload:     om.ObjectPayload,
 		}, nil
 
@@ -113,6 +154,7 @@ func (p *ObjectStreamParser) Parse() (*ObjectMessage, error) {
 			GroupID:           p.groupID,
 			ObjectID:          om.ObjectID,
 			PublisherPriority: p.publisherPriority,
+			ObjectStatus:      om.ObjectStatus,
 			ObjectPayload:     om.ObjectPayload,
 		}, nil
 	}
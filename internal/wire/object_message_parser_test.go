@@ -1,6 +1,7 @@
 package wire
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"testing"
@@ -67,6 +68,11 @@ func TestObjectStreamParser(t *testing.T) {
 						ObjectID:      1,
 						ObjectPayload: []byte{0x01},
 					}).Append([]byte{}),
+					(&StreamHeaderGroupObject{
+						ObjectID:      2,
+						ObjectStatus:  ObjectStatusEndOfGroup,
+						ObjectPayload: nil,
+					}).Append([]byte{}),
 				},
 				index: 0,
 			},
@@ -89,13 +95,23 @@ func TestObjectStreamParser(t *testing.T) {
 					PublisherPriority: 0,
 					ObjectPayload:     []byte{0x01},
 				},
+				{
+					Type:              StreamHeaderGroupMessageType,
+					SubscribeID:       0,
+					TrackAlias:        0,
+					GroupID:           0,
+					ObjectID:          2,
+					PublisherPriority: 0,
+					ObjectStatus:      ObjectStatusEndOfGroup,
+					ObjectPayload:     nil,
+				},
 			},
 			err: io.EOF,
 		},
 	}
 	for i, tc := range cases {
 		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
-			p := NewObjectStreamParser(tc.mr)
+			p := NewObjectStreamParser(tc.mr, CurrentVersion)
 			res := []*ObjectMessage{}
 			for {
 				m, err := p.Parse()
@@ -110,3 +126,71 @@ func TestObjectStreamParser(t *testing.T) {
 		})
 	}
 }
+
+func TestObjectStreamParserParseStream(t *testing.T) {
+	cases := []struct {
+		data          []byte
+		expectHeader  *ObjectMessage
+		expectPayload []byte
+	}{
+		{
+			data: (&ObjectMessage{
+				Type:              ObjectStreamMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 5,
+				ObjectStatus:      0,
+				ObjectPayload:     []byte("hello world"),
+			}).Append([]byte{}),
+			expectHeader: &ObjectMessage{
+				Type:              ObjectStreamMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 5,
+				ObjectStatus:      0,
+				ObjectPayload:     nil,
+			},
+			expectPayload: []byte("hello world"),
+		},
+		{
+			data: append(
+				(&StreamHeaderGroupMessage{
+					SubscribeID:       1,
+					TrackAlias:        2,
+					GroupID:           3,
+					PublisherPriority: 5,
+				}).Append([]byte{}),
+				(&StreamHeaderGroupObject{
+					ObjectID:      4,
+					ObjectPayload: []byte("hello world"),
+				}).Append([]byte{})...,
+			),
+			expectHeader: &ObjectMessage{
+				Type:              StreamHeaderGroupMessageType,
+				SubscribeID:       1,
+				TrackAlias:        2,
+				GroupID:           3,
+				ObjectID:          4,
+				PublisherPriority: 5,
+				ObjectStatus:      0,
+				ObjectPayload:     []byte("hello world"),
+			},
+			expectPayload: []byte("hello world"),
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			p := NewObjectStreamParser(bytes.NewReader(tc.data), CurrentVersion)
+			header, r, err := p.ParseStream()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectHeader, header)
+			payload, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectPayload, payload)
+		})
+	}
+}
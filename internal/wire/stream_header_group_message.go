@@ -10,15 +10,25 @@ type StreamHeaderGroupMessage struct {
 }
 
 func (m *StreamHeaderGroupMessage) Append(buf []byte) []byte {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *StreamHeaderGroupMessage) AppendVersion(buf []byte, v Version) []byte {
 	buf = quicvarint.Append(buf, uint64(StreamHeaderGroupMessageType))
 	buf = quicvarint.Append(buf, m.SubscribeID)
 	buf = quicvarint.Append(buf, m.TrackAlias)
 	buf = quicvarint.Append(buf, m.GroupID)
-	buf = append(buf, m.PublisherPriority)
+	if v.hasPriorities() {
+		buf = append(buf, m.PublisherPriority)
+	}
 	return buf
 }
 
-func (m *StreamHeaderGroupMessage) parse(reader messageReader) (err error) {
+func (m *StreamHeaderGroupMessage) parse(reader messageReader) error {
+	return m.parseVersion(reader, CurrentVersion)
+}
+
+func (m *StreamHeaderGroupMessage) parseVersion(reader messageReader, v Version) (err error) {
 	m.SubscribeID, err = quicvarint.Read(reader)
 	if err != nil {
 		return
@@ -31,6 +41,8 @@ func (m *StreamHeaderGroupMessage) parse(reader messageReader) (err error) {
 	if err != nil {
 		return
 	}
-	m.PublisherPriority, err = reader.ReadByte()
+	if v.hasPriorities() {
+		m.PublisherPriority, err = reader.ReadByte()
+	}
 	return
 }
@@ -9,14 +9,24 @@ type StreamHeaderTrackMessage struct {
 }
 
 func (m *StreamHeaderTrackMessage) Append(buf []byte) []byte {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *StreamHeaderTrackMessage) AppendVersion(buf []byte, v Version) []byte {
 	buf = quicvarint.Append(buf, uint64(StreamHeaderTrackMessageType))
 	buf = quicvarint.Append(buf, m.SubscribeID)
 	buf = quicvarint.Append(buf, m.TrackAlias)
-	buf = append(buf, m.PublisherPriority)
+	if v.hasPriorities() {
+		buf = append(buf, m.PublisherPriority)
+	}
 	return buf
 }
 
-func (m *StreamHeaderTrackMessage) parse(reader messageReader) (err error) {
+func (m *StreamHeaderTrackMessage) parse(reader messageReader) error {
+	return m.parseVersion(reader, CurrentVersion)
+}
+
+func (m *StreamHeaderTrackMessage) parseVersion(reader messageReader, v Version) (err error) {
 	m.SubscribeID, err = quicvarint.Read(reader)
 	if err != nil {
 		return
@@ -25,6 +35,8 @@ func (m *StreamHeaderTrackMessage) parse(reader messageReader) (err error) {
 	if err != nil {
 		return
 	}
-	m.PublisherPriority, err = reader.ReadByte()
+	if v.hasPriorities() {
+		m.PublisherPriority, err = reader.ReadByte()
+	}
 	return
 }
@@ -41,13 +41,19 @@ func (m SubscribeMessage) GetSubscribeID() uint64 {
 }
 
 func (m *SubscribeMessage) Append(buf []byte) []byte {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *SubscribeMessage) AppendVersion(buf []byte, v Version) []byte {
 	buf = quicvarint.Append(buf, uint64(subscribeMessageType))
 	buf = quicvarint.Append(buf, m.SubscribeID)
 	buf = quicvarint.Append(buf, m.TrackAlias)
 	buf = appendVarIntString(buf, m.TrackNamespace)
 	buf = appendVarIntString(buf, m.TrackName)
-	buf = append(buf, m.SubscriberPriority)
-	buf = append(buf, m.GroupOrder)
+	if v.hasPriorities() {
+		buf = append(buf, m.SubscriberPriority)
+		buf = append(buf, m.GroupOrder)
+	}
 	buf = m.FilterType.append(buf)
 	if m.FilterType == FilterTypeAbsoluteStart || m.FilterType == FilterTypeAbsoluteRange {
 		buf = quicvarint.Append(buf, m.StartGroup)
@@ -60,7 +66,11 @@ func (m *SubscribeMessage) Append(buf []byte) []byte {
 	return m.Parameters.append(buf)
 }
 
-func (m *SubscribeMessage) parse(reader messageReader) (err error) {
+func (m *SubscribeMessage) parse(reader messageReader) error {
+	return m.parseVersion(reader, CurrentVersion)
+}
+
+func (m *SubscribeMessage) parseVersion(reader messageReader, v Version) (err error) {
 	m.SubscribeID, err = quicvarint.Read(reader)
 	if err != nil {
 		return err
@@ -77,16 +87,18 @@ func (m *SubscribeMessage) parse(reader messageReader) (err error) {
 	if err != nil {
 		return err
 	}
-	m.SubscriberPriority, err = reader.ReadByte()
-	if err != nil {
-		return err
-	}
-	m.GroupOrder, err = reader.ReadByte()
-	if err != nil {
-		return err
-	}
-	if m.GroupOrder > 2 {
-		return errInvalidGroupOrder
+	if v.hasPriorities() {
+		m.SubscriberPriority, err = reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		m.GroupOrder, err = reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if m.GroupOrder > 2 {
+			return errInvalidGroupOrder
+		}
 	}
 	ft, err := quicvarint.Read(reader)
 	if err != nil {
@@ -20,13 +20,19 @@ func (m SubscribeOkMessage) GetSubscribeID() uint64 {
 }
 
 func (m *SubscribeOkMessage) Append(buf []byte) []byte {
-	if m.GroupOrder == 0 {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *SubscribeOkMessage) AppendVersion(buf []byte, v Version) []byte {
+	if v.hasPriorities() && m.GroupOrder == 0 {
 		panic(errInvalidGroupOrder)
 	}
 	buf = quicvarint.Append(buf, uint64(subscribeOkMessageType))
 	buf = quicvarint.Append(buf, m.SubscribeID)
 	buf = quicvarint.Append(buf, uint64(m.Expires))
-	buf = append(buf, m.GroupOrder)
+	if v.hasPriorities() {
+		buf = append(buf, m.GroupOrder)
+	}
 	if m.ContentExists {
 		buf = append(buf, 1) // ContentExists=true
 		buf = quicvarint.Append(buf, m.FinalGroup)
@@ -37,7 +43,11 @@ func (m *SubscribeOkMessage) Append(buf []byte) []byte {
 	return buf
 }
 
-func (m *SubscribeOkMessage) parse(reader messageReader) (err error) {
+func (m *SubscribeOkMessage) parse(reader messageReader) error {
+	return m.parseVersion(reader, CurrentVersion)
+}
+
+func (m *SubscribeOkMessage) parseVersion(reader messageReader, v Version) (err error) {
 	m.SubscribeID, err = quicvarint.Read(reader)
 	if err != nil {
 		return
@@ -48,12 +58,14 @@ func (m *SubscribeOkMessage) parse(reader messageReader) (err error) {
 		return
 	}
 	m.Expires = time.Duration(expires) * time.Millisecond
-	m.GroupOrder, err = reader.ReadByte()
-	if err != nil {
-		return err
-	}
-	if m.GroupOrder == 0 || m.GroupOrder > 2 {
-		return errInvalidGroupOrder
+	if v.hasPriorities() {
+		m.GroupOrder, err = reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if m.GroupOrder == 0 || m.GroupOrder > 2 {
+			return errInvalidGroupOrder
+		}
 	}
 	var contentExistsByte byte
 	contentExistsByte, err = reader.ReadByte()
@@ -15,17 +15,27 @@ type SubscribeUpdateMessage struct {
 }
 
 func (m *SubscribeUpdateMessage) Append(buf []byte) []byte {
+	return m.AppendVersion(buf, CurrentVersion)
+}
+
+func (m *SubscribeUpdateMessage) AppendVersion(buf []byte, v Version) []byte {
 	buf = quicvarint.Append(buf, uint64(subscribeUpdateMessageType))
 	buf = quicvarint.Append(buf, m.SubscribeID)
 	buf = quicvarint.Append(buf, m.StartGroup)
 	buf = quicvarint.Append(buf, m.StartObject)
 	buf = quicvarint.Append(buf, m.EndGroup)
 	buf = quicvarint.Append(buf, m.EndObject)
-	buf = append(buf, m.SubscriberPriority)
+	if v.hasPriorities() {
+		buf = append(buf, m.SubscriberPriority)
+	}
 	return m.Parameters.append(buf)
 }
 
-func (m *SubscribeUpdateMessage) parse(reader messageReader) (err error) {
+func (m *SubscribeUpdateMessage) parse(reader messageReader) error {
+	return m.parseVersion(reader, CurrentVersion)
+}
+
+func (m *SubscribeUpdateMessage) parseVersion(reader messageReader, v Version) (err error) {
 	m.SubscribeID, err = quicvarint.Read(reader)
 	if err != nil {
 		return err
@@ -46,9 +56,11 @@ func (m *SubscribeUpdateMessage) parse(reader messageReader) (err error) {
 	if err != nil {
 		return err
 	}
-	m.SubscriberPriority, err = reader.ReadByte()
-	if err != nil {
-		return err
+	if v.hasPriorities() {
+		m.SubscriberPriority, err = reader.ReadByte()
+		if err != nil {
+			return err
+		}
 	}
 	m.Parameters = Parameters{}
 	return m.Parameters.parse(reader)
@@ -24,6 +24,12 @@ func (v Version) String() string {
 	return fmt.Sprintf("0x%x", uint64(v))
 }
 
+// hasPriorities reports whether messages of version v carry subscriber and
+// publisher priorities and group order. Both were introduced in draft 05.
+func (v Version) hasPriorities() bool {
+	return v >= Draft_ietf_moq_transport_05
+}
+
 func (v Version) Len() uint64 {
 	return uint64(quicvarint.Len(uint64(v)))
 }
@@ -10,6 +10,12 @@ import (
 	"github.com/mengelbart/moqtransport/internal/wire"
 )
 
+var (
+	errTrackClosed    = errors.New("track closed")
+	errTrackFinished  = errors.New("track finished")
+	errGroupNotLatest = errors.New("group is older than the latest group of the track")
+)
+
 type subscriberID int
 
 func (id *subscriberID) next() subscriberID {
@@ -19,13 +25,37 @@ func (id *subscriberID) next() subscriberID {
 
 type addSubscriberOp struct {
 	subscriber ObjectWriter
+	filter     FilterType
 	resultCh   chan subscriberID
 }
 
+// A latestStarter is a subscriber whose delivery window may start at the
+// largest location of the track. The track calls startAtLatest when it adds
+// the subscriber, before writing any object to it.
+type latestStarter interface {
+	startAtLatest(largest location, hasObjects bool)
+}
+
 type removeSubscriberOp struct {
 	subscriberID subscriberID
 }
 
+type openObjectWriterOp struct {
+	header   Object
+	resultCh chan openObjectWriterResult
+}
+
+type openObjectWriterResult struct {
+	writer io.WriteCloser
+	err    error
+}
+
+type endOp struct {
+	status   ObjectStatus
+	groupID  uint64
+	resultCh chan error
+}
+
 type ObjectForwardingPreference int
 
 const (
@@ -49,11 +79,27 @@ func objectForwardingPreferenceFromMessageType(t wire.ObjectMessageType) ObjectF
 	panic("invalid object message type")
 }
 
+// ObjectStatus is the status of an object. Objects with a status other than
+// ObjectStatusNormal carry no payload.
+type ObjectStatus = wire.ObjectStatus
+
+const (
+	ObjectStatusNormal             ObjectStatus = wire.ObjectStatusNormal
+	ObjectStatusObjectDoesNotExist ObjectStatus = wire.ObjectStatusObjectDoesNotExist
+	ObjectStatusGroupDoesNotExist  ObjectStatus = wire.ObjectStatusGroupDoesNotExist
+	ObjectStatusEndOfGroup         ObjectStatus = wire.ObjectStatusEndOfGroup
+	ObjectStatusEndOfTrack         ObjectStatus = wire.ObjectStatusEndOfTrack
+)
+
+// An Object is a unit of data of a track. Status signals objects that do not
+// exist and the end of groups and of the track. Objects with a Status other
+// than ObjectStatusNormal carry no payload.
 type Object struct {
 	GroupID              uint64
 	ObjectID             uint64
 	PublisherPriority    uint8
 	ForwardingPreference ObjectForwardingPreference
+	Status               ObjectStatus
 
 	Payload []byte
 }
@@ -64,6 +110,15 @@ type ObjectWriter interface {
 	io.Closer
 }
 
+// An objectStreamOpener is an ObjectWriter that can receive the payload of an
+// object in chunks instead of all at once.
+type objectStreamOpener interface {
+	// openObjectStream returns a writer of the payload of the object with the
+	// given header. It returns a nil writer if the subscriber is not
+	// interested in the object.
+	openObjectStream(header Object) (io.WriteCloser, error)
+}
+
 // A LocalTrack is a local media source. Writing objects to the track will relay
 // the objects to all subscribers.
 // All methods are safe for concurrent use. Ordering of objects is only
@@ -80,15 +135,116 @@ type LocalTrack struct {
 
 	addSubscriberCh    chan addSubscriberOp
 	removeSubscriberCh chan removeSubscriberOp
+	endCh              chan endOp
+	openWriterCh       chan openObjectWriterOp
 	subscribers        map[subscriberID]ObjectWriter
 	objectCh           chan Object
 	subscriberCountCh  chan int
+	statusCh           chan TrackStatus
+	statsCh            chan LocalTrackStats
+	cache              *objectCache
+	onSubscriberCount  func(int)
+	onSubscriberError  func(error)
+	groupStreams       groupStreamConfig
+
+	nextID     subscriberID
+	largest    location
+	hasObjects bool
+	last       Object
+	finished   bool
+	stats      LocalTrackStats
+
+	// closedStats are the counters of the track when it was closed. They are
+	// written by the loop before it exits.
+	closedStats LocalTrackStats
+}
+
+// LocalTrackStats are counters of a LocalTrack. ObjectsWritten counts the
+// objects written to the track, including objects signaling the end of a group
+// or of the track, and objects opened with OpenObjectWriter. SubscriberErrors
+// counts the subscribers removed because delivering objects to them failed.
+type LocalTrackStats struct {
+	Subscribers      int
+	ObjectsWritten   uint64
+	SubscriberErrors uint64
+}
+
+// A LocalTrackOption configures a LocalTrack.
+type LocalTrackOption func(*LocalTrack)
+
+// WithCache enables caching of objects according to config. New subscribers
+// receive the cached objects of the latest group, if they subscribed with
+// FilterTypeLatestGroup, the current object, if they subscribed with
+// FilterTypeLatestObject, or all cached objects in the requested range, if
+// they subscribed with FilterTypeAbsoluteStart or FilterTypeAbsoluteRange.
+func WithCache(config CacheConfig) LocalTrackOption {
+	return func(t *LocalTrack) {
+		if config.enabled() {
+			t.cache = newObjectCache(config)
+		}
+	}
+}
+
+// WithSubscriberCountHandler registers f to be called with the new number of
+// subscribers whenever a subscriber is added to or removed from the track. f
+// is called from the internal goroutine of the track and must not block or
+// call any methods of the track. When a subscriber is added, f is called
+// before the subscription is accepted.
+func WithSubscriberCountHandler(f func(int)) LocalTrackOption {
+	return func(t *LocalTrack) {
+		t.onSubscriberCount = f
+	}
+}
+
+// WithSubscriberErrorHandler registers f to be called whenever delivering
+// objects to a subscriber fails. The failing subscriber is removed from the
+// track and, if it is a subscription of a session, the session ends the
+// subscription with SubscribeStatusInternalError. f may be called concurrently
+// from internal goroutines and must not block or call any methods of the
+// track.
+func WithSubscriberErrorHandler(f func(error)) LocalTrackOption {
+	return func(t *LocalTrack) {
+		t.onSubscriberError = f
+	}
+}
+
+// DefaultMaxOpenGroupStreams is the number of group streams each subscription
+// of a LocalTrack keeps open concurrently, unless configured otherwise using
+// WithMaxOpenGroupStreams.
+const DefaultMaxOpenGroupStreams = 16
+
+// groupStreamConfig configures how subscriptions of a track manage the streams
+// of objects written with ObjectForwardingPreferenceStreamGroup.
+type groupStreamConfig struct {
+	maxOpen    int
+	resetStale bool
+}
 
-	nextID subscriberID
+// WithMaxOpenGroupStreams limits the number of group streams each subscription
+// of the track keeps open concurrently to n. If a subscription needs to open a
+// stream for a new group while n streams are open, the stream of the oldest
+// group is closed first.
+func WithMaxOpenGroupStreams(n int) LocalTrackOption {
+	return func(t *LocalTrack) {
+		if n > 0 {
+			t.groupStreams.maxOpen = n
+		}
+	}
+}
+
+// WithStaleGroupReset makes subscriptions of the track reset the streams of
+// older groups, when a newer group starts, instead of closing them. Objects of
+// older groups that are written after a newer group started are dropped. This
+// is useful for latency sensitive tracks, where a subscriber would rather skip
+// old groups than receive them late.
+func WithStaleGroupReset() LocalTrackOption {
+	return func(t *LocalTrack) {
+		t.groupStreams.resetStale = true
+	}
 }
 
 // NewLocalTrack creates a new LocalTrack
-func NewLocalTrack(namespace, trackname string) *LocalTrack {
+func NewLocalTrack(namespace, trackname string, opts ...LocalTrackOption) *LocalTrack {
 	ctx, cancelCtx := context.WithCancel(context.Background())
 	lt := &LocalTrack{
 		logger:             defaultLogger.WithGroup("MOQ_LOCAL_TRACK").With("namespace", namespace, "trackname", trackname),
@@ -99,10 +255,31 @@ func NewLocalTrack(namespace, trackname string) *LocalTrack {
 		ctx:                ctx,
 		addSubscriberCh:    make(chan addSubscriberOp),
 		removeSubscriberCh: make(chan removeSubscriberOp),
+		endCh:              make(chan endOp),
+		openWriterCh:       make(chan openObjectWriterOp),
 		subscribers:        map[subscriberID]ObjectWriter{},
 		objectCh:           make(chan Object),
 		subscriberCountCh:  make(chan int),
-		nextID:             0,
+		statusCh:           make(chan TrackStatus),
+		statsCh:            make(chan LocalTrackStats),
+		cache:              nil,
+		onSubscriberCount:  nil,
+		onSubscriberError:  nil,
+		groupStreams: groupStreamConfig{
+			maxOpen:    DefaultMaxOpenGroupStreams,
+			resetStale: false,
+		},
+		nextID:     0,
+		largest:    location{},
+		hasObjects: false,
+		last:       Object{},
+		finished:   false,
+		stats:      LocalTrackStats{},
+
+		closedStats: LocalTrackStats{},
+	}
+	for _, opt := range opts {
+		opt(lt)
 	}
 	lt.cancelWG.Add(1)
 	go lt.loop()
@@ -117,37 +294,223 @@ func (t *LocalTrack) loop() {
 			for _, v := range t.subscribers {
 				v.Close()
 			}
+			t.closedStats = t.stats
 			return
 		case op := <-t.addSubscriberCh:
 			id := t.nextID.next()
+			if ls, ok := op.subscriber.(latestStarter); ok {
+				ls.startAtLatest(t.largest, t.hasObjects)
+			}
 			t.subscribers[id] = op.subscriber
+			if t.cache != nil {
+				for _, o := range t.cache.replay(op.filter) {
+					if err := op.subscriber.WriteObject(o); err != nil {
+						t.logger.Warn("failed to replay cached object", "error", err)
+						break
+					}
+				}
+			}
+			t.subscriberCountChanged()
 			op.resultCh <- id
 		case rem := <-t.removeSubscriberCh:
-			delete(t.subscribers, rem.subscriberID)
+			if _, ok := t.subscribers[rem.subscriberID]; ok {
+				delete(t.subscribers, rem.subscriberID)
+				t.subscriberCountChanged()
+			}
 		case object := <-t.objectCh:
-			for _, v := range t.subscribers {
-				if err := v.WriteObject(object); err != nil {
-					// TODO: Notify / remove subscriber?
-					panic(err)
-				}
+			t.publish(object)
+		case op := <-t.endCh:
+			op.resultCh <- t.end(op.status, op.groupID)
+		case op := <-t.openWriterCh:
+			w, err := t.openObjectWriter(op.header)
+			op.resultCh <- openObjectWriterResult{
+				writer: w,
+				err:    err,
 			}
 		case t.subscriberCountCh <- len(t.subscribers):
+		case t.statusCh <- t.status():
+		case t.statsCh <- t.currentStats():
+		}
+	}
+}
+
+// publish sends object to all subscribers. It must only be called from the
+// loop.
+func (t *LocalTrack) publish(object Object) {
+	if t.finished {
+		t.logger.Warn("dropping object written after end of track", "group-id", object.GroupID, "object-id", object.ObjectID)
+		return
+	}
+	t.record(object)
+	if t.cache != nil {
+		t.cache.add(object)
+	}
+	for id, v := range t.subscribers {
+		if err := v.WriteObject(object); err != nil {
+			t.removeFailedSubscriber(id, err)
+		}
+	}
+}
+
+// record updates the state of the track with an object written to it. It must
+// only be called from the loop.
+func (t *LocalTrack) record(object Object) {
+	switch object.Status {
+	case ObjectStatusNormal, ObjectStatusObjectDoesNotExist:
+		l := location{group: object.GroupID, object: object.ObjectID}
+		if !t.hasObjects || t.largest.less(l) {
+			t.largest = l
+		}
+		t.hasObjects = true
+		t.last = object
+	case ObjectStatusEndOfTrack:
+		t.finished = true
+	}
+	t.stats.ObjectsWritten++
+}
+
+// openObjectWriter opens the payload writers of all subscribers for the object
+// with the given header. It must only be called from the loop.
+func (t *LocalTrack) openObjectWriter(header Object) (io.WriteCloser, error) {
+	if t.finished {
+		return nil, errTrackFinished
+	}
+	t.record(header)
+	w := &trackObjectWriter{
+		logger:  t.logger.With("group-id", header.GroupID, "object-id", header.ObjectID),
+		writers: []io.WriteCloser{},
+	}
+	for id, v := range t.subscribers {
+		opener, ok := v.(objectStreamOpener)
+		if !ok {
+			t.logger.Warn("subscriber does not support streaming objects", "group-id", header.GroupID, "object-id", header.ObjectID)
+			continue
+		}
+		sw, err := opener.openObjectStream(header)
+		if err != nil {
+			t.removeFailedSubscriber(id, err)
+			continue
+		}
+		if sw != nil {
+			w.writers = append(w.writers, sw)
+		}
+	}
+	return w, nil
+}
+
+// end publishes an object without payload signaling the end of a group or
+// the end of the track. The object uses the forwarding preference and
+// publisher priority of the last object written to the track. It must only be
+// called from the loop.
+func (t *LocalTrack) end(status ObjectStatus, groupID uint64) error {
+	if t.finished {
+		return errTrackFinished
+	}
+	o := Object{
+		GroupID:              0,
+		ObjectID:             0,
+		PublisherPriority:    t.last.PublisherPriority,
+		ForwardingPreference: t.last.ForwardingPreference,
+		Status:               status,
+		Payload:              nil,
+	}
+	if !t.hasObjects {
+		o.ForwardingPreference = ObjectForwardingPreferenceStream
+	}
+	switch status {
+	case ObjectStatusEndOfGroup:
+		if t.hasObjects && groupID < t.largest.group {
+			return errGroupNotLatest
+		}
+		o.GroupID = groupID
+		if t.hasObjects && groupID == t.largest.group {
+			o.ObjectID = t.largest.object + 1
+		}
+	case ObjectStatusEndOfTrack:
+		if t.hasObjects {
+			o.GroupID = t.largest.group + 1
+		}
+	}
+	t.publish(o)
+	return nil
+}
+
+func (t *LocalTrack) status() TrackStatus {
+	if t.finished {
+		return TrackStatus{
+			StatusCode:     TrackStatusFinished,
+			LatestGroupID:  t.largest.group,
+			LatestObjectID: t.largest.object,
+		}
+	}
+	if !t.hasObjects {
+		return TrackStatus{
+			StatusCode:     TrackStatusNotYetBegun,
+			LatestGroupID:  0,
+			LatestObjectID: 0,
 		}
 	}
+	return TrackStatus{
+		StatusCode:     TrackStatusInProgress,
+		LatestGroupID:  t.largest.group,
+		LatestObjectID: t.largest.object,
+	}
+}
+
+// removeFailedSubscriber removes a subscriber which failed to accept an
+// object. It must only be called from the loop.
+func (t *LocalTrack) removeFailedSubscriber(id subscriberID, err error) {
+	v := t.subscribers[id]
+	delete(t.subscribers, id)
+	t.subscriberCountChanged()
+	if errors.Is(err, errUnsubscribed) {
+		// The subscription is already being ended by the session.
+		return
+	}
+	t.stats.SubscriberErrors++
+	t.logger.Warn("removing failed subscriber", "error", err)
+	if err := v.Close(); err != nil {
+		t.logger.Warn("failed to close subscriber", "error", err)
+	}
+	t.subscriberFailed(err)
+}
+
+func (t *LocalTrack) currentStats() LocalTrackStats {
+	stats := t.stats
+	stats.Subscribers = len(t.subscribers)
+	return stats
+}
+
+func (t *LocalTrack) subscriberFailed(err error) {
+	if t.onSubscriberError != nil {
+		t.onSubscriberError(err)
+	}
+}
+
+func (t *LocalTrack) subscriberCountChanged() {
+	if t.onSubscriberCount != nil {
+		t.onSubscriberCount(len(t.subscribers))
+	}
 }
 
 func (t *LocalTrack) subscribe(
 	subscriber ObjectWriter,
+	filter FilterType,
 ) (subscriberID, error) {
 	if subscriber == nil {
 		return 0, errors.New("nil subscriber")
 	}
 	addOp := addSubscriberOp{
 		subscriber: subscriber,
+		filter:     filter,
 		resultCh:   make(chan subscriberID),
 	}
 	// TODO: Should this have a timeout or similar?
-	t.addSubscriberCh <- addOp
+	select {
+	case t.addSubscriberCh <- addOp:
+	case <-t.ctx.Done():
+		return 0, errTrackClosed
+	}
 	res := <-addOp.resultCh
 	return res, nil
 }
@@ -156,10 +519,14 @@ func (t *LocalTrack) unsubscribe(id subscriberID) {
 	removeOp := removeSubscriberOp{
 		subscriberID: id,
 	}
-	t.removeSubscriberCh <- removeOp
+	select {
+	case t.removeSubscriberCh <- removeOp:
+	case <-t.ctx.Done():
+	}
 }
 
-// WriteObject adds an object to the track
+// WriteObject adds an object to the track. Objects written after the end of
+// the track are dropped.
 func (t *LocalTrack) WriteObject(ctx context.Context, o Object) error {
 	select {
 	case <-ctx.Done():
@@ -169,6 +536,67 @@ func (t *LocalTrack) WriteObject(ctx context.Context, o Object) error {
 	return nil
 }
 
+// OpenObjectWriter starts a new object and returns a writer of its payload.
+// Each subscriber receives the object on a separate stream as soon as the
+// payload is written, which avoids holding large objects in memory. The object
+// is complete when the writer is closed. Objects written with OpenObjectWriter
+// are not cached. Subscribers failing to receive the payload are dropped from
+// the object without failing writes.
+func (t *LocalTrack) OpenObjectWriter(ctx context.Context, groupID, objectID uint64, publisherPriority uint8) (io.WriteCloser, error) {
+	op := openObjectWriterOp{
+		header: Object{
+			GroupID:              groupID,
+			ObjectID:             objectID,
+			PublisherPriority:    publisherPriority,
+			ForwardingPreference: ObjectForwardingPreferenceStream,
+			Status:               ObjectStatusNormal,
+			Payload:              nil,
+		},
+		resultCh: make(chan openObjectWriterResult, 1),
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-t.ctx.Done():
+		return nil, errTrackClosed
+	case t.openWriterCh <- op:
+	}
+	res := <-op.resultCh
+	return res.writer, res.err
+}
+
+// EndGroup writes an object with ObjectStatusEndOfGroup to signal that the
+// group with groupID is complete. Its object ID is one larger than the largest
+// object ID written in the group. groupID must not be older than the latest
+// group written to the track.
+func (t *LocalTrack) EndGroup(ctx context.Context, groupID uint64) error {
+	return t.writeEnd(ctx, ObjectStatusEndOfGroup, groupID)
+}
+
+// EndTrack writes an object with ObjectStatusEndOfTrack in the group after the
+// latest group written to the track. Afterwards, the status of the track is
+// TrackStatusFinished and subscriptions to the track end with
+// SubscribeStatusTrackEnded once they delivered the object.
+func (t *LocalTrack) EndTrack(ctx context.Context) error {
+	return t.writeEnd(ctx, ObjectStatusEndOfTrack, 0)
+}
+
+func (t *LocalTrack) writeEnd(ctx context.Context, status ObjectStatus, groupID uint64) error {
+	op := endOp{
+		status:   status,
+		groupID:  groupID,
+		resultCh: make(chan error, 1),
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.ctx.Done():
+		return errTrackClosed
+	case t.endCh <- op:
+	}
+	return <-op.resultCh
+}
+
 func (t *LocalTrack) Close() error {
 	t.cancelCtx()
 	t.cancelWG.Wait()
@@ -176,5 +604,72 @@ func (t *LocalTrack) Close() error {
 }
 
 func (t *LocalTrack) SubscriberCount() int {
-	return <-t.subscriberCountCh
+	select {
+	case n := <-t.subscriberCountCh:
+		return n
+	case <-t.ctx.Done():
+		return 0
+	}
+}
+
+// Stats returns the current counters of the track. After the track was
+// closed, it returns the counters at the time it was closed without
+// subscribers.
+func (t *LocalTrack) Stats() LocalTrackStats {
+	select {
+	case stats := <-t.statsCh:
+		return stats
+	case <-t.ctx.Done():
+		t.cancelWG.Wait()
+		return t.closedStats
+	}
+}
+
+// Status returns the current status of the track including the largest group
+// and object ID written to the track so far.
+func (t *LocalTrack) Status() TrackStatus {
+	select {
+	case status := <-t.statusCh:
+		return status
+	case <-t.ctx.Done():
+		return TrackStatus{
+			StatusCode:     TrackStatusDoesNotExist,
+			LatestGroupID:  0,
+			LatestObjectID: 0,
+		}
+	}
+}
+
+// trackObjectWriter writes the payload of an object to the payload writers of
+// all subscribers of a track.
+type trackObjectWriter struct {
+	logger  *slog.Logger
+	writers []io.WriteCloser
+}
+
+func (w *trackObjectWriter) Write(p []byte) (int, error) {
+	for i, sw := range w.writers {
+		if sw == nil {
+			continue
+		}
+		if _, err := sw.Write(p); err != nil {
+			w.logger.Warn("dropping subscriber from object", "error", err)
+			_ = sw.Close()
+			w.writers[i] = nil
+		}
+	}
+	return len(p), nil
+}
+
+func (w *trackObjectWriter) Close() error {
+	for i, sw := range w.writers {
+		if sw == nil {
+			continue
+		}
+		if err := sw.Close(); err != nil {
+			w.logger.Warn("failed to close object", "error", err)
+		}
+		w.writers[i] = nil
+	}
+	return nil
 }
@@ -0,0 +1,103 @@
+package moqtransport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type objectRecorder struct {
+	objects []Object
+}
+
+func (r *objectRecorder) WriteObject(o Object) error {
+	r.objects = append(r.objects, o)
+	return nil
+}
+
+func (r *objectRecorder) Close() error {
+	return nil
+}
+
+func TestLocalTrack(t *testing.T) {
+	t.Run("end_group_and_track", func(t *testing.T) {
+		ctx := context.Background()
+		track := NewLocalTrack("namespace", "track")
+		r := &objectRecorder{}
+		_, err := track.subscribe(r, FilterTypeLatestObject)
+		assert.NoError(t, err)
+		object := Object{
+			GroupID:              3,
+			ObjectID:             4,
+			PublisherPriority:    5,
+			ForwardingPreference: ObjectForwardingPreferenceStreamGroup,
+			Status:               ObjectStatusNormal,
+			Payload:              []byte("hello"),
+		}
+		assert.NoError(t, track.WriteObject(ctx, object))
+		assert.ErrorIs(t, track.EndGroup(ctx, 2), errGroupNotLatest)
+		assert.NoError(t, track.EndGroup(ctx, 3))
+		assert.NoError(t, track.EndTrack(ctx))
+		assert.ErrorIs(t, track.EndTrack(ctx), errTrackFinished)
+		assert.Equal(t, TrackStatus{
+			StatusCode:     TrackStatusFinished,
+			LatestGroupID:  3,
+			LatestObjectID: 4,
+		}, track.Status())
+		assert.NoError(t, track.Close())
+		assert.Equal(t, []Object{
+			object,
+			{
+				GroupID:              3,
+				ObjectID:             5,
+				PublisherPriority:    5,
+				ForwardingPreference: ObjectForwardingPreferenceStreamGroup,
+				Status:               ObjectStatusEndOfGroup,
+				Payload:              nil,
+			},
+			{
+				GroupID:              4,
+				ObjectID:             0,
+				PublisherPriority:    5,
+				ForwardingPreference: ObjectForwardingPreferenceStreamGroup,
+				Status:               ObjectStatusEndOfTrack,
+				Payload:              nil,
+			},
+		}, r.objects)
+	})
+	t.Run("latest_object_starts_at_current_object", func(t *testing.T) {
+		ctx := context.Background()
+		track := NewLocalTrack("namespace", "track", WithCache(CacheConfig{MaxGroups: 1}))
+		for i := uint64(0); i < 2; i++ {
+			assert.NoError(t, track.WriteObject(ctx, Object{GroupID: 0, ObjectID: i}))
+		}
+		r := &objectRecorder{}
+		_, err := track.subscribe(r, FilterTypeLatestObject)
+		assert.NoError(t, err)
+		assert.NoError(t, track.WriteObject(ctx, Object{GroupID: 0, ObjectID: 2}))
+		assert.NoError(t, track.Close())
+		assert.Equal(t, []Object{
+			{GroupID: 0, ObjectID: 1},
+			{GroupID: 0, ObjectID: 2},
+		}, r.objects)
+	})
+	t.Run("drop_objects_after_end_of_track", func(t *testing.T) {
+		ctx := context.Background()
+		track := NewLocalTrack("namespace", "track")
+		r := &objectRecorder{}
+		_, err := track.subscribe(r, FilterTypeLatestObject)
+		assert.NoError(t, err)
+		assert.NoError(t, track.EndTrack(ctx))
+		assert.NoError(t, track.WriteObject(ctx, Object{GroupID: 1}))
+		assert.NoError(t, track.Close())
+		assert.Equal(t, []Object{{
+			GroupID:              0,
+			ObjectID:             0,
+			PublisherPriority:    0,
+			ForwardingPreference: ObjectForwardingPreferenceStream,
+			Status:               ObjectStatusEndOfTrack,
+			Payload:              nil,
+		}}, r.objects)
+	})
+}
@@ -18,3 +18,9 @@ var defaultLogger *slog.Logger
 func SetLogHandler(handler slog.Handler) {
 	defaultLogger = slog.New(handler)
 }
+
+// Logger returns the logger set using SetLogHandler. Packages building on
+// moqtransport use it, so that all components log to the same handler.
+func Logger() *slog.Logger {
+	return defaultLogger
+}
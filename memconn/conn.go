@@ -0,0 +1,333 @@
+// Package memconn implements moqtransport.Connection in memory. Pipe returns
+// two linked connections which allow running a client and a server session in
+// the same process, e.g. in tests or to publish tracks from within an
+// application.
+package memconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// DefaultAcceptQueueSize is the number of streams and datagrams a connection
+// queues until they are accepted or received, unless configured otherwise in
+// Options.
+const DefaultAcceptQueueSize = 128
+
+var errTooManyStreams = errors.New("too many streams not yet accepted by the peer")
+
+// ApplicationError is the error of a connection after it was closed using
+// CloseWithError. Remote is true on the connection of the peer.
+type ApplicationError struct {
+	Remote  bool
+	Code    uint64
+	Message string
+}
+
+func (e *ApplicationError) Error() string {
+	if e.Remote {
+		return fmt.Sprintf("connection closed by peer with code %v: %v", e.Code, e.Message)
+	}
+	return fmt.Sprintf("connection closed with code %v: %v", e.Code, e.Message)
+}
+
+// Options configure a pair of connections created by Pipe.
+type Options struct {
+	// Latency delays data written to streams and datagrams sent in either
+	// direction, as well as the peer noticing that a connection was closed.
+	Latency time.Duration
+
+	// DatagramLossRate is the probability in [0, 1] that a datagram is lost.
+	// Streams are reliable and never lose data.
+	DatagramLossRate float64
+
+	// Seed seeds the random decisions which datagrams are lost, so that runs
+	// with the same seed lose the same datagrams.
+	Seed int64
+
+	// AcceptQueueSize is the number of streams and datagrams each connection
+	// queues until they are accepted or received. If zero,
+	// DefaultAcceptQueueSize is used. Opening streams fails and datagrams are
+	// dropped while the queue of the peer is full.
+	AcceptQueueSize int
+}
+
+type stream struct {
+	*pipe
+	send *pipe
+}
+
+func (s *stream) Write(b []byte) (int, error) {
+	return s.send.Write(b)
+}
+
+func (s *stream) Close() error {
+	return s.send.Close()
+}
+
+func (s *stream) CancelWrite(code uint64) {
+	s.send.CancelWrite(code)
+}
+
+// sendStream is the sending end of a unidirectional stream.
+type sendStream struct {
+	pipe *pipe
+}
+
+func (s *sendStream) Write(b []byte) (int, error) {
+	return s.pipe.Write(b)
+}
+
+func (s *sendStream) Close() error {
+	return s.pipe.Close()
+}
+
+func (s *sendStream) CancelWrite(code uint64) {
+	s.pipe.CancelWrite(code)
+}
+
+var (
+	_ moqtransport.Connection           = (*conn)(nil)
+	_ moqtransport.ResettableSendStream = (*sendStream)(nil)
+	_ moqtransport.ResettableSendStream = (*stream)(nil)
+)
+
+type conn struct {
+	options *Options
+	peer    *conn
+
+	streams    chan *stream
+	uniStreams chan *pipe
+	datagrams  chan []byte
+
+	lock   sync.Mutex
+	random *rand.Rand
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+// Pipe creates two linked connections. Streams opened and datagrams sent on
+// one connection are accepted and received on the other one. opts may be nil.
+func Pipe(opts *Options) (moqtransport.Connection, moqtransport.Connection) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	o := *opts
+	if o.AcceptQueueSize <= 0 {
+		o.AcceptQueueSize = DefaultAcceptQueueSize
+	}
+	a := newConn(&o, o.Seed)
+	// Use a different seed for the other direction, so that both directions
+	// do not lose the same datagrams.
+	b := newConn(&o, o.Seed+1)
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+func newConn(opts *Options, seed int64) *conn {
+	return &conn{
+		options:    opts,
+		peer:       nil,
+		streams:    make(chan *stream, opts.AcceptQueueSize),
+		uniStreams: make(chan *pipe, opts.AcceptQueueSize),
+		datagrams:  make(chan []byte, opts.AcceptQueueSize),
+		lock:       sync.Mutex{},
+		random:     rand.New(rand.NewSource(seed)),
+		closeOnce:  sync.Once{},
+		closed:     make(chan struct{}),
+		err:        nil,
+	}
+}
+
+func (c *conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) OpenStream() (moqtransport.Stream, error) {
+	return c.openStream(nil)
+}
+
+func (c *conn) OpenStreamSync(ctx context.Context) (moqtransport.Stream, error) {
+	return c.openStream(ctx.Done())
+}
+
+// openStream opens a bidirectional stream. If wait is nil, it fails if the
+// accept queue of the peer is full. Otherwise, it waits until there is space
+// or wait is closed.
+func (c *conn) openStream(wait <-chan struct{}) (moqtransport.Stream, error) {
+	if c.isClosed() {
+		return nil, c.err
+	}
+	out := newPipe(c, c.peer)
+	in := newPipe(c.peer, c)
+	remote := &stream{pipe: out, send: in}
+	if err := enqueue(c.peer.streams, remote, wait, c.closed); err != nil {
+		return nil, c.openError(err)
+	}
+	return &stream{pipe: in, send: out}, nil
+}
+
+func (c *conn) OpenUniStream() (moqtransport.SendStream, error) {
+	return c.openUniStream(nil)
+}
+
+func (c *conn) OpenUniStreamSync(ctx context.Context) (moqtransport.SendStream, error) {
+	return c.openUniStream(ctx.Done())
+}
+
+func (c *conn) openUniStream(wait <-chan struct{}) (moqtransport.SendStream, error) {
+	if c.isClosed() {
+		return nil, c.err
+	}
+	p := newPipe(c, c.peer)
+	if err := enqueue(c.peer.uniStreams, p, wait, c.closed); err != nil {
+		return nil, c.openError(err)
+	}
+	return &sendStream{pipe: p}, nil
+}
+
+func (c *conn) openError(err error) error {
+	if c.isClosed() {
+		return c.err
+	}
+	return err
+}
+
+// enqueue adds v to queue. If wait is nil, it returns errTooManyStreams if
+// queue is full. Otherwise, it waits until there is space in queue or wait or
+// closed is closed.
+func enqueue[T any](queue chan T, v T, wait, closed <-chan struct{}) error {
+	if wait == nil {
+		select {
+		case queue <- v:
+			return nil
+		default:
+			return errTooManyStreams
+		}
+	}
+	select {
+	case queue <- v:
+		return nil
+	case <-wait:
+		return context.Canceled
+	case <-closed:
+		return errTooManyStreams
+	}
+}
+
+func (c *conn) AcceptStream(ctx context.Context) (moqtransport.Stream, error) {
+	select {
+	case s := <-c.streams:
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+func (c *conn) AcceptUniStream(ctx context.Context) (moqtransport.ReceiveStream, error) {
+	select {
+	case p := <-c.uniStreams:
+		return p, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+// lose decides whether the next datagram is lost.
+func (c *conn) lose() bool {
+	if c.options.DatagramLossRate <= 0 {
+		return false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.random.Float64() < c.options.DatagramLossRate
+}
+
+func (c *conn) SendDatagram(b []byte) error {
+	if c.isClosed() {
+		return c.err
+	}
+	if c.lose() {
+		return nil
+	}
+	d := append([]byte{}, b...)
+	if c.options.Latency <= 0 {
+		c.peer.deliverDatagram(d)
+		return nil
+	}
+	time.AfterFunc(c.options.Latency, func() {
+		c.peer.deliverDatagram(d)
+	})
+	return nil
+}
+
+// deliverDatagram queues a datagram received from the peer. Datagrams are
+// dropped if the queue is full or the connection is closed.
+func (c *conn) deliverDatagram(d []byte) {
+	if c.isClosed() {
+		return
+	}
+	select {
+	case c.datagrams <- d:
+	default:
+	}
+}
+
+func (c *conn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case d := <-c.datagrams:
+		return d, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+// CloseWithError closes the connection and, after the latency, the connection
+// of the peer. Subsequent calls have no effect.
+func (c *conn) CloseWithError(code uint64, msg string) error {
+	c.close(&ApplicationError{
+		Remote:  false,
+		Code:    code,
+		Message: msg,
+	})
+	remote := &ApplicationError{
+		Remote:  true,
+		Code:    code,
+		Message: msg,
+	}
+	if c.options.Latency <= 0 {
+		c.peer.close(remote)
+		return nil
+	}
+	time.AfterFunc(c.options.Latency, func() {
+		c.peer.close(remote)
+	})
+	return nil
+}
+
+func (c *conn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.closed)
+	})
+}
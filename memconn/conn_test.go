@@ -0,0 +1,127 @@
+package memconn
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipe(t *testing.T) {
+	t.Run("bidirectional_stream", func(t *testing.T) {
+		a, b := Pipe(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		sa, err := a.OpenStream()
+		assert.NoError(t, err)
+		_, err = sa.Write([]byte("ping"))
+		assert.NoError(t, err)
+		assert.NoError(t, sa.Close())
+
+		sb, err := b.AcceptStream(ctx)
+		assert.NoError(t, err)
+		buf, err := io.ReadAll(sb)
+		assert.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+
+		_, err = sb.Write([]byte("pong"))
+		assert.NoError(t, err)
+		assert.NoError(t, sb.Close())
+		buf, err = io.ReadAll(sa)
+		assert.NoError(t, err)
+		assert.Equal(t, "pong", string(buf))
+
+		_, err = sa.Write([]byte("late"))
+		assert.ErrorIs(t, err, errWriteAfterClose)
+	})
+	t.Run("unidirectional_stream_latency", func(t *testing.T) {
+		latency := 50 * time.Millisecond
+		a, b := Pipe(&Options{Latency: latency})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s, err := a.OpenUniStreamSync(ctx)
+		assert.NoError(t, err)
+		start := time.Now()
+		_, err = s.Write([]byte("hello"))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Close())
+
+		r, err := b.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		buf, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+		assert.GreaterOrEqual(t, time.Since(start), latency)
+	})
+	t.Run("reset_stream", func(t *testing.T) {
+		a, b := Pipe(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s, err := a.OpenUniStream()
+		assert.NoError(t, err)
+		_, err = s.Write([]byte("discarded"))
+		assert.NoError(t, err)
+		s.(*sendStream).CancelWrite(7)
+
+		r, err := b.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		_, err = r.Read(make([]byte, 16))
+		assert.Equal(t, &StreamError{Code: 7}, err)
+	})
+	t.Run("datagrams", func(t *testing.T) {
+		a, b := Pipe(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		d := []byte("datagram")
+		assert.NoError(t, a.SendDatagram(d))
+		d[0] = 'D'
+		got, err := b.ReceiveDatagram(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "datagram", string(got))
+	})
+	t.Run("datagram_loss_is_deterministic", func(t *testing.T) {
+		received := func() []byte {
+			a, b := Pipe(&Options{DatagramLossRate: 0.5, Seed: 42})
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, a.SendDatagram([]byte{byte(i)}))
+			}
+			res := []byte{}
+			for {
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				d, err := b.ReceiveDatagram(ctx)
+				cancel()
+				if err != nil {
+					return res
+				}
+				res = append(res, d...)
+			}
+		}
+		first := received()
+		assert.Greater(t, len(first), 0)
+		assert.Less(t, len(first), 100)
+		assert.Equal(t, first, received())
+	})
+	t.Run("close_propagates", func(t *testing.T) {
+		a, b := Pipe(&Options{Latency: 10 * time.Millisecond})
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s, err := a.OpenStream()
+		assert.NoError(t, err)
+		readErr := make(chan error, 1)
+		go func() {
+			_, err := s.Read(make([]byte, 1))
+			readErr <- err
+		}()
+
+		assert.NoError(t, b.CloseWithError(3, "bye"))
+		_, err = b.AcceptUniStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: false, Code: 3, Message: "bye"}, err)
+		_, err = a.AcceptUniStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: true, Code: 3, Message: "bye"}, err)
+		assert.Equal(t, &ApplicationError{Remote: true, Code: 3, Message: "bye"}, <-readErr)
+		_, err = a.OpenUniStream()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,164 @@
+package memconn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+var errWriteAfterClose = errors.New("write on closed stream")
+
+// StreamError is returned by reads of a stream that was reset by the peer.
+type StreamError struct {
+	Code uint64
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream reset with code %v", e.Code)
+}
+
+type chunk struct {
+	data []byte
+	at   time.Time
+}
+
+// A pipe carries the data of one direction of a stream from the writer to the
+// reader connection. Data written to the pipe becomes readable after the
+// latency of the connection. Pipes are not flow controlled, writes never block.
+// Reads and writes fail once the connection of the reader or writer is closed.
+type pipe struct {
+	reader, writer *conn
+
+	lock    sync.Mutex
+	latency time.Duration
+	chunks  []chunk
+
+	// end is set when the writer closed or reset the stream. endErr is nil
+	// if the stream was closed and a StreamError if it was reset. Readers see
+	// the end after all chunks once endAt passed.
+	end    bool
+	endAt  time.Time
+	endErr error
+
+	// readable is signaled when the state of the pipe changed.
+	readable chan struct{}
+}
+
+func newPipe(writer, reader *conn) *pipe {
+	return &pipe{
+		reader:   reader,
+		writer:   writer,
+		lock:     sync.Mutex{},
+		latency:  writer.options.Latency,
+		chunks:   []chunk{},
+		end:      false,
+		endAt:    time.Time{},
+		endErr:   nil,
+		readable: make(chan struct{}, 1),
+	}
+}
+
+func (p *pipe) signal() {
+	select {
+	case p.readable <- struct{}{}:
+	default:
+	}
+}
+
+func (p *pipe) Read(b []byte) (int, error) {
+	for {
+		if p.reader.isClosed() {
+			return 0, p.reader.err
+		}
+		p.lock.Lock()
+		now := time.Now()
+		var wait <-chan time.Time
+		switch {
+		case len(p.chunks) > 0:
+			c := &p.chunks[0]
+			if !c.at.After(now) {
+				n := copy(b, c.data)
+				c.data = c.data[n:]
+				if len(c.data) == 0 {
+					p.chunks[0] = chunk{}
+					p.chunks = p.chunks[1:]
+				}
+				p.lock.Unlock()
+				return n, nil
+			}
+			wait = time.After(c.at.Sub(now))
+		case p.end:
+			if !p.endAt.After(now) {
+				err := p.endErr
+				p.lock.Unlock()
+				if err == nil {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			wait = time.After(p.endAt.Sub(now))
+		}
+		p.lock.Unlock()
+		select {
+		case <-p.readable:
+		case <-wait:
+		case <-p.reader.closed:
+		}
+	}
+}
+
+func (p *pipe) Write(b []byte) (int, error) {
+	if p.writer.isClosed() {
+		return 0, p.writer.err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.end {
+		return 0, errWriteAfterClose
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	p.chunks = append(p.chunks, chunk{
+		data: append([]byte{}, b...),
+		at:   time.Now().Add(p.latency),
+	})
+	p.signal()
+	return len(b), nil
+}
+
+// Close ends the stream after all written data.
+func (p *pipe) Close() error {
+	if p.writer.isClosed() {
+		return p.writer.err
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.end {
+		return nil
+	}
+	p.end = true
+	p.endAt = time.Now().Add(p.latency)
+	p.signal()
+	return nil
+}
+
+// CancelWrite resets the stream. Data that was not read yet is discarded and
+// the reader receives a StreamError with code.
+func (p *pipe) CancelWrite(code uint64) {
+	if p.writer.isClosed() {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.end && p.endErr != nil {
+		return
+	}
+	p.chunks = []chunk{}
+	p.end = true
+	p.endAt = time.Now().Add(p.latency)
+	p.endErr = &StreamError{Code: code}
+	p.signal()
+}
@@ -0,0 +1,134 @@
+package moqmetrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type metricType string
+
+const (
+	typeCounter metricType = "counter"
+	typeGauge   metricType = "gauge"
+	typeSummary metricType = "summary"
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+// A sample is a single line of a metric family. suffix is appended to the name
+// of the family, e.g. "_sum" or "_count" for summaries.
+type sample struct {
+	suffix string
+	labels []label
+	value  float64
+}
+
+// A family is a named metric with all its samples.
+type family struct {
+	name    string
+	help    string
+	typ     metricType
+	samples []sample
+}
+
+// add adds v to the sample with the given suffix and labels. Samples with the
+// same labels are aggregated, so that the counters of several sessions sum up.
+func (f *family) add(suffix string, v float64, labels ...label) {
+	for i, s := range f.samples {
+		if s.suffix == suffix && equalLabels(s.labels, labels) {
+			f.samples[i].value += v
+			return
+		}
+	}
+	f.samples = append(f.samples, sample{
+		suffix: suffix,
+		labels: labels,
+		value:  v,
+	})
+}
+
+func equalLabels(a, b []label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeFamilies writes families in the Prometheus text exposition format.
+// Samples are sorted, so that the output is stable.
+func writeFamilies(w io.Writer, families []*family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		sort.SliceStable(f.samples, func(i, j int) bool {
+			return sampleKey(f.samples[i]) < sampleKey(f.samples[j])
+		})
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range f.samples {
+			bw.WriteString(f.name)
+			bw.WriteString(s.suffix)
+			if len(s.labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l.name, escapeLabelValue(l.value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+func sampleKey(s sample) string {
+	var b strings.Builder
+	b.WriteString(s.suffix)
+	for _, l := range s.labels {
+		b.WriteByte(0)
+		b.WriteString(l.value)
+	}
+	return b.String()
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,183 @@
+package moqmetrics
+
+import (
+	"github.com/mengelbart/moqtransport"
+)
+
+const prefix = "moqtransport_"
+
+// metrics are the metric families collected in one scrape.
+type metrics struct {
+	sessions                   *family
+	subscriptions              *family
+	announcements              *family
+	openStreams                *family
+	controlMessages            *family
+	controlMessageLatency      *family
+	objects                    *family
+	bytes                      *family
+	droppedObjects             *family
+	sendQueueObjects           *family
+	localTrackSubscribers      *family
+	localTrackObjects          *family
+	localTrackSubscriberErrors *family
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		sessions: &family{
+			name: prefix + "sessions",
+			help: "Number of open sessions.",
+			typ:  typeGauge,
+			samples: []sample{{
+				suffix: "",
+				labels: nil,
+				value:  0,
+			}},
+		},
+		subscriptions: &family{
+			name: prefix + "subscriptions",
+			help: "Number of active subscriptions by direction.",
+			typ:  typeGauge,
+		},
+		announcements: &family{
+			name: prefix + "announcements",
+			help: "Number of active announcements by direction.",
+			typ:  typeGauge,
+		},
+		openStreams: &family{
+			name: prefix + "open_streams",
+			help: "Number of open unidirectional streams carrying objects by direction.",
+			typ:  typeGauge,
+		},
+		controlMessages: &family{
+			name: prefix + "control_messages_total",
+			help: "Number of control messages by direction and message type.",
+			typ:  typeCounter,
+		},
+		controlMessageLatency: &family{
+			name: prefix + "control_message_latency_seconds",
+			help: "Time between sending a request and receiving its response by request type.",
+			typ:  typeSummary,
+		},
+		objects: &family{
+			name: prefix + "objects_total",
+			help: "Number of objects by direction, namespace and track.",
+			typ:  typeCounter,
+		},
+		bytes: &family{
+			name: prefix + "object_payload_bytes_total",
+			help: "Number of object payload bytes by direction, namespace and track.",
+			typ:  typeCounter,
+		},
+		droppedObjects: &family{
+			name: prefix + "dropped_objects_total",
+			help: "Number of objects dropped from send queues and receive buffers by direction, namespace and track.",
+			typ:  typeCounter,
+		},
+		sendQueueObjects: &family{
+			name: prefix + "send_queue_objects",
+			help: "Number of objects waiting in send queues by namespace and track.",
+			typ:  typeGauge,
+		},
+		localTrackSubscribers: &family{
+			name: prefix + "local_track_subscribers",
+			help: "Number of subscribers of local tracks by namespace and track.",
+			typ:  typeGauge,
+		},
+		localTrackObjects: &family{
+			name: prefix + "local_track_objects_written_total",
+			help: "Number of objects written to local tracks by namespace and track.",
+			typ:  typeCounter,
+		},
+		localTrackSubscriberErrors: &family{
+			name: prefix + "local_track_subscriber_errors_total",
+			help: "Number of subscribers removed from local tracks because delivering objects failed by namespace and track.",
+			typ:  typeCounter,
+		},
+	}
+}
+
+func (m *metrics) families() []*family {
+	return []*family{
+		m.sessions,
+		m.subscriptions,
+		m.announcements,
+		m.openStreams,
+		m.controlMessages,
+		m.controlMessageLatency,
+		m.objects,
+		m.bytes,
+		m.droppedObjects,
+		m.sendQueueObjects,
+		m.localTrackSubscribers,
+		m.localTrackObjects,
+		m.localTrackSubscriberErrors,
+	}
+}
+
+func direction(d string) label {
+	return label{name: "direction", value: d}
+}
+
+func trackLabels(namespace, trackname string) []label {
+	return []label{
+		{name: "namespace", value: namespace},
+		{name: "track", value: trackname},
+	}
+}
+
+func (m *metrics) collectSession(s *moqtransport.Session) {
+	stats := s.Stats()
+	m.sessions.add("", 1)
+	m.subscriptions.add("", float64(stats.SendSubscriptions), direction("send"))
+	m.subscriptions.add("", float64(stats.ReceiveSubscriptions), direction("receive"))
+	m.announcements.add("", float64(stats.LocalAnnouncements), direction("local"))
+	m.announcements.add("", float64(stats.RemoteAnnouncements), direction("remote"))
+	m.openStreams.add("", float64(stats.OpenSendStreams), direction("send"))
+	m.openStreams.add("", float64(stats.OpenReceiveStreams), direction("receive"))
+	m.collectSessionCounters(stats)
+	for _, sub := range s.SendSubscriptionStats() {
+		m.sendQueueObjects.add("", float64(sub.QueuedObjects), trackLabels(sub.Namespace, sub.TrackName)...)
+	}
+}
+
+// collectSessionCounters collects the counters of stats. It is also used for
+// the totals of sessions that ended.
+func (m *metrics) collectSessionCounters(stats moqtransport.SessionStats) {
+	for t, n := range stats.ControlMessagesSent {
+		m.controlMessages.add("", float64(n), direction("send"), label{name: "type", value: t})
+	}
+	for t, n := range stats.ControlMessagesReceived {
+		m.controlMessages.add("", float64(n), direction("receive"), label{name: "type", value: t})
+	}
+	for t, l := range stats.ControlMessageLatency {
+		request := label{name: "request", value: t}
+		m.controlMessageLatency.add("_sum", l.Sum.Seconds(), request)
+		m.controlMessageLatency.add("_count", float64(l.Count), request)
+	}
+	for _, t := range stats.Tracks {
+		sent := append([]label{direction("send")}, trackLabels(t.Namespace, t.TrackName)...)
+		received := append([]label{direction("receive")}, trackLabels(t.Namespace, t.TrackName)...)
+		m.objects.add("", float64(t.ObjectsSent), sent...)
+		m.objects.add("", float64(t.ObjectsReceived), received...)
+		m.bytes.add("", float64(t.BytesSent), sent...)
+		m.bytes.add("", float64(t.BytesReceived), received...)
+		m.droppedObjects.add("", float64(t.SendDroppedObjects), sent...)
+		m.droppedObjects.add("", float64(t.ReceiveDroppedObjects), received...)
+	}
+}
+
+func (m *metrics) collectLocalTrack(t *moqtransport.LocalTrack) {
+	stats := t.Stats()
+	m.localTrackSubscribers.add("", float64(stats.Subscribers), trackLabels(t.Namespace, t.Name)...)
+	m.collectLocalTrackCounters(t.Namespace, t.Name, stats)
+}
+
+// collectLocalTrackCounters collects the counters of stats. It is also used
+// for the totals of unregistered tracks.
+func (m *metrics) collectLocalTrackCounters(namespace, trackname string, stats moqtransport.LocalTrackStats) {
+	labels := trackLabels(namespace, trackname)
+	m.localTrackObjects.add("", float64(stats.ObjectsWritten), labels...)
+	m.localTrackSubscriberErrors.add("", float64(stats.SubscriberErrors), labels...)
+}
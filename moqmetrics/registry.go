@@ -0,0 +1,133 @@
+// Package moqmetrics exports the statistics of moqtransport sessions and local
+// tracks in the Prometheus text exposition format, so that they can be scraped
+// by Prometheus or any compatible monitoring system.
+package moqmetrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var _ http.Handler = (*Registry)(nil)
+
+// A Registry collects the metrics of registered sessions and local tracks.
+// Counters of all sessions are summed up by their labels. Sessions are removed
+// from the registry when they end, but their counters are kept, so counters
+// never decrease. The same applies to local tracks which are unregistered.
+// Gauges only include running sessions and registered tracks. All methods are
+// safe for concurrent use.
+type Registry struct {
+	lock     sync.Mutex
+	sessions map[*moqtransport.Session]struct{}
+	tracks   map[*moqtransport.LocalTrack]struct{}
+	totals   *totals
+}
+
+// NewRegistry creates a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		lock:     sync.Mutex{},
+		sessions: map[*moqtransport.Session]struct{}{},
+		tracks:   map[*moqtransport.LocalTrack]struct{}{},
+		totals:   newTotals(),
+	}
+}
+
+// RegisterSession adds the metrics of s to the registry. s must have been
+// started using RunClient or RunServer.
+func (r *Registry) RegisterSession(s *moqtransport.Session) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.sessions[s] = struct{}{}
+}
+
+// UnregisterSession removes the metrics of s from the registry. The counters
+// of s remain in the totals of the registry.
+func (r *Registry) UnregisterSession(s *moqtransport.Session) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.sessions[s]; !ok {
+		return
+	}
+	delete(r.sessions, s)
+	r.totals.addSession(s.Stats())
+}
+
+// RegisterLocalTrack adds the metrics of t to the registry. Tracks must be
+// unregistered using UnregisterLocalTrack when they are closed.
+func (r *Registry) RegisterLocalTrack(t *moqtransport.LocalTrack) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.tracks[t] = struct{}{}
+}
+
+// UnregisterLocalTrack removes the metrics of t from the registry. The
+// counters of t remain in the totals of the registry.
+func (r *Registry) UnregisterLocalTrack(t *moqtransport.LocalTrack) {
+	// Stats waits for the track, so don't hold the lock while getting them.
+	stats := t.Stats()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.tracks[t]; !ok {
+		return
+	}
+	delete(r.tracks, t)
+	r.totals.addLocalTrack(t.Namespace, t.Name, stats)
+}
+
+// snapshot returns the registered sessions and tracks and collects the totals
+// into m. Sessions which ended are removed and added to the totals.
+func (r *Registry) snapshot(m *metrics) ([]*moqtransport.Session, []*moqtransport.LocalTrack) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sessions := make([]*moqtransport.Session, 0, len(r.sessions))
+	for s := range r.sessions {
+		select {
+		case <-s.Done():
+			delete(r.sessions, s)
+			r.totals.addSession(s.Stats())
+			continue
+		default:
+		}
+		sessions = append(sessions, s)
+	}
+	tracks := make([]*moqtransport.LocalTrack, 0, len(r.tracks))
+	for t := range r.tracks {
+		tracks = append(tracks, t)
+	}
+	r.totals.collect(m)
+	return sessions, tracks
+}
+
+// WriteTo writes the current metrics of all registered sessions and tracks to
+// w in the Prometheus text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	m := newMetrics()
+	sessions, tracks := r.snapshot(m)
+	for _, s := range sessions {
+		m.collectSession(s)
+	}
+	for _, t := range tracks {
+		m.collectLocalTrack(t)
+	}
+	var buf bytes.Buffer
+	if err := writeFamilies(&buf, m.families()); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP serves the current metrics, so that a Registry can be used as the
+// handler of a metrics endpoint.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	// Errors writing the response mean the scraper went away, there is
+	// nobody left to report them to.
+	_, _ = r.WriteTo(w)
+}
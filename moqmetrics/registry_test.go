@@ -0,0 +1,121 @@
+package moqmetrics
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/memconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFamilies(t *testing.T) {
+	f := &family{
+		name: "test_total",
+		help: "A help text\nwith a \\ backslash.",
+		typ:  typeCounter,
+	}
+	f.add("", 1, label{name: "track", value: "b"})
+	f.add("", 2, label{name: "track", value: "a\"\n"})
+	f.add("", 3, label{name: "track", value: "b"})
+	var buf bytes.Buffer
+	assert.NoError(t, writeFamilies(&buf, []*family{f}))
+	assert.Equal(t, `# HELP test_total A help text\nwith a \\ backslash.
+# TYPE test_total counter
+test_total{track="a\"\n"} 2
+test_total{track="b"} 4
+`, buf.String())
+}
+
+func TestRegistry(t *testing.T) {
+	t.Run("local_track", func(t *testing.T) {
+		lt := moqtransport.NewLocalTrack("namespace", "track")
+		defer lt.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for i := uint64(0); i < 3; i++ {
+			assert.NoError(t, lt.WriteObject(ctx, moqtransport.Object{
+				GroupID:  0,
+				ObjectID: i,
+				Payload:  []byte("payload"),
+			}))
+		}
+		r := NewRegistry()
+		r.RegisterLocalTrack(lt)
+
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+		body := rec.Body.String()
+		assert.Contains(t, body, "moqtransport_sessions 0\n")
+		assert.Contains(t, body, `moqtransport_local_track_objects_written_total{namespace="namespace",track="track"} 3`+"\n")
+		assert.Contains(t, body, `moqtransport_local_track_subscribers{namespace="namespace",track="track"} 0`+"\n")
+
+		r.UnregisterLocalTrack(lt)
+		var buf bytes.Buffer
+		_, err := r.WriteTo(&buf)
+		assert.NoError(t, err)
+		body = buf.String()
+		assert.Contains(t, body, `moqtransport_local_track_objects_written_total{namespace="namespace",track="track"} 3`+"\n")
+		assert.False(t, strings.Contains(body, `moqtransport_local_track_subscribers{namespace="namespace",track="track"}`))
+	})
+	t.Run("ended_session", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		clientConn, serverConn := memconn.Pipe(nil)
+		lt := moqtransport.NewLocalTrack("namespace", "track")
+		defer lt.Close()
+		server := &moqtransport.Session{
+			Conn: serverConn,
+		}
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- server.RunServer(ctx)
+		}()
+		client := &moqtransport.Session{
+			Conn: clientConn,
+		}
+		assert.NoError(t, client.RunClient())
+		assert.NoError(t, <-errCh)
+		assert.NoError(t, server.AddLocalTrack(lt))
+
+		r := NewRegistry()
+		r.RegisterSession(client)
+		r.RegisterSession(server)
+		remote, err := client.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		assert.NoError(t, lt.WriteObject(ctx, moqtransport.Object{
+			GroupID:              0,
+			ObjectID:             0,
+			ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+			Payload:              []byte("payload"),
+		}))
+		_, err = remote.ReadObject(ctx)
+		assert.NoError(t, err)
+
+		sent := `moqtransport_objects_total{direction="send",namespace="namespace",track="track"} 1` + "\n"
+		received := `moqtransport_objects_total{direction="receive",namespace="namespace",track="track"} 1` + "\n"
+		var buf bytes.Buffer
+		_, err = r.WriteTo(&buf)
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), "moqtransport_sessions 2\n")
+		assert.Contains(t, buf.String(), sent)
+		assert.Contains(t, buf.String(), received)
+
+		remote.Unsubscribe()
+		r.UnregisterSession(client)
+		assert.NoError(t, client.Close())
+		assert.NoError(t, server.Close())
+		<-server.Done()
+		buf.Reset()
+		_, err = r.WriteTo(&buf)
+		assert.NoError(t, err)
+		assert.Contains(t, buf.String(), "moqtransport_sessions 0\n")
+		assert.Contains(t, buf.String(), sent)
+		assert.Contains(t, buf.String(), received)
+	})
+}
@@ -0,0 +1,90 @@
+package moqmetrics
+
+import "github.com/mengelbart/moqtransport"
+
+type trackKey struct {
+	namespace string
+	trackname string
+}
+
+// totals hold the counters of sessions and local tracks that were removed from
+// a Registry, so that the counters exported by the Registry never decrease.
+type totals struct {
+	controlMessagesSent     map[string]uint64
+	controlMessagesReceived map[string]uint64
+	controlMessageLatency   map[string]moqtransport.LatencyStats
+	tracks                  map[trackKey]moqtransport.TrackStats
+	localTracks             map[trackKey]moqtransport.LocalTrackStats
+}
+
+func newTotals() *totals {
+	return &totals{
+		controlMessagesSent:     map[string]uint64{},
+		controlMessagesReceived: map[string]uint64{},
+		controlMessageLatency:   map[string]moqtransport.LatencyStats{},
+		tracks:                  map[trackKey]moqtransport.TrackStats{},
+		localTracks:             map[trackKey]moqtransport.LocalTrackStats{},
+	}
+}
+
+// addSession adds the counters of a session that was removed.
+func (t *totals) addSession(stats moqtransport.SessionStats) {
+	for k, n := range stats.ControlMessagesSent {
+		t.controlMessagesSent[k] += n
+	}
+	for k, n := range stats.ControlMessagesReceived {
+		t.controlMessagesReceived[k] += n
+	}
+	for k, l := range stats.ControlMessageLatency {
+		total := t.controlMessageLatency[k]
+		total.Count += l.Count
+		total.Sum += l.Sum
+		t.controlMessageLatency[k] = total
+	}
+	for _, ts := range stats.Tracks {
+		key := trackKey{namespace: ts.Namespace, trackname: ts.TrackName}
+		total, ok := t.tracks[key]
+		if !ok {
+			total = moqtransport.TrackStats{Namespace: ts.Namespace, TrackName: ts.TrackName}
+		}
+		total.ObjectsSent += ts.ObjectsSent
+		total.BytesSent += ts.BytesSent
+		total.SendDroppedObjects += ts.SendDroppedObjects
+		total.ObjectsReceived += ts.ObjectsReceived
+		total.BytesReceived += ts.BytesReceived
+		total.ReceiveDroppedObjects += ts.ReceiveDroppedObjects
+		t.tracks[key] = total
+	}
+}
+
+// addLocalTrack adds the counters of a local track that was removed.
+func (t *totals) addLocalTrack(namespace, trackname string, stats moqtransport.LocalTrackStats) {
+	key := trackKey{namespace: namespace, trackname: trackname}
+	total := t.localTracks[key]
+	total.ObjectsWritten += stats.ObjectsWritten
+	total.SubscriberErrors += stats.SubscriberErrors
+	t.localTracks[key] = total
+}
+
+// collect adds the totals to the counters of m.
+func (t *totals) collect(m *metrics) {
+	tracks := make([]moqtransport.TrackStats, 0, len(t.tracks))
+	for _, ts := range t.tracks {
+		tracks = append(tracks, ts)
+	}
+	m.collectSessionCounters(moqtransport.SessionStats{
+		SendSubscriptions:       0,
+		ReceiveSubscriptions:    0,
+		LocalAnnouncements:      0,
+		RemoteAnnouncements:     0,
+		ControlMessagesSent:     t.controlMessagesSent,
+		ControlMessagesReceived: t.controlMessagesReceived,
+		ControlMessageLatency:   t.controlMessageLatency,
+		Tracks:                  tracks,
+		OpenSendStreams:         0,
+		OpenReceiveStreams:      0,
+	})
+	for key, stats := range t.localTracks {
+		m.collectLocalTrackCounters(key.namespace, key.trackname, stats)
+	}
+}
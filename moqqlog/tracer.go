@@ -0,0 +1,291 @@
+// Package moqqlog implements a moqtransport.Tracer writing qlog files in the
+// JSON-SEQ format. Event names and fields follow the drafts of the MoQ
+// Transport qlog event schema, so that the files can be inspected with qlog
+// tooling.
+package moqqlog
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+const recordSeparator = 0x1e
+
+// A VantagePoint tells from which side of a session a trace was recorded.
+type VantagePoint string
+
+const (
+	VantagePointClient VantagePoint = "client"
+	VantagePointServer VantagePoint = "server"
+)
+
+var _ moqtransport.Tracer = (*Tracer)(nil)
+
+// eventQueueSize is the number of records a Tracer queues before it drops
+// events.
+const eventQueueSize = 1024
+
+// A Tracer writes the events of a session as qlog records to a writer. All
+// methods are safe for concurrent use. Events are encoded and written by a
+// goroutine, so that a slow writer does not block the session. If the writer
+// falls behind by more than eventQueueSize records, events are dropped and
+// counted by Dropped. Writing stops at the first error, which is returned by
+// Err. Close must be called to write the remaining records and stop the
+// goroutine.
+type Tracer struct {
+	w     io.Writer
+	start time.Time
+
+	records chan any
+	done    chan struct{}
+
+	// lock protects the fields below.
+	lock    sync.Mutex
+	closed  bool
+	dropped uint64
+	err     error
+}
+
+type header struct {
+	QlogVersion string `json:"qlog_version"`
+	QlogFormat  string `json:"qlog_format"`
+	Title       string `json:"title,omitempty"`
+	Trace       trace  `json:"trace"`
+}
+
+type trace struct {
+	CommonFields commonFields `json:"common_fields"`
+	VantagePoint vantagePoint `json:"vantage_point"`
+}
+
+type commonFields struct {
+	TimeFormat    string  `json:"time_format"`
+	ReferenceTime float64 `json:"reference_time"`
+}
+
+type vantagePoint struct {
+	Type VantagePoint `json:"type"`
+}
+
+type event struct {
+	Time float64 `json:"time"`
+	Name string  `json:"name"`
+	Data any     `json:"data"`
+}
+
+// NewTracer creates a Tracer writing to w and writes the qlog header. title is
+// the title of the trace and may be empty.
+func NewTracer(w io.Writer, vp VantagePoint, title string) *Tracer {
+	t := &Tracer{
+		w:       w,
+		start:   time.Now(),
+		records: make(chan any, eventQueueSize),
+		done:    make(chan struct{}),
+		lock:    sync.Mutex{},
+		closed:  false,
+		dropped: 0,
+		err:     nil,
+	}
+	t.enqueue(header{
+		QlogVersion: "0.3",
+		QlogFormat:  "JSON-SEQ",
+		Title:       title,
+		Trace: trace{
+			CommonFields: commonFields{
+				TimeFormat:    "relative",
+				ReferenceTime: float64(t.start.UnixNano()) / float64(time.Millisecond),
+			},
+			VantagePoint: vantagePoint{
+				Type: vp,
+			},
+		},
+	})
+	go t.writeLoop()
+	return t
+}
+
+// Err returns the first error writing a record.
+func (t *Tracer) Err() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.err
+}
+
+// Dropped returns the number of events dropped because the writer fell behind.
+func (t *Tracer) Dropped() uint64 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.dropped
+}
+
+// Close writes the queued records and stops the Tracer. Events traced after
+// Close are dropped. Close does not close the writer. It returns the first
+// error writing a record.
+func (t *Tracer) Close() error {
+	t.lock.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.records)
+	}
+	t.lock.Unlock()
+	<-t.done
+	return t.Err()
+}
+
+func (t *Tracer) writeEvent(name string, data any) {
+	t.enqueue(event{
+		Time: float64(time.Since(t.start)) / float64(time.Millisecond),
+		Name: name,
+		Data: data,
+	})
+}
+
+// enqueue queues v for the write loop without blocking.
+func (t *Tracer) enqueue(v any) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		t.dropped++
+		return
+	}
+	select {
+	case t.records <- v:
+	default:
+		t.dropped++
+	}
+}
+
+func (t *Tracer) writeLoop() {
+	defer close(t.done)
+	for v := range t.records {
+		t.writeRecord(v)
+	}
+}
+
+// writeRecord writes v as a JSON text prefixed by the record separator and
+// followed by a line feed.
+func (t *Tracer) writeRecord(v any) {
+	if t.Err() != nil {
+		return
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		t.setErr(err)
+		return
+	}
+	record := make([]byte, 0, len(buf)+2)
+	record = append(record, recordSeparator)
+	record = append(record, buf...)
+	record = append(record, '\n')
+	if _, err := t.w.Write(record); err != nil {
+		t.setErr(err)
+	}
+}
+
+func (t *Tracer) setErr(err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+func controlMessageData(e moqtransport.ControlMessageEvent) map[string]any {
+	message := make(map[string]any, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		message[k] = v
+	}
+	message["type"] = strings.ToLower(e.Type)
+	return map[string]any{
+		"message": message,
+	}
+}
+
+// ControlMessageSent implements moqtransport.Tracer.
+func (t *Tracer) ControlMessageSent(e moqtransport.ControlMessageEvent) {
+	t.writeEvent("moqt:control_message_created", controlMessageData(e))
+}
+
+// ControlMessageParsed implements moqtransport.Tracer.
+func (t *Tracer) ControlMessageParsed(e moqtransport.ControlMessageEvent) {
+	t.writeEvent("moqt:control_message_parsed", controlMessageData(e))
+}
+
+func forwardingPreference(p moqtransport.ObjectForwardingPreference) string {
+	switch p {
+	case moqtransport.ObjectForwardingPreferenceDatagram:
+		return "datagram"
+	case moqtransport.ObjectForwardingPreferenceStream:
+		return "object_stream"
+	case moqtransport.ObjectForwardingPreferenceStreamGroup:
+		return "stream_header_group"
+	case moqtransport.ObjectForwardingPreferenceStreamTrack:
+		return "stream_header_track"
+	}
+	return "unknown"
+}
+
+func objectData(e moqtransport.ObjectEvent) map[string]any {
+	data := map[string]any{
+		"subscribe_id":          e.SubscribeID,
+		"track_alias":           e.TrackAlias,
+		"group_id":              e.GroupID,
+		"object_id":             e.ObjectID,
+		"publisher_priority":    e.PublisherPriority,
+		"forwarding_preference": forwardingPreference(e.ForwardingPreference),
+		"object_status":         e.Status,
+	}
+	if e.PayloadLength >= 0 {
+		data["object_payload_length"] = e.PayloadLength
+	}
+	return data
+}
+
+func objectEventName(e moqtransport.ObjectEvent, suffix string) string {
+	if e.ForwardingPreference == moqtransport.ObjectForwardingPreferenceDatagram {
+		return "moqt:object_datagram_" + suffix
+	}
+	return "moqt:stream_object_" + suffix
+}
+
+// ObjectSent implements moqtransport.Tracer.
+func (t *Tracer) ObjectSent(e moqtransport.ObjectEvent) {
+	t.writeEvent(objectEventName(e, "created"), objectData(e))
+}
+
+// ObjectReceived implements moqtransport.Tracer.
+func (t *Tracer) ObjectReceived(e moqtransport.ObjectEvent) {
+	t.writeEvent(objectEventName(e, "parsed"), objectData(e))
+}
+
+func streamData(e moqtransport.StreamEvent) map[string]any {
+	owner := "local"
+	if e.Direction == moqtransport.StreamDirectionReceive {
+		owner = "remote"
+	}
+	data := map[string]any{
+		"owner":        owner,
+		"stream_type":  forwardingPreference(e.Type),
+		"subscribe_id": e.SubscribeID,
+		"track_alias":  e.TrackAlias,
+	}
+	if e.Type != moqtransport.ObjectForwardingPreferenceStreamTrack {
+		data["group_id"] = e.GroupID
+	}
+	return data
+}
+
+// StreamOpened implements moqtransport.Tracer.
+func (t *Tracer) StreamOpened(e moqtransport.StreamEvent) {
+	t.writeEvent("moqt:stream_type_set", streamData(e))
+}
+
+// StreamClosed implements moqtransport.Tracer.
+func (t *Tracer) StreamClosed(e moqtransport.StreamEvent) {
+	t.writeEvent("moqt:stream_closed", streamData(e))
+}
@@ -0,0 +1,145 @@
+package moqqlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+// blockingWriter blocks writes until unblock is closed.
+type blockingWriter struct {
+	unblock chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.unblock
+	return w.buf.Write(p)
+}
+
+func records(t *testing.T, buf []byte) []map[string]any {
+	res := []map[string]any{}
+	for _, r := range bytes.Split(buf, []byte{recordSeparator}) {
+		if len(r) == 0 {
+			continue
+		}
+		assert.Equal(t, byte('\n'), r[len(r)-1])
+		var m map[string]any
+		assert.NoError(t, json.Unmarshal(r, &m))
+		res = append(res, m)
+	}
+	return res
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("records", func(t *testing.T) {
+		var buf bytes.Buffer
+		tracer := NewTracer(&buf, VantagePointClient, "test")
+		tracer.ControlMessageSent(moqtransport.ControlMessageEvent{
+			Type: "SUBSCRIBE",
+			Fields: map[string]any{
+				"subscribe_id": 1,
+			},
+		})
+		tracer.ObjectReceived(moqtransport.ObjectEvent{
+			SubscribeID:          1,
+			TrackAlias:           2,
+			GroupID:              3,
+			ObjectID:             4,
+			PublisherPriority:    5,
+			ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+			Status:               moqtransport.ObjectStatusNormal,
+			PayloadLength:        -1,
+		})
+		tracer.StreamOpened(moqtransport.StreamEvent{
+			Direction:   moqtransport.StreamDirectionSend,
+			Type:        moqtransport.ObjectForwardingPreferenceStreamTrack,
+			SubscribeID: 1,
+			TrackAlias:  2,
+			GroupID:     0,
+		})
+		assert.NoError(t, tracer.Close())
+		assert.Zero(t, tracer.Dropped())
+
+		rs := records(t, buf.Bytes())
+		assert.Len(t, rs, 4)
+		assert.Equal(t, "JSON-SEQ", rs[0]["qlog_format"])
+		assert.Equal(t, "client", rs[0]["trace"].(map[string]any)["vantage_point"].(map[string]any)["type"])
+
+		assert.Equal(t, "moqt:control_message_created", rs[1]["name"])
+		assert.Equal(t, map[string]any{
+			"message": map[string]any{
+				"type":         "subscribe",
+				"subscribe_id": float64(1),
+			},
+		}, rs[1]["data"])
+
+		assert.Equal(t, "moqt:stream_object_parsed", rs[2]["name"])
+		assert.Equal(t, map[string]any{
+			"subscribe_id":          float64(1),
+			"track_alias":           float64(2),
+			"group_id":              float64(3),
+			"object_id":             float64(4),
+			"publisher_priority":    float64(5),
+			"forwarding_preference": "object_stream",
+			"object_status":         float64(0),
+		}, rs[2]["data"])
+
+		assert.Equal(t, "moqt:stream_type_set", rs[3]["name"])
+		assert.Equal(t, map[string]any{
+			"owner":        "local",
+			"stream_type":  "stream_header_track",
+			"subscribe_id": float64(1),
+			"track_alias":  float64(2),
+		}, rs[3]["data"])
+	})
+	t.Run("write_error", func(t *testing.T) {
+		tracer := NewTracer(failingWriter{}, VantagePointServer, "")
+		tracer.ControlMessageParsed(moqtransport.ControlMessageEvent{
+			Type:   "GOAWAY",
+			Fields: map[string]any{},
+		})
+		assert.Error(t, tracer.Close())
+		assert.Error(t, tracer.Err())
+	})
+	t.Run("blocking_writer", func(t *testing.T) {
+		w := &blockingWriter{
+			unblock: make(chan struct{}),
+		}
+		tracer := NewTracer(w, VantagePointServer, "")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 2*eventQueueSize; i++ {
+				tracer.ControlMessageParsed(moqtransport.ControlMessageEvent{
+					Type:   "GOAWAY",
+					Fields: map[string]any{},
+				})
+			}
+		}()
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "tracing blocked on the writer")
+		case <-done:
+		}
+		assert.Greater(t, tracer.Dropped(), uint64(0))
+		close(w.unblock)
+		assert.NoError(t, tracer.Close())
+		tracer.ControlMessageParsed(moqtransport.ControlMessageEvent{
+			Type:   "GOAWAY",
+			Fields: map[string]any{},
+		})
+		assert.Equal(t, 2*eventQueueSize+1, int(tracer.Dropped())+len(records(t, w.buf.Bytes()))-1)
+	})
+}
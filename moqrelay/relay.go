@@ -0,0 +1,357 @@
+// Package moqrelay implements a relay which forwards tracks from publishing
+// sessions to any number of subscribing sessions.
+package moqrelay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+var (
+	errUnknownNamespace   = errors.New("unknown namespace")
+	errDuplicateNamespace = errors.New("namespace already announced by another session")
+)
+
+type trackKey struct {
+	namespace string
+	trackname string
+}
+
+// endTrackTimeout bounds the time downstream subscribers get to receive the
+// end of a track after the upstream subscription ended.
+const endTrackTimeout = 5 * time.Second
+
+// A relayTrack forwards one upstream subscription to the local track which is
+// subscribed by the downstream subscribers. pending, subscribers, closing and
+// drained are protected by the lock of the Relay.
+type relayTrack struct {
+	key    trackKey
+	ready  chan struct{}
+	err    error
+	cancel context.CancelFunc
+	local  *moqtransport.LocalTrack
+	remote *moqtransport.RemoteTrack
+
+	// pending is the number of downstream subscriptions waiting to be
+	// accepted or rejected.
+	pending int
+
+	// subscribers is the number of downstream subscribers of local.
+	subscribers int
+
+	// closing is set once the track must not be used by new downstream
+	// subscriptions.
+	closing bool
+
+	// drained is closed when the last subscriber left after the upstream
+	// subscription ended.
+	drained chan struct{}
+}
+
+var (
+	_ moqtransport.AnnouncementHandler   = (*Relay)(nil)
+	_ moqtransport.UnannouncementHandler = (*Relay)(nil)
+	_ moqtransport.SubscriptionHandler   = (*Relay)(nil)
+)
+
+// A Relay forwards tracks announced by publishing sessions to subscribing
+// sessions. A Relay implements moqtransport.AnnouncementHandler,
+// moqtransport.UnannouncementHandler and moqtransport.SubscriptionHandler and
+// can be used as the handler of any number of sessions.
+//
+// Downstream subscriptions with FilterTypeLatestGroup or
+// FilterTypeLatestObject share one upstream subscription per track, which
+// starts at the latest group and uses the priority and group order of the
+// first downstream subscriber. The upstream subscription is created when the
+// first downstream subscriber subscribes and it is removed when the last one
+// unsubscribes. Downstream subscriptions with an absolute start or range get
+// a dedicated upstream subscription with the same range.
+//
+// When an upstream subscription ends, the downstream subscribers receive the
+// end of the track and their subscriptions end with SUBSCRIBE_DONE. When a
+// publishing session ends, its namespaces are removed.
+type Relay struct {
+	logger     *slog.Logger
+	lock       sync.Mutex
+	publishers map[string]*moqtransport.Session
+	tracks     map[trackKey]*relayTrack
+
+	// watched holds the publishing sessions whose end is watched by a
+	// goroutine.
+	watched map[*moqtransport.Session]struct{}
+}
+
+// New creates a new Relay.
+func New() *Relay {
+	return &Relay{
+		logger:     moqtransport.Logger().WithGroup("MOQ_RELAY"),
+		lock:       sync.Mutex{},
+		publishers: map[string]*moqtransport.Session{},
+		tracks:     map[trackKey]*relayTrack{},
+		watched:    map[*moqtransport.Session]struct{}{},
+	}
+}
+
+// HandleAnnouncement accepts the announcement and makes the tracks in the
+// announced namespace available to subscribers of the relay.
+func (r *Relay) HandleAnnouncement(s *moqtransport.Session, a *moqtransport.Announcement, arw moqtransport.AnnouncementResponseWriter) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if p, ok := r.publishers[a.Namespace()]; ok && p != s {
+		arw.Reject(moqtransport.ErrorCodeInternal, errDuplicateNamespace.Error())
+		return
+	}
+	r.publishers[a.Namespace()] = s
+	if _, ok := r.watched[s]; !ok {
+		r.watched[s] = struct{}{}
+		go r.watch(s)
+	}
+	arw.Accept()
+}
+
+// watch removes the namespaces announced by s when s ends, so that new
+// subscriptions are not routed to the ended session.
+func (r *Relay) watch(s *moqtransport.Session) {
+	<-s.Done()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for namespace, p := range r.publishers {
+		if p == s {
+			delete(r.publishers, namespace)
+		}
+	}
+	delete(r.watched, s)
+}
+
+// HandleUnannouncement removes the namespace, so that new subscriptions to
+// tracks in it are rejected. Existing subscriptions are not affected.
+func (r *Relay) HandleUnannouncement(s *moqtransport.Session, a *moqtransport.Announcement) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if p, ok := r.publishers[a.Namespace()]; ok && p == s {
+		delete(r.publishers, a.Namespace())
+	}
+}
+
+// HandleSubscription subscribes to the requested track at the publisher that
+// announced the namespace of the track, unless the relay already has a
+// subscription to the track which can be shared.
+func (r *Relay) HandleSubscription(_ *moqtransport.Session, sub *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+	// Subscribing upstream blocks until the publisher responds, so don't block
+	// the control stream of the subscriber.
+	go r.handleSubscription(sub, srw)
+}
+
+func (r *Relay) handleSubscription(sub *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+	rt, err := r.getOrSubscribe(sub)
+	if err != nil {
+		srw.Reject(moqtransport.ErrorCodeTrackNotFound, err.Error())
+		return
+	}
+	defer r.done(rt)
+	<-rt.ready
+	if rt.err != nil {
+		srw.Reject(moqtransport.ErrorCodeInternal, rt.err.Error())
+		return
+	}
+	srw.Accept(rt.local)
+}
+
+// getOrSubscribe returns the relayTrack for sub and registers sub as pending
+// subscription of it. The caller must call done once sub was accepted or
+// rejected.
+func (r *Relay) getOrSubscribe(sub *moqtransport.Subscription) (*relayTrack, error) {
+	key := trackKey{
+		namespace: sub.Namespace,
+		trackname: sub.TrackName,
+	}
+	shared := sub.FilterType == moqtransport.FilterTypeLatestGroup || sub.FilterType == moqtransport.FilterTypeLatestObject
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if rt, ok := r.tracks[key]; ok && shared && !rt.closing {
+		rt.pending++
+		return rt, nil
+	}
+	p, ok := r.publishers[key.namespace]
+	if !ok {
+		return nil, errUnknownNamespace
+	}
+	opts := &moqtransport.SubscribeOptions{
+		SubscriberPriority: sub.SubscriberPriority,
+		GroupOrder:         sub.GroupOrder,
+		FilterType:         moqtransport.FilterTypeLatestGroup,
+	}
+	if !shared {
+		opts.FilterType = sub.FilterType
+		opts.StartGroup = sub.StartGroup
+		opts.StartObject = sub.StartObject
+		opts.EndGroup = sub.EndGroup
+		opts.EndObject = sub.EndObject
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rt := &relayTrack{
+		key:         key,
+		ready:       make(chan struct{}),
+		err:         nil,
+		cancel:      cancel,
+		local:       nil,
+		remote:      nil,
+		pending:     1,
+		subscribers: 0,
+		closing:     false,
+		drained:     nil,
+	}
+	if shared {
+		r.tracks[key] = rt
+	}
+	go r.subscribeUpstream(ctx, p, rt, sub.Authorization, opts)
+	return rt, nil
+}
+
+func (r *Relay) subscribeUpstream(ctx context.Context, s *moqtransport.Session, rt *relayTrack, auth string, opts *moqtransport.SubscribeOptions) {
+	defer close(rt.ready)
+	remote, err := s.Subscribe(ctx, rt.key.namespace, rt.key.trackname, auth, opts)
+	if err != nil {
+		r.logger.Error("upstream subscription failed", "namespace", rt.key.namespace, "trackname", rt.key.trackname, "error", err)
+		rt.err = err
+		r.lock.Lock()
+		r.closeLocked(rt)
+		r.lock.Unlock()
+		rt.cancel()
+		return
+	}
+	rt.remote = remote
+	rt.local = moqtransport.NewLocalTrack(
+		rt.key.namespace,
+		rt.key.trackname,
+		moqtransport.WithSubscriberCountHandler(func(n int) {
+			r.subscriberCountChanged(rt, n)
+		}),
+		moqtransport.WithSubscriberErrorHandler(func(err error) {
+			r.logger.Warn("dropped downstream subscriber", "error", err)
+		}),
+	)
+	go func() {
+		err := Forward(ctx, remote, rt.local)
+		if err != nil {
+			r.logger.Info("stopped forwarding track", "namespace", rt.key.namespace, "trackname", rt.key.trackname, "error", err)
+		}
+		r.finish(ctx, rt, err)
+	}()
+}
+
+// done removes a pending subscription from rt and releases rt if it is not
+// used anymore.
+func (r *Relay) done(rt *relayTrack) {
+	r.lock.Lock()
+	rt.pending--
+	release := r.releasableLocked(rt)
+	r.lock.Unlock()
+	if release {
+		r.release(rt)
+	}
+}
+
+// subscriberCountChanged is called from the goroutine of the local track of
+// rt, so it must not call any methods of the local track.
+func (r *Relay) subscriberCountChanged(rt *relayTrack, n int) {
+	r.lock.Lock()
+	rt.subscribers = n
+	if n == 0 && rt.drained != nil {
+		close(rt.drained)
+		rt.drained = nil
+	}
+	release := r.releasableLocked(rt)
+	r.lock.Unlock()
+	if release {
+		r.release(rt)
+	}
+}
+
+// releasableLocked reports whether rt has neither subscribers nor pending
+// subscriptions and marks it closing if so. It must be called with the lock
+// held.
+func (r *Relay) releasableLocked(rt *relayTrack) bool {
+	if rt.closing || rt.pending > 0 || rt.subscribers > 0 {
+		return false
+	}
+	r.closeLocked(rt)
+	return true
+}
+
+// closeLocked marks rt as closing and removes it from the shared tracks. It
+// must be called with the lock held.
+func (r *Relay) closeLocked(rt *relayTrack) {
+	rt.closing = true
+	if current, ok := r.tracks[rt.key]; ok && current == rt {
+		delete(r.tracks, rt.key)
+	}
+}
+
+// release unsubscribes from the upstream track of rt, which stops forwarding
+// and closes the local track.
+func (r *Relay) release(rt *relayTrack) {
+	rt.cancel()
+	rt.remote.Unsubscribe()
+}
+
+// finish ends the local track of rt after forwarding stopped. If forwarding
+// stopped because rt was released, there are no subscribers left. Otherwise,
+// the remaining subscribers receive the end of the track before the local
+// track is closed.
+func (r *Relay) finish(ctx context.Context, rt *relayTrack, err error) {
+	r.lock.Lock()
+	r.closeLocked(rt)
+	drained := make(chan struct{})
+	if rt.subscribers == 0 {
+		close(drained)
+	} else {
+		rt.drained = drained
+	}
+	r.lock.Unlock()
+
+	if ctx.Err() == nil {
+		if err != nil {
+			rt.remote.Unsubscribe()
+		}
+		endCtx, cancel := context.WithTimeout(context.Background(), endTrackTimeout)
+		// The track is already finished if the publisher ended it.
+		if rt.local.Status().StatusCode != moqtransport.TrackStatusFinished {
+			if err := rt.local.EndTrack(endCtx); err != nil {
+				r.logger.Warn("failed to end track", "namespace", rt.key.namespace, "trackname", rt.key.trackname, "error", err)
+			}
+		}
+		select {
+		case <-drained:
+		case <-endCtx.Done():
+			r.logger.Warn("closing track before all subscribers received the end of the track", "namespace", rt.key.namespace, "trackname", rt.key.trackname)
+		}
+		cancel()
+	}
+	rt.cancel()
+	rt.local.Close()
+}
+
+// Forward writes all objects read from remote to local until the publisher
+// ends the subscription, reading from remote fails or ctx is done. It returns
+// nil if the publisher ended the subscription.
+func Forward(ctx context.Context, remote *moqtransport.RemoteTrack, local *moqtransport.LocalTrack) error {
+	for {
+		o, err := remote.ReadObject(ctx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err = local.WriteObject(ctx, o); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package moqrelay
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/memconn"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+// relayTest connects sessions to a relay over in-memory connections.
+type relayTest struct {
+	t        *testing.T
+	ctx      context.Context
+	relay    *Relay
+	sessions []*moqtransport.Session
+}
+
+func newRelayTest(t *testing.T, ctx context.Context) *relayTest {
+	return &relayTest{
+		t:        t,
+		ctx:      ctx,
+		relay:    New(),
+		sessions: []*moqtransport.Session{},
+	}
+}
+
+// connect runs client on a connection to a new session of the relay.
+func (rt *relayTest) connect(client *moqtransport.Session) {
+	clientConn, serverConn := memconn.Pipe(nil)
+	server := &moqtransport.Session{
+		Conn:                serverConn,
+		AnnouncementHandler: rt.relay,
+		SubscriptionHandler: rt.relay,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.RunServer(rt.ctx)
+	}()
+	client.Conn = clientConn
+	assert.NoError(rt.t, client.RunClient())
+	assert.NoError(rt.t, <-errCh)
+	rt.sessions = append(rt.sessions, client, server)
+}
+
+// publish connects a publisher which announces the namespace of track.
+func (rt *relayTest) publish(track *moqtransport.LocalTrack, handler moqtransport.SubscriptionHandler) *moqtransport.Session {
+	publisher := &moqtransport.Session{
+		SubscriptionHandler: handler,
+	}
+	rt.connect(publisher)
+	if track != nil {
+		assert.NoError(rt.t, publisher.AddLocalTrack(track))
+	}
+	assert.NoError(rt.t, publisher.Announce(rt.ctx, "namespace"))
+	return publisher
+}
+
+func (rt *relayTest) subscribe() *moqtransport.RemoteTrack {
+	subscriber := &moqtransport.Session{}
+	rt.connect(subscriber)
+	remote, err := subscriber.Subscribe(rt.ctx, "namespace", "track", "", nil)
+	assert.NoError(rt.t, err)
+	return remote
+}
+
+func (rt *relayTest) close() {
+	for _, s := range rt.sessions {
+		assert.NoError(rt.t, s.Close())
+	}
+}
+
+func (rt *relayTest) tracks() int {
+	rt.relay.lock.Lock()
+	defer rt.relay.lock.Unlock()
+	return len(rt.relay.tracks)
+}
+
+// readUntilEnd reads objects from remote until the subscription ends.
+func readUntilEnd(ctx context.Context, remote *moqtransport.RemoteTrack) error {
+	for {
+		if _, err := remote.ReadObject(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func TestRelay(t *testing.T) {
+	t.Run("fan_out", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		rt.publish(track, nil)
+		remotes := []*moqtransport.RemoteTrack{rt.subscribe(), rt.subscribe(), rt.subscribe()}
+		assert.Equal(t, 1, track.SubscriberCount())
+		assert.Equal(t, 1, rt.tracks())
+
+		assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+			GroupID:              0,
+			ObjectID:             0,
+			ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+			Payload:              []byte("hello"),
+		}))
+		for _, remote := range remotes {
+			o, err := remote.ReadObject(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", string(o.Payload))
+		}
+	})
+	t.Run("refcount_release", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		rt.publish(track, nil)
+		first := rt.subscribe()
+		second := rt.subscribe()
+		assert.Equal(t, 1, track.SubscriberCount())
+
+		first.Unsubscribe()
+		assert.ErrorIs(t, readUntilEnd(ctx, first), io.EOF)
+		assert.Equal(t, 1, track.SubscriberCount())
+		assert.Equal(t, 1, rt.tracks())
+
+		second.Unsubscribe()
+		assert.ErrorIs(t, readUntilEnd(ctx, second), io.EOF)
+		assert.Eventually(t, func() bool {
+			return track.SubscriberCount() == 0
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, 0, rt.tracks())
+
+		// A new subscriber creates a new upstream subscription.
+		third := rt.subscribe()
+		assert.Equal(t, 1, track.SubscriberCount())
+		assert.NoError(t, track.WriteObject(ctx, moqtransport.Object{
+			GroupID:              1,
+			ObjectID:             0,
+			ForwardingPreference: moqtransport.ObjectForwardingPreferenceStream,
+			Payload:              []byte("again"),
+		}))
+		o, err := third.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "again", string(o.Payload))
+	})
+	t.Run("upstream_rejected", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		rt.publish(nil, moqtransport.SubscriptionHandlerFunc(func(_ *moqtransport.Session, _ *moqtransport.Subscription, srw moqtransport.SubscriptionResponseWriter) {
+			srw.Reject(moqtransport.ErrorCodeTrackNotFound, "not found")
+		}))
+		subscriber := &moqtransport.Session{}
+		rt.connect(subscriber)
+		_, err := subscriber.Subscribe(ctx, "namespace", "track", "", nil)
+		var appErr moqtransport.ApplicationError
+		assert.ErrorAs(t, err, &appErr)
+		assert.ErrorContains(t, err, "not found")
+		assert.Equal(t, 0, rt.tracks())
+	})
+	t.Run("unknown_namespace", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		subscriber := &moqtransport.Session{}
+		rt.connect(subscriber)
+		_, err := subscriber.Subscribe(ctx, "namespace", "track", "", nil)
+		var appErr moqtransport.ApplicationError
+		assert.ErrorAs(t, err, &appErr)
+		assert.ErrorContains(t, err, errUnknownNamespace.Error())
+	})
+	t.Run("upstream_ended", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		rt.publish(track, nil)
+		remotes := []*moqtransport.RemoteTrack{rt.subscribe(), rt.subscribe()}
+		assert.NoError(t, track.EndTrack(ctx))
+		for _, remote := range remotes {
+			assert.ErrorIs(t, readUntilEnd(ctx, remote), io.EOF)
+		}
+		assert.Equal(t, 0, rt.tracks())
+	})
+	t.Run("publisher_ended", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		publisher := rt.publish(nil, nil)
+		assert.NoError(t, publisher.Close())
+		assert.Eventually(t, func() bool {
+			rt.relay.lock.Lock()
+			defer rt.relay.lock.Unlock()
+			return len(rt.relay.publishers) == 0 && len(rt.relay.watched) == 0
+		}, time.Second, 10*time.Millisecond)
+
+		subscriber := &moqtransport.Session{}
+		rt.connect(subscriber)
+		_, err := subscriber.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.ErrorContains(t, err, errUnknownNamespace.Error())
+	})
+	t.Run("upstream_failed", func(t *testing.T) {
+		defer goleak.VerifyNone(t)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		rt := newRelayTest(t, ctx)
+		defer rt.close()
+
+		track := moqtransport.NewLocalTrack("namespace", "track")
+		defer track.Close()
+		publisher := rt.publish(track, nil)
+		remotes := []*moqtransport.RemoteTrack{rt.subscribe(), rt.subscribe()}
+		assert.NoError(t, publisher.CloseWithError(moqtransport.ErrorCodeInternal, "failure"))
+		for _, remote := range remotes {
+			assert.ErrorIs(t, readUntilEnd(ctx, remote), io.EOF)
+		}
+		assert.Equal(t, 0, rt.tracks())
+	})
+}
@@ -0,0 +1,346 @@
+// Package moqserver implements a server accepting MoQ sessions on QUIC
+// connections and WebTransport sessions. It is a separate package, so that
+// applications which don't run a server don't depend on HTTP/3 and
+// WebTransport.
+package moqserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/quicmoq"
+	"github.com/mengelbart/moqtransport/webtransportmoq"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
+)
+
+// ALPN is the application protocol of MoQ sessions running directly on QUIC.
+const ALPN = "moq-00"
+
+// DefaultWebTransportPath is the path of WebTransport sessions used by a
+// Server if Path is empty.
+const DefaultWebTransportPath = "/moq"
+
+// serverHandshakeTimeout bounds the time between accepting a connection and
+// completing the MoQ setup.
+const serverHandshakeTimeout = 10 * time.Second
+
+// ErrServerClosed is returned by Server.Serve and Server.ListenAndServe after
+// Shutdown was called.
+var ErrServerClosed = errors.New("moqserver: server closed")
+
+// A Server accepts MoQ sessions on QUIC connections and on WebTransport
+// sessions sharing one UDP address. Connections negotiating ALPN run MoQ
+// directly, connections negotiating HTTP/3 are upgraded to WebTransport at
+// Path.
+type Server struct {
+	// Path is the path of WebTransport sessions. Requests to other paths
+	// are answered with 404 Not Found. If empty, DefaultWebTransportPath is
+	// used.
+	Path string
+
+	// Session is the template of accepted sessions. Every session copies
+	// the handlers, roles, datagram setting, supported versions and tracer
+	// of the template. If nil, sessions use the defaults of
+	// moqtransport.Session.
+	Session *moqtransport.Session
+
+	// OnSession is called with every session after its handshake completed.
+	// It runs in its own goroutine, so it may block, e.g. to serve the
+	// session until it ends.
+	OnSession func(*moqtransport.Session)
+
+	// QUICConfig configures the QUIC connections. Datagrams are always
+	// enabled because WebTransport requires them.
+	QUICConfig *quic.Config
+
+	// CheckOrigin validates the origin of WebTransport requests. If nil,
+	// the origin must match the host of the request.
+	CheckOrigin func(r *http.Request) bool
+
+	logger       *slog.Logger
+	lock         sync.Mutex
+	shuttingDown bool
+	deadline     time.Time
+	transport    *quic.Transport
+	listener     *quic.Listener
+	webTransport *webtransport.Server
+	h3Conns      map[quic.Connection]struct{}
+	sessions     map[*moqtransport.Session]struct{}
+
+	// active counts the connections which are in their handshake or run a
+	// session.
+	active sync.WaitGroup
+
+	// ctx is canceled to abort pending handshakes when Shutdown gives up.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// ListenAndServe listens on the UDP address addr and serves sessions until
+// Shutdown is called. It always returns a non-nil error, after Shutdown it
+// returns ErrServerClosed.
+func (s *Server) ListenAndServe(addr string, tlsConfig *tls.Config) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(conn, tlsConfig)
+}
+
+// Serve serves sessions on conn until Shutdown is called. Shutdown closes
+// conn. Serve always returns a non-nil error, after Shutdown it returns
+// ErrServerClosed.
+func (s *Server) Serve(conn net.PacketConn, tlsConfig *tls.Config) error {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{ALPN, http3.NextProtoH3}
+	quicConfig := &quic.Config{}
+	if s.QUICConfig != nil {
+		quicConfig = s.QUICConfig.Clone()
+	}
+	quicConfig.EnableDatagrams = true
+
+	s.lock.Lock()
+	if s.shuttingDown {
+		s.lock.Unlock()
+		conn.Close()
+		return ErrServerClosed
+	}
+	if s.transport != nil {
+		s.lock.Unlock()
+		return errors.New("moqserver: server is already serving")
+	}
+	s.init()
+	s.transport = &quic.Transport{Conn: conn}
+	listener, err := s.transport.Listen(tlsConfig, quicConfig)
+	if err != nil {
+		s.transport = nil
+		s.lock.Unlock()
+		return err
+	}
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		qc, err := listener.Accept(context.Background())
+		if err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.shuttingDown {
+				return ErrServerClosed
+			}
+			return err
+		}
+		switch qc.ConnectionState().TLS.NegotiatedProtocol {
+		case ALPN:
+			go s.serveSession(quicmoq.New(qc), "")
+		case http3.NextProtoH3:
+			go s.serveHTTP3(qc)
+		default:
+			_ = qc.CloseWithError(quic.ApplicationErrorCode(moqtransport.ErrorCodeInternal), "unknown application protocol")
+		}
+	}
+}
+
+// init initializes the server. It must be called with the lock held.
+func (s *Server) init() {
+	path := s.Path
+	if path == "" {
+		path = DefaultWebTransportPath
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, s.serveWebTransport)
+	s.webTransport = &webtransport.Server{
+		H3: http3.Server{
+			Handler: mux,
+		},
+		CheckOrigin: s.CheckOrigin,
+	}
+	s.logger = moqtransport.Logger().WithGroup("MOQ_SERVER")
+	s.h3Conns = map[quic.Connection]struct{}{}
+	s.sessions = map[*moqtransport.Session]struct{}{}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+// serveHTTP3 serves the WebTransport requests of an HTTP/3 connection. The
+// connection is tracked, because the WebTransport server does not close
+// connections passed to ServeQUICConn.
+func (s *Server) serveHTTP3(conn quic.Connection) {
+	s.lock.Lock()
+	s.h3Conns[conn] = struct{}{}
+	s.lock.Unlock()
+	if err := s.webTransport.ServeQUICConn(conn); err != nil {
+		s.logger.Info("HTTP/3 connection ended", "error", err)
+	}
+	s.lock.Lock()
+	delete(s.h3Conns, conn)
+	s.lock.Unlock()
+}
+
+func (s *Server) serveWebTransport(w http.ResponseWriter, r *http.Request) {
+	session, err := s.webTransport.Upgrade(w, r)
+	if err != nil {
+		// Upgrade does not answer failed requests. Without an explicit
+		// status, the handler would answer 200, which tells the client
+		// that the upgrade succeeded.
+		s.logger.Info("upgrading to WebTransport failed", "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.serveSession(webtransportmoq.New(session), r.URL.Path)
+}
+
+// newSession returns a session for conn configured from the template.
+func (s *Server) newSession(conn moqtransport.Connection, path string) *moqtransport.Session {
+	session := &moqtransport.Session{
+		Conn: conn,
+		Path: path,
+	}
+	if t := s.Session; t != nil {
+		session.EnableDatagrams = t.EnableDatagrams
+		session.LocalRole = t.LocalRole
+		session.RemoteRole = t.RemoteRole
+		session.AnnouncementHandler = t.AnnouncementHandler
+		session.AnnouncementCancelHandler = t.AnnouncementCancelHandler
+		session.SubscriptionHandler = t.SubscriptionHandler
+		session.TrackStatusHandler = t.TrackStatusHandler
+		session.GoAwayHandler = t.GoAwayHandler
+		session.SupportedVersions = t.SupportedVersions
+		session.Tracer = t.Tracer
+	}
+	return session
+}
+
+// serveSession runs a session on conn and tracks it until it ends.
+func (s *Server) serveSession(conn moqtransport.Connection, path string) {
+	s.lock.Lock()
+	if s.shuttingDown {
+		s.lock.Unlock()
+		_ = conn.CloseWithError(moqtransport.ErrorCodeNoError, "server shutting down")
+		return
+	}
+	s.active.Add(1)
+	s.lock.Unlock()
+	defer s.active.Done()
+
+	session := s.newSession(conn, path)
+	ctx, cancel := context.WithTimeout(s.ctx, serverHandshakeTimeout)
+	defer cancel()
+	if err := session.RunServer(ctx); err != nil {
+		s.logger.Info("MoQ session handshake failed", "error", err)
+		_ = conn.CloseWithError(moqtransport.ErrorCodeInternal, "session initialization error")
+		return
+	}
+
+	s.lock.Lock()
+	s.sessions[session] = struct{}{}
+	goAway := s.shuttingDown
+	deadline := s.deadline
+	s.lock.Unlock()
+	if goAway {
+		s.goAway(session, deadline)
+	}
+	if s.OnSession != nil {
+		// Shutdown waits for the session, not for the callback.
+		go s.OnSession(session)
+	}
+	<-session.Done()
+
+	s.lock.Lock()
+	delete(s.sessions, session)
+	s.lock.Unlock()
+}
+
+// goAway sends GOAWAY to session, which must be closed by the client before
+// deadline. If deadline is zero, Shutdown has no deadline and the session is
+// not closed by a timeout.
+func (s *Server) goAway(session *moqtransport.Session, deadline time.Time) {
+	timeout := time.Duration(math.MaxInt64)
+	if !deadline.IsZero() {
+		timeout = time.Until(deadline)
+	}
+	if err := session.GoAway("", timeout); err != nil {
+		s.logger.Info("failed to send GOAWAY", "error", err)
+	}
+}
+
+// Shutdown stops accepting connections and sends GOAWAY to all sessions, which
+// asks clients to reconnect. It waits until all sessions ended or ctx is done.
+// Sessions that are still running when ctx is done are closed with
+// ErrorCodeGoAwayTimeout and Shutdown returns the error of ctx.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.lock.Lock()
+	if s.shuttingDown {
+		s.lock.Unlock()
+		return errors.New("moqserver: server is already shutting down")
+	}
+	s.shuttingDown = true
+	deadline, _ := ctx.Deadline()
+	s.deadline = deadline
+	if s.transport == nil {
+		s.lock.Unlock()
+		return nil
+	}
+	sessions := make([]*moqtransport.Session, 0, len(s.sessions))
+	for session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.lock.Unlock()
+
+	// Connections of running sessions remain open when the listener is
+	// closed, because the transport is not closed yet.
+	if err := s.listener.Close(); err != nil {
+		s.logger.Info("failed to close listener", "error", err)
+	}
+	for _, session := range sessions {
+		s.goAway(session, deadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.cancel()
+		s.lock.Lock()
+		for session := range s.sessions {
+			_ = session.CloseWithError(moqtransport.ErrorCodeGoAwayTimeout, "GOAWAY timeout")
+		}
+		s.lock.Unlock()
+		<-done
+	}
+	s.cancel()
+	if cerr := s.webTransport.Close(); cerr != nil {
+		s.logger.Info("failed to close WebTransport server", "error", cerr)
+	}
+	s.lock.Lock()
+	for conn := range s.h3Conns {
+		_ = conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "server shutting down")
+	}
+	s.lock.Unlock()
+	if cerr := s.transport.Close(); cerr != nil {
+		s.logger.Info("failed to close QUIC transport", "error", cerr)
+	}
+	if cerr := s.transport.Conn.Close(); cerr != nil {
+		s.logger.Info("failed to close UDP connection", "error", cerr)
+	}
+	return err
+}
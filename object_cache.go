@@ -0,0 +1,136 @@
+package moqtransport
+
+import "time"
+
+// CacheConfig bounds the objects a LocalTrack keeps to serve subscribers that
+// join after the objects were written. Bounds that are zero are not enforced.
+// If all bounds are zero, the track does not cache any objects.
+type CacheConfig struct {
+	// MaxGroups is the number of most recent groups to keep.
+	MaxGroups int
+	// MaxBytes is the maximum sum of payload sizes of all cached objects.
+	MaxBytes int
+	// MaxAge is the duration after which an object is removed from the
+	// cache.
+	MaxAge time.Duration
+}
+
+func (c CacheConfig) enabled() bool {
+	return c.MaxGroups > 0 || c.MaxBytes > 0 || c.MaxAge > 0
+}
+
+type cachedObject struct {
+	object Object
+	added  time.Time
+}
+
+// objectCache stores objects in the order they were written to a track. It is
+// not safe for concurrent use.
+type objectCache struct {
+	config      CacheConfig
+	now         func() time.Time
+	objects     []cachedObject
+	groupCounts map[uint64]int
+	size        int
+}
+
+func newObjectCache(config CacheConfig) *objectCache {
+	return &objectCache{
+		config:      config,
+		now:         time.Now,
+		objects:     []cachedObject{},
+		groupCounts: map[uint64]int{},
+		size:        0,
+	}
+}
+
+func (c *objectCache) add(o Object) {
+	c.objects = append(c.objects, cachedObject{
+		object: o,
+		added:  c.now(),
+	})
+	c.groupCounts[o.GroupID]++
+	c.size += len(o.Payload)
+	c.evict()
+}
+
+func (c *objectCache) evict() {
+	for len(c.objects) > 0 && c.full() {
+		o := c.objects[0].object
+		c.objects[0] = cachedObject{}
+		c.objects = c.objects[1:]
+		c.size -= len(o.Payload)
+		c.groupCounts[o.GroupID]--
+		if c.groupCounts[o.GroupID] == 0 {
+			delete(c.groupCounts, o.GroupID)
+		}
+	}
+}
+
+func (c *objectCache) full() bool {
+	if c.config.MaxGroups > 0 && len(c.groupCounts) > c.config.MaxGroups {
+		return true
+	}
+	if c.config.MaxBytes > 0 && c.size > c.config.MaxBytes {
+		return true
+	}
+	if c.config.MaxAge > 0 && c.now().Sub(c.objects[0].added) > c.config.MaxAge {
+		return true
+	}
+	return false
+}
+
+// replay returns the cached objects a new subscription with the given filter
+// type should receive before any new objects.
+func (c *objectCache) replay(filter FilterType) []Object {
+	c.evict()
+	switch filter {
+	case FilterTypeLatestGroup:
+		return c.latestGroup()
+	case FilterTypeLatestObject:
+		return c.latestObject()
+	case FilterTypeAbsoluteStart, FilterTypeAbsoluteRange:
+		res := make([]Object, 0, len(c.objects))
+		for _, o := range c.objects {
+			res = append(res, o.object)
+		}
+		return res
+	}
+	return nil
+}
+
+// latestObject returns the cached object with the largest location, which is
+// the current object a subscription with FilterTypeLatestObject starts at.
+func (c *objectCache) latestObject() []Object {
+	var latest *Object
+	for i := range c.objects {
+		o := &c.objects[i].object
+		if o.Status != ObjectStatusNormal && o.Status != ObjectStatusObjectDoesNotExist {
+			continue
+		}
+		if latest == nil || (location{group: latest.GroupID, object: latest.ObjectID}).less(location{group: o.GroupID, object: o.ObjectID}) {
+			latest = o
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	return []Object{*latest}
+}
+
+func (c *objectCache) latestGroup() []Object {
+	if len(c.objects) == 0 {
+		return nil
+	}
+	latest := c.objects[0].object.GroupID
+	for _, o := range c.objects {
+		latest = max(latest, o.object.GroupID)
+	}
+	res := []Object{}
+	for _, o := range c.objects {
+		if o.object.GroupID == latest {
+			res = append(res, o.object)
+		}
+	}
+	return res
+}
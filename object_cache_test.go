@@ -0,0 +1,68 @@
+package moqtransport
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectCache(t *testing.T) {
+	cases := []struct {
+		config  CacheConfig
+		objects []Object
+		filter  FilterType
+		expect  []Object
+	}{
+		{
+			config:  CacheConfig{MaxGroups: 1},
+			objects: []Object{},
+			filter:  FilterTypeLatestGroup,
+			expect:  nil,
+		},
+		{
+			config:  CacheConfig{MaxGroups: 2},
+			objects: []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+			filter:  FilterTypeLatestGroup,
+			expect:  []Object{{GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+		},
+		{
+			config:  CacheConfig{MaxGroups: 2},
+			objects: []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+			filter:  FilterTypeLatestObject,
+			expect:  []Object{{GroupID: 1, ObjectID: 1}},
+		},
+		{
+			config:  CacheConfig{MaxGroups: 2},
+			objects: []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 1, ObjectID: 0}, {GroupID: 2, ObjectID: 0}},
+			filter:  FilterTypeAbsoluteStart,
+			expect:  []Object{{GroupID: 1, ObjectID: 0}, {GroupID: 2, ObjectID: 0}},
+		},
+		{
+			config:  CacheConfig{MaxBytes: 4},
+			objects: []Object{{GroupID: 0, ObjectID: 0, Payload: []byte{1, 2}}, {GroupID: 0, ObjectID: 1, Payload: []byte{1, 2}}, {GroupID: 0, ObjectID: 2, Payload: []byte{1, 2}}},
+			filter:  FilterTypeAbsoluteRange,
+			expect:  []Object{{GroupID: 0, ObjectID: 1, Payload: []byte{1, 2}}, {GroupID: 0, ObjectID: 2, Payload: []byte{1, 2}}},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			c := newObjectCache(tc.config)
+			for _, o := range tc.objects {
+				c.add(o)
+			}
+			assert.Equal(t, tc.expect, c.replay(tc.filter))
+		})
+	}
+	t.Run("max_age", func(t *testing.T) {
+		now := time.Now()
+		c := newObjectCache(CacheConfig{MaxAge: time.Second})
+		c.now = func() time.Time { return now }
+		c.add(Object{GroupID: 0, ObjectID: 0})
+		now = now.Add(time.Second)
+		c.add(Object{GroupID: 0, ObjectID: 1})
+		now = now.Add(time.Millisecond)
+		assert.Equal(t, []Object{{GroupID: 0, ObjectID: 1}}, c.replay(FilterTypeAbsoluteStart))
+	})
+}
@@ -6,7 +6,7 @@ type objectStream struct {
 	stream SendStream
 }
 
-func newObjectStream(stream SendStream, subscribeID, trackAlias, groupID, objectID uint64, publisherPriority uint8) (*objectStream, error) {
+func newObjectStream(stream SendStream, version wire.Version, subscribeID, trackAlias, groupID, objectID uint64, publisherPriority uint8, status wire.ObjectStatus) (*objectStream, error) {
 	osm := &wire.ObjectMessage{
 		Type:              wire.ObjectStreamMessageType,
 		SubscribeID:       subscribeID,
@@ -14,11 +14,11 @@ func newObjectStream(stream SendStream, subscribeID, trackAlias, groupID, object
 		GroupID:           groupID,
 		ObjectID:          objectID,
 		PublisherPriority: publisherPriority,
-		ObjectStatus:      0,
+		ObjectStatus:      status,
 		ObjectPayload:     nil,
 	}
 	buf := make([]byte, 0, 48)
-	buf = osm.Append(buf)
+	buf = osm.AppendVersion(buf, version)
 	_, err := stream.Write(buf)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,52 @@
+package moqtransport
+
+import "sync"
+
+// A pendingResponse passes the response to a request from the control stream
+// to the caller waiting for it. If the caller stopped waiting, e.g. because its
+// context expired, the response is abandoned and must be handled by the
+// session instead.
+type pendingResponse[T any] struct {
+	lock      sync.Mutex
+	ch        chan T
+	abandoned bool
+}
+
+func newPendingResponse[T any]() *pendingResponse[T] {
+	return &pendingResponse[T]{
+		lock:      sync.Mutex{},
+		ch:        make(chan T, 1),
+		abandoned: false,
+	}
+}
+
+// deliver passes msg to the waiting caller. It never blocks and returns false
+// if the caller abandoned the request.
+func (p *pendingResponse[T]) deliver(msg T) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.abandoned {
+		return false
+	}
+	select {
+	case p.ch <- msg:
+	default:
+		defaultLogger.Warn("dropping duplicate response message", "message", msg)
+	}
+	return true
+}
+
+// abandon marks the request as abandoned. If a response was delivered but not
+// received yet, abandon returns it and true.
+func (p *pendingResponse[T]) abandon() (T, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.abandoned = true
+	select {
+	case msg := <-p.ch:
+		return msg, true
+	default:
+		var zero T
+		return zero, false
+	}
+}
@@ -7,6 +7,38 @@ import (
 	"github.com/quic-go/quic-go"
 )
 
+// receiveStream wraps a quic.ReceiveStream to implement
+// moqtransport.CancelableReceiveStream.
+type receiveStream struct {
+	stream quic.ReceiveStream
+}
+
+func (s *receiveStream) Read(b []byte) (int, error) {
+	return s.stream.Read(b)
+}
+
+func (s *receiveStream) CancelRead(code uint64) {
+	s.stream.CancelRead(quic.StreamErrorCode(code))
+}
+
+// sendStream wraps a quic.SendStream to implement
+// moqtransport.ResettableSendStream.
+type sendStream struct {
+	stream quic.SendStream
+}
+
+func (s *sendStream) Write(b []byte) (int, error) {
+	return s.stream.Write(b)
+}
+
+func (s *sendStream) Close() error {
+	return s.stream.Close()
+}
+
+func (s *sendStream) CancelWrite(code uint64) {
+	s.stream.CancelWrite(quic.StreamErrorCode(code))
+}
+
 type connection struct {
 	connection quic.Connection
 }
@@ -24,11 +56,19 @@ func (c *connection) OpenStreamSync(ctx context.Context) (moqtransport.Stream, e
 }
 
 func (c *connection) OpenUniStream() (moqtransport.SendStream, error) {
-	return c.connection.OpenUniStream()
+	s, err := c.connection.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	return &sendStream{s}, nil
 }
 
 func (c *connection) OpenUniStreamSync(ctx context.Context) (moqtransport.SendStream, error) {
-	return c.connection.OpenUniStreamSync(ctx)
+	s, err := c.connection.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sendStream{s}, nil
 }
 
 func (c *connection) AcceptStream(ctx context.Context) (moqtransport.Stream, error) {
@@ -36,7 +76,11 @@ func (c *connection) AcceptStream(ctx context.Context) (moqtransport.Stream, err
 }
 
 func (c *connection) AcceptUniStream(ctx context.Context) (moqtransport.ReceiveStream, error) {
-	return c.connection.AcceptUniStream(ctx)
+	s, err := c.connection.AcceptUniStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &receiveStream{s}, nil
 }
 
 func (c *connection) SendDatagram(b []byte) error {
@@ -0,0 +1,185 @@
+package moqtransport
+
+import (
+	"context"
+	"sync"
+)
+
+// An OverflowPolicy decides what a RemoteTrack does with a new object when
+// its receive buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowPolicyBlock stops reading objects of the subscription until
+	// the application read an object from the buffer.
+	OverflowPolicyBlock OverflowPolicy = iota
+	// OverflowPolicyDropOldest drops the oldest buffered object.
+	OverflowPolicyDropOldest
+	// OverflowPolicyDropOldestGroup drops all buffered objects of the group
+	// of the oldest buffered object.
+	OverflowPolicyDropOldestGroup
+)
+
+// stopCodeObjectDropped is the error code used to cancel streams carrying the
+// payload of objects that were dropped before they were read.
+const stopCodeObjectDropped = 0x00
+
+// DefaultReceiveBufferSize is the number of objects a RemoteTrack buffers,
+// unless configured otherwise in SubscribeOptions.
+const DefaultReceiveBufferSize = 64
+
+// receiveBuffer is a bounded queue of received objects. Objects are pushed by
+// the goroutines reading streams and datagrams of a subscription and popped by
+// the application.
+type receiveBuffer struct {
+	lock    sync.Mutex
+	objects []remoteObject
+	size    int
+	policy  OverflowPolicy
+
+	received uint64
+	dropped  uint64
+
+	// readable and writable are signaled when an object was pushed or popped.
+	// Waiters that find the buffer still readable or writable pass the signal
+	// on, so that no waiter misses a change.
+	readable chan struct{}
+	writable chan struct{}
+}
+
+func newReceiveBuffer(size int, policy OverflowPolicy) *receiveBuffer {
+	if size <= 0 {
+		size = DefaultReceiveBufferSize
+	}
+	return &receiveBuffer{
+		lock:     sync.Mutex{},
+		objects:  []remoteObject{},
+		size:     size,
+		policy:   policy,
+		received: 0,
+		dropped:  0,
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+	}
+}
+
+// A payloadDiscarder is a payload that must be discarded if its object is
+// dropped, so that the stream carrying it is released.
+type payloadDiscarder interface {
+	discard()
+}
+
+// discard releases the payload of ro if it was not read.
+func (ro remoteObject) discard() {
+	if d, ok := ro.payload.(payloadDiscarder); ok {
+		d.discard()
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push adds ro to the buffer. If the buffer is full, push applies the overflow
+// policy of the buffer. With OverflowPolicyBlock, it blocks until there is
+// space in the buffer or done is closed. The payloads of dropped objects are
+// discarded.
+func (b *receiveBuffer) push(ro remoteObject, done <-chan struct{}) {
+	for {
+		b.lock.Lock()
+		if len(b.objects) >= b.size {
+			switch b.policy {
+			case OverflowPolicyDropOldest:
+				b.objects[0].discard()
+				b.objects[0] = remoteObject{}
+				b.objects = b.objects[1:]
+				b.dropped++
+			case OverflowPolicyDropOldestGroup:
+				b.dropGroup(b.objects[0].object.GroupID)
+			default:
+				b.lock.Unlock()
+				select {
+				case <-b.writable:
+					continue
+				case <-done:
+					ro.discard()
+					return
+				}
+			}
+		}
+		b.objects = append(b.objects, ro)
+		b.received++
+		writable := len(b.objects) < b.size
+		b.lock.Unlock()
+		signal(b.readable)
+		if writable {
+			signal(b.writable)
+		}
+		return
+	}
+}
+
+// dropGroup removes all objects of the group with groupID from the buffer. It
+// must be called with the lock held.
+func (b *receiveBuffer) dropGroup(groupID uint64) {
+	kept := b.objects[:0]
+	for _, ro := range b.objects {
+		if ro.object.GroupID == groupID {
+			ro.discard()
+			b.dropped++
+			continue
+		}
+		kept = append(kept, ro)
+	}
+	for i := len(kept); i < len(b.objects); i++ {
+		b.objects[i] = remoteObject{}
+	}
+	b.objects = kept
+}
+
+// pop removes and returns the oldest object from the buffer. If the buffer is
+// empty, it blocks until an object is pushed, ctx is done or done is closed.
+// Buffered objects are returned even if done is closed. ok is false if the
+// buffer is empty and done is closed.
+func (b *receiveBuffer) pop(ctx context.Context, done <-chan struct{}) (ro remoteObject, ok bool, err error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return remoteObject{}, false, err
+		}
+		b.lock.Lock()
+		if len(b.objects) > 0 {
+			ro = b.objects[0]
+			b.objects[0] = remoteObject{}
+			b.objects = b.objects[1:]
+			readable := len(b.objects) > 0
+			b.lock.Unlock()
+			signal(b.writable)
+			if readable {
+				signal(b.readable)
+			}
+			return ro, true, nil
+		}
+		b.lock.Unlock()
+		select {
+		case <-b.readable:
+		case <-ctx.Done():
+			return remoteObject{}, false, ctx.Err()
+		case <-done:
+			b.lock.Lock()
+			empty := len(b.objects) == 0
+			b.lock.Unlock()
+			if empty {
+				return remoteObject{}, false, nil
+			}
+		}
+	}
+}
+
+func (b *receiveBuffer) stats() (received, dropped uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.received, b.dropped
+}
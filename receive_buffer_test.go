@@ -0,0 +1,172 @@
+package moqtransport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveBuffer(t *testing.T) {
+	cases := []struct {
+		size          int
+		policy        OverflowPolicy
+		objects       []Object
+		expect        []Object
+		expectDropped uint64
+	}{
+		{
+			size:          2,
+			policy:        OverflowPolicyDropOldest,
+			objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}},
+			expect:        []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}},
+			expectDropped: 0,
+		},
+		{
+			size:          2,
+			policy:        OverflowPolicyDropOldest,
+			objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+			expect:        []Object{{GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+			expectDropped: 1,
+		},
+		{
+			size:          3,
+			policy:        OverflowPolicyDropOldestGroup,
+			objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+			expect:        []Object{{GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+			expectDropped: 2,
+		},
+		{
+			size:          2,
+			policy:        OverflowPolicyDropOldestGroup,
+			objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 0, ObjectID: 2}},
+			expect:        []Object{{GroupID: 0, ObjectID: 2}},
+			expectDropped: 2,
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			b := newReceiveBuffer(tc.size, tc.policy)
+			done := make(chan struct{})
+			for _, o := range tc.objects {
+				b.push(remoteObject{object: o, payload: nil}, done)
+			}
+			close(done)
+			res := []Object{}
+			for {
+				ro, ok, err := b.pop(context.Background(), done)
+				assert.NoError(t, err)
+				if !ok {
+					break
+				}
+				res = append(res, ro.object)
+			}
+			assert.Equal(t, tc.expect, res)
+			received, dropped := b.stats()
+			assert.Equal(t, uint64(len(tc.objects)), received)
+			assert.Equal(t, tc.expectDropped, dropped)
+		})
+	}
+	t.Run("block", func(t *testing.T) {
+		b := newReceiveBuffer(1, OverflowPolicyBlock)
+		done := make(chan struct{})
+		defer close(done)
+		b.push(remoteObject{object: Object{ObjectID: 0}, payload: nil}, done)
+		pushed := make(chan struct{})
+		go func() {
+			b.push(remoteObject{object: Object{ObjectID: 1}, payload: nil}, done)
+			close(pushed)
+		}()
+		select {
+		case <-pushed:
+			assert.Fail(t, "push did not block on full buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+		for i := 0; i < 2; i++ {
+			ro, ok, err := b.pop(context.Background(), done)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, uint64(i), ro.object.ObjectID)
+		}
+		<-pushed
+		_, dropped := b.stats()
+		assert.Equal(t, uint64(0), dropped)
+	})
+	t.Run("block_until_done", func(t *testing.T) {
+		b := newReceiveBuffer(1, OverflowPolicyBlock)
+		done := make(chan struct{})
+		b.push(remoteObject{object: Object{ObjectID: 0}, payload: nil}, done)
+		pushed := make(chan struct{})
+		go func() {
+			b.push(remoteObject{object: Object{ObjectID: 1}, payload: nil}, done)
+			close(pushed)
+		}()
+		close(done)
+		select {
+		case <-pushed:
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		}
+	})
+	for _, policy := range []OverflowPolicy{OverflowPolicyDropOldest, OverflowPolicyDropOldestGroup} {
+		t.Run(fmt.Sprintf("cancel_dropped_stream_payload_%v", policy), func(t *testing.T) {
+			b := newReceiveBuffer(1, policy)
+			done := make(chan struct{})
+			defer close(done)
+			counters := &objectCounters{}
+			stream := &cancelableReceiveStream{
+				Reader:   bytes.NewReader([]byte("payload")),
+				canceled: make(chan uint64, 1),
+			}
+			var closed atomic.Bool
+			payload := newCountingReader(stream, stream, counters, func() {
+				closed.Store(true)
+			})
+			assert.Equal(t, int64(1), counters.openStreams.Load())
+			b.push(remoteObject{object: Object{GroupID: 0, ObjectID: 0}, payload: payload}, done)
+			b.push(remoteObject{object: Object{GroupID: 1, ObjectID: 0}, payload: nil}, done)
+			select {
+			case code := <-stream.canceled:
+				assert.Equal(t, uint64(stopCodeObjectDropped), code)
+			default:
+				assert.Fail(t, "stream of dropped object not canceled")
+			}
+			assert.Equal(t, int64(0), counters.openStreams.Load())
+			assert.True(t, closed.Load())
+		})
+	}
+	t.Run("drain_dropped_stream_payload", func(t *testing.T) {
+		b := newReceiveBuffer(1, OverflowPolicyDropOldest)
+		done := make(chan struct{})
+		defer close(done)
+		counters := &objectCounters{}
+		stream := bytes.NewReader([]byte("payload"))
+		closed := make(chan struct{})
+		payload := newCountingReader(stream, stream, counters, func() {
+			close(closed)
+		})
+		b.push(remoteObject{object: Object{GroupID: 0, ObjectID: 0}, payload: payload}, done)
+		b.push(remoteObject{object: Object{GroupID: 0, ObjectID: 1}, payload: nil}, done)
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			assert.Fail(t, "stream of dropped object not drained")
+		}
+		assert.Equal(t, int64(0), counters.openStreams.Load())
+		assert.Equal(t, uint64(len("payload")), counters.bytes.Load())
+	})
+}
+
+type cancelableReceiveStream struct {
+	io.Reader
+	canceled chan uint64
+}
+
+func (s *cancelableReceiveStream) CancelRead(code uint64) {
+	s.canceled <- code
+}
@@ -1,46 +1,173 @@
 package moqtransport
 
 import (
+	"bytes"
 	"context"
-	"errors"
 	"io"
 	"log/slog"
+	"sync"
 
 	"github.com/mengelbart/moqtransport/internal/wire"
 )
 
+// A remoteObject is an object received on a subscription. If payload is not
+// nil, the payload of the object was not read yet and must be read from
+// payload.
+type remoteObject struct {
+	object  Object
+	payload io.Reader
+}
+
 type RemoteTrack struct {
-	logger     *slog.Logger
-	responseCh chan subscribeIDer
+	logger   *slog.Logger
+	response *pendingResponse[subscribeIDer]
 
 	session     *Session
 	subscribeID uint64
-	buffer      chan Object
+	trackAlias  uint64
+	namespace   string
+	trackname   string
+	buffer      *receiveBuffer
+	counters    objectCounters
 	closeCh     chan struct{}
+
+	windowLock sync.Mutex
+	window     deliveryWindow
+
+	// finalLock protects the largest location received and the final
+	// location the publisher announced in SUBSCRIBE_DONE. finalCh is closed
+	// when the final object was received.
+	finalLock   sync.Mutex
+	receivedAny bool
+	largest     location
+	final       location
+	finalCh     chan struct{}
+}
+
+// RemoteTrackStats are counters of the objects received on a RemoteTrack.
+// ReceivedObjects counts all objects added to the receive buffer and
+// DroppedObjects counts the objects dropped from the buffer because it
+// overflowed before the application read them.
+type RemoteTrackStats struct {
+	ReceivedObjects uint64
+	DroppedObjects  uint64
 }
 
-func newRemoteTrack(id uint64, s *Session) *RemoteTrack {
+func newRemoteTrack(id, trackAlias uint64, s *Session, bufferSize int, policy OverflowPolicy) *RemoteTrack {
 	t := &RemoteTrack{
 		logger:      defaultLogger.WithGroup("MOQ_REMOTE_TRACK"),
-		responseCh:  make(chan subscribeIDer),
+		response:    newPendingResponse[subscribeIDer](),
 		session:     s,
 		subscribeID: id,
-		buffer:      make(chan Object),
+		trackAlias:  trackAlias,
+		namespace:   "",
+		trackname:   "",
+		counters:    objectCounters{},
+		buffer:      newReceiveBuffer(bufferSize, policy),
 		closeCh:     make(chan struct{}),
+		windowLock:  sync.Mutex{},
+		window:      openDeliveryWindow(),
+		finalLock:   sync.Mutex{},
+		receivedAny: false,
+		largest:     location{},
+		final:       location{},
+		finalCh:     nil,
 	}
 	return t
 }
 
+// ReadObject returns the next object received on the track. It returns io.EOF
+// after the publisher ended the subscription and a SessionClosedError after the
+// session ended. Objects with a Status other than ObjectStatusNormal signal
+// missing objects or groups, the end of a group or the end of the track.
 func (t *RemoteTrack) ReadObject(ctx context.Context) (Object, error) {
-	select {
-	case <-ctx.Done():
-		return Object{}, ctx.Err()
-	case obj, ok := <-t.buffer:
-		if !ok {
-			return Object{}, errors.New("track closed")
+	ro, err := t.next(ctx)
+	if err != nil {
+		return Object{}, err
+	}
+	if ro.payload != nil {
+		ro.object.Payload, err = io.ReadAll(ro.payload)
+		if err != nil {
+			return Object{}, err
 		}
-		return obj, nil
 	}
+	return ro.object, nil
+}
+
+// AcceptObject is like ReadObject, but it returns the next object without
+// reading its payload. The payload of the object can be read from the returned
+// reader. Payloads of objects sent on separate streams are read directly from
+// the stream, which avoids holding large objects in memory. The payload must
+// be read before the payload of the next object is read.
+func (t *RemoteTrack) AcceptObject(ctx context.Context) (Object, io.Reader, error) {
+	ro, err := t.next(ctx)
+	if err != nil {
+		return Object{}, nil, err
+	}
+	if ro.payload != nil {
+		return ro.object, ro.payload, nil
+	}
+	payload := ro.object.Payload
+	ro.object.Payload = nil
+	return ro.object, bytes.NewReader(payload), nil
+}
+
+// next returns the next buffered object. Objects buffered before the
+// subscription ended are still returned.
+func (t *RemoteTrack) next(ctx context.Context) (remoteObject, error) {
+	ro, ok, err := t.buffer.pop(ctx, t.closeCh)
+	if err != nil {
+		return remoteObject{}, err
+	}
+	if !ok {
+		if err := t.session.Err(); err != nil {
+			return remoteObject{}, t.session.closedError()
+		}
+		return remoteObject{}, io.EOF
+	}
+	return ro, nil
+}
+
+// Stats returns the counters of objects received on the track.
+func (t *RemoteTrack) Stats() RemoteTrackStats {
+	received, dropped := t.buffer.stats()
+	return RemoteTrackStats{
+		ReceivedObjects: received,
+		DroppedObjects:  dropped,
+	}
+}
+
+// Update narrows the range of objects requested by the subscription and sets a
+// new subscriber priority. As in the SUBSCRIBE_UPDATE message, endGroup and
+// endObject are one larger than the last requested group and object ID. An
+// endGroup of 0 leaves the subscription open-ended and an endObject of 0
+// requests the entire end group. Updates can only narrow the subscription,
+// i.e., the start must not move backwards and the end must not move forwards.
+// Subscriptions using the latest group or latest object filter start at the
+// location the publisher resolved when it accepted the subscription.
+func (t *RemoteTrack) Update(ctx context.Context, startGroup, startObject, endGroup, endObject uint64, priority uint8) error {
+	t.windowLock.Lock()
+	defer t.windowLock.Unlock()
+	w := newDeliveryWindow(startGroup, startObject, endGroup, endObject)
+	if err := t.window.narrow(w); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := t.session.subscribeUpdate(&wire.SubscribeUpdateMessage{
+		SubscribeID:        t.subscribeID,
+		StartGroup:         startGroup,
+		StartObject:        startObject,
+		EndGroup:           endGroup,
+		EndObject:          endObject,
+		SubscriberPriority: priority,
+		Parameters:         wire.Parameters{},
+	}); err != nil {
+		return err
+	}
+	t.window = w
+	return nil
 }
 
 func (t *RemoteTrack) Unsubscribe() {
@@ -53,15 +180,74 @@ func (t *RemoteTrack) close() {
 
 func (t *RemoteTrack) push(o Object) {
 	t.logger.Info("push object", "object", o)
+	t.counters.bytes.Add(uint64(len(o.Payload)))
+	t.session.si.tracer.ObjectReceived(newObjectEvent(t.subscribeID, t.trackAlias, o, len(o.Payload)))
+	t.pushObject(remoteObject{
+		object:  o,
+		payload: nil,
+	})
+}
+
+// pushStream pushes an object whose payload is read from payload.
+func (t *RemoteTrack) pushStream(header Object, payload io.Reader) {
+	t.logger.Info("push object stream", "object", header)
+	t.session.si.tracer.ObjectReceived(newObjectEvent(t.subscribeID, t.trackAlias, header, -1))
+	t.pushObject(remoteObject{
+		object:  header,
+		payload: payload,
+	})
+}
+
+func (t *RemoteTrack) pushObject(ro remoteObject) {
 	select {
-	case t.buffer <- o:
 	case <-t.closeCh:
+		ro.discard()
+		return
+	default:
+	}
+	t.buffer.push(ro, t.closeCh)
+	t.received(location{group: ro.object.GroupID, object: ro.object.ObjectID})
+}
+
+// received records the location of a received object and signals the final
+// object, if it was announced.
+func (t *RemoteTrack) received(l location) {
+	t.finalLock.Lock()
+	defer t.finalLock.Unlock()
+	if !t.receivedAny || t.largest.less(l) {
+		t.largest = l
+	}
+	t.receivedAny = true
+	t.signalFinal()
+}
+
+// finalReceived returns a channel which is closed when the object at final or
+// any later object was received.
+func (t *RemoteTrack) finalReceived(final location) <-chan struct{} {
+	t.finalLock.Lock()
+	defer t.finalLock.Unlock()
+	ch := make(chan struct{})
+	t.final = final
+	t.finalCh = ch
+	t.signalFinal()
+	return ch
+}
+
+// signalFinal closes finalCh if the final object was received. finalLock must
+// be held.
+func (t *RemoteTrack) signalFinal() {
+	if t.finalCh == nil || !t.receivedAny || t.largest.less(t.final) {
+		return
 	}
+	close(t.finalCh)
+	t.finalCh = nil
 }
 
 func (t *RemoteTrack) readObjectStream(p *wire.ObjectStreamParser) {
 	t.logger.Info("reading object stream")
 	defer t.logger.Info("finished reading object stream")
+	t.counters.openStreams.Add(1)
+	defer t.counters.openStreams.Add(-1)
 	for {
 		msg, err := p.Parse()
 		if err != nil {
@@ -77,6 +263,7 @@ func (t *RemoteTrack) readObjectStream(p *wire.ObjectStreamParser) {
 			ObjectID:             msg.ObjectID,
 			PublisherPriority:    msg.PublisherPriority,
 			ForwardingPreference: objectForwardingPreferenceFromMessageType(msg.Type),
+			Status:               msg.ObjectStatus,
 			Payload:              msg.ObjectPayload,
 		})
 	}
@@ -0,0 +1,102 @@
+package moqtransport
+
+import (
+	"time"
+)
+
+// A SendQueuePolicy decides what a subscription does with a new object when
+// its send queue is full.
+type SendQueuePolicy int
+
+const (
+	// SendQueuePolicyDropNewest drops the new object.
+	SendQueuePolicyDropNewest SendQueuePolicy = iota
+	// SendQueuePolicyDropOldest drops the oldest queued object.
+	SendQueuePolicyDropOldest
+	// SendQueuePolicyDropStaleGroups drops all queued objects of groups older
+	// than the group of the new object. If there are none, the new object is
+	// dropped.
+	SendQueuePolicyDropStaleGroups
+	// SendQueuePolicyBlock waits until there is space in the queue or the
+	// deadline configured by WithSendQueueDeadline passed, in which case the
+	// new object is dropped. Waiting blocks the LocalTrack and thereby all
+	// other subscribers of the track.
+	SendQueuePolicyBlock
+)
+
+// DefaultSendQueueSize is the number of objects a subscription queues for
+// sending, unless configured otherwise using WithSendQueueSize.
+const DefaultSendQueueSize = 1024
+
+// DefaultSendQueueDeadline is the time a subscription with
+// SendQueuePolicyBlock waits for space in its send queue, unless configured
+// otherwise using WithSendQueueDeadline.
+const DefaultSendQueueDeadline = 100 * time.Millisecond
+
+// sendQueueConfig configures the queue of objects a subscription accepted
+// from a track but did not send yet.
+type sendQueueConfig struct {
+	size     int
+	policy   SendQueuePolicy
+	deadline time.Duration
+}
+
+func defaultSendQueueConfig() sendQueueConfig {
+	return sendQueueConfig{
+		size:     DefaultSendQueueSize,
+		policy:   SendQueuePolicyDropNewest,
+		deadline: DefaultSendQueueDeadline,
+	}
+}
+
+// An AcceptOption configures a subscription accepted by
+// SubscriptionResponseWriter.Accept.
+type AcceptOption func(*sendQueueConfig)
+
+// WithSendQueueSize sets the number of objects the subscription queues for
+// sending to n.
+func WithSendQueueSize(n int) AcceptOption {
+	return func(c *sendQueueConfig) {
+		if n > 0 {
+			c.size = n
+		}
+	}
+}
+
+// WithSendQueuePolicy sets what the subscription does with new objects if its
+// send queue is full.
+func WithSendQueuePolicy(p SendQueuePolicy) AcceptOption {
+	return func(c *sendQueueConfig) {
+		c.policy = p
+	}
+}
+
+// WithSendQueueDeadline sets the time a subscription with
+// SendQueuePolicyBlock waits for space in its send queue before it drops a
+// new object.
+func WithSendQueueDeadline(d time.Duration) AcceptOption {
+	return func(c *sendQueueConfig) {
+		if d > 0 {
+			c.deadline = d
+		}
+	}
+}
+
+// A queuedObject is an object accepted by a subscription. It stays in the
+// send queue until it was sent or dropped.
+type queuedObject struct {
+	object  Object
+	dropped bool
+}
+
+// SendSubscriptionStats are counters of the objects of a subscription of the
+// peer to a local track. QueuedObjects is the number of objects currently
+// waiting to be sent and DroppedObjects counts the objects dropped because the
+// send queue overflowed.
+type SendSubscriptionStats struct {
+	SubscribeID    uint64
+	Namespace      string
+	TrackName      string
+	QueuedObjects  int
+	DroppedObjects uint64
+}
@@ -0,0 +1,163 @@
+package moqtransport
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// A sendJob is a pending write of an object of a subscription.
+type sendJob struct {
+	subscribeID        uint64
+	subscriberPriority uint8
+	publisherPriority  uint8
+	groupOrder         uint8
+	groupID            uint64
+	seq                uint64
+	send               func()
+}
+
+// before reports whether j should be sent before o. Lower subscriber
+// priorities are sent first, then lower publisher priorities. Objects of the
+// same subscription are ordered by group according to the group order of the
+// subscription. All other objects are sent in the order they were scheduled.
+func (j *sendJob) before(o *sendJob) bool {
+	if j.subscriberPriority != o.subscriberPriority {
+		return j.subscriberPriority < o.subscriberPriority
+	}
+	if j.publisherPriority != o.publisherPriority {
+		return j.publisherPriority < o.publisherPriority
+	}
+	if j.subscribeID == o.subscribeID && j.groupID != o.groupID {
+		if j.groupOrder == GroupOrderDescending {
+			return j.groupID > o.groupID
+		}
+		return j.groupID < o.groupID
+	}
+	return j.seq < o.seq
+}
+
+type sendQueue []*sendJob
+
+func (q sendQueue) Len() int           { return len(q) }
+func (q sendQueue) Less(i, j int) bool { return q[i].before(q[j]) }
+func (q sendQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *sendQueue) Push(x any) {
+	*q = append(*q, x.(*sendJob))
+}
+
+func (q *sendQueue) Pop() any {
+	old := *q
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return job
+}
+
+// sendStallTimeout is the time after which a running job no longer holds back
+// jobs of other subscriptions, e.g. because its write is blocked by flow
+// control of its stream.
+const sendStallTimeout = 100 * time.Millisecond
+
+// sendScheduler orders the object writes of all subscriptions of a session
+// by priority. Only one job writes at a time, so that on a constrained link
+// the job with the highest priority gets all of the bandwidth. The writes of
+// a subscription run one at a time, because they share the streams of the
+// subscription. If a job runs longer than sendStallTimeout, the scheduler
+// starts the next job in the order of priority, so that a write blocked by
+// flow control of one stream does not stall the other subscriptions.
+type sendScheduler struct {
+	lock    sync.Mutex
+	queue   sendQueue
+	nextSeq uint64
+
+	// busy contains the subscriptions with a running job, active counts the
+	// running jobs that did not stall.
+	busy   map[uint64]struct{}
+	active int
+	closed bool
+}
+
+func newSendScheduler() *sendScheduler {
+	return &sendScheduler{
+		lock:    sync.Mutex{},
+		queue:   sendQueue{},
+		nextSeq: 0,
+		busy:    map[uint64]struct{}{},
+		active:  0,
+		closed:  false,
+	}
+}
+
+func (s *sendScheduler) schedule(job *sendJob) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	job.seq = s.nextSeq
+	s.nextSeq++
+	heap.Push(&s.queue, job)
+	s.dispatch()
+}
+
+// dispatch starts the pending job with the highest priority whose
+// subscription has no running job, unless another job is active. It must be
+// called with the lock held.
+func (s *sendScheduler) dispatch() {
+	waiting := []*sendJob{}
+	for s.active == 0 && s.queue.Len() > 0 {
+		job := heap.Pop(&s.queue).(*sendJob)
+		if _, ok := s.busy[job.subscribeID]; ok {
+			waiting = append(waiting, job)
+			continue
+		}
+		s.busy[job.subscribeID] = struct{}{}
+		s.active++
+		go s.run(job)
+	}
+	for _, job := range waiting {
+		heap.Push(&s.queue, job)
+	}
+}
+
+func (s *sendScheduler) run(job *sendJob) {
+	// done and stalled are protected by the lock of the scheduler.
+	done := false
+	stalled := false
+	timer := time.AfterFunc(sendStallTimeout, func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if done {
+			return
+		}
+		stalled = true
+		s.active--
+		if !s.closed {
+			s.dispatch()
+		}
+	})
+	job.send()
+	timer.Stop()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	done = true
+	if !stalled {
+		s.active--
+	}
+	delete(s.busy, job.subscribeID)
+	if !s.closed {
+		s.dispatch()
+	}
+}
+
+// close drops all pending jobs. Jobs scheduled after close are ignored.
+// Running jobs are not interrupted.
+func (s *sendScheduler) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	s.queue = sendQueue{}
+}
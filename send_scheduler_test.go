@@ -0,0 +1,200 @@
+package moqtransport
+
+import (
+	"container/heap"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendQueue(t *testing.T) {
+	cases := []struct {
+		jobs   []*sendJob
+		expect []int
+	}{
+		{
+			jobs:   []*sendJob{},
+			expect: []int{},
+		},
+		{
+			jobs: []*sendJob{
+				{subscribeID: 1, subscriberPriority: 2},
+				{subscribeID: 2, subscriberPriority: 1},
+			},
+			expect: []int{1, 0},
+		},
+		{
+			jobs: []*sendJob{
+				{subscribeID: 1, subscriberPriority: 1, publisherPriority: 2},
+				{subscribeID: 2, subscriberPriority: 1, publisherPriority: 1},
+				{subscribeID: 3, subscriberPriority: 0, publisherPriority: 3},
+			},
+			expect: []int{2, 1, 0},
+		},
+		{
+			jobs: []*sendJob{
+				{subscribeID: 1, groupOrder: GroupOrderAscending, groupID: 2},
+				{subscribeID: 1, groupOrder: GroupOrderAscending, groupID: 1},
+				{subscribeID: 1, groupOrder: GroupOrderAscending, groupID: 1},
+			},
+			expect: []int{1, 2, 0},
+		},
+		{
+			jobs: []*sendJob{
+				{subscribeID: 1, groupOrder: GroupOrderDescending, groupID: 1},
+				{subscribeID: 1, groupOrder: GroupOrderDescending, groupID: 2},
+				{subscribeID: 1, groupOrder: GroupOrderDescending, groupID: 2},
+			},
+			expect: []int{1, 2, 0},
+		},
+		{
+			jobs: []*sendJob{
+				{subscribeID: 1, groupOrder: GroupOrderAscending, groupID: 2},
+				{subscribeID: 2, groupOrder: GroupOrderAscending, groupID: 1},
+			},
+			expect: []int{0, 1},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			q := sendQueue{}
+			for seq, job := range tc.jobs {
+				job.seq = uint64(seq)
+				heap.Push(&q, job)
+			}
+			res := []int{}
+			for q.Len() > 0 {
+				res = append(res, int(heap.Pop(&q).(*sendJob).seq))
+			}
+			assert.Equal(t, tc.expect, res)
+		})
+	}
+}
+
+func TestSendScheduler(t *testing.T) {
+	t.Run("blocked_subscription", func(t *testing.T) {
+		s := newSendScheduler()
+		defer s.close()
+		unblock := make(chan struct{})
+		done := make(chan struct{})
+		s.schedule(&sendJob{
+			subscribeID: 1,
+			send: func() {
+				<-unblock
+			},
+		})
+		s.schedule(&sendJob{
+			subscribeID: 2,
+			send: func() {
+				close(done)
+			},
+		})
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "job blocked by other subscription")
+		case <-done:
+		}
+		close(unblock)
+	})
+	t.Run("serialize_subscription", func(t *testing.T) {
+		s := newSendScheduler()
+		defer s.close()
+		unblock := make(chan struct{})
+		var running atomic.Bool
+		done := make(chan int, 2)
+		for i := 0; i < 2; i++ {
+			s.schedule(&sendJob{
+				subscribeID: 1,
+				send: func() {
+					assert.False(t, running.Swap(true))
+					if i == 0 {
+						<-unblock
+					}
+					running.Store(false)
+					done <- i
+				},
+			})
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case i := <-done:
+			assert.Fail(t, "job ran before previous job of subscription finished", "job %v", i)
+		}
+		close(unblock)
+		for i := 0; i < 2; i++ {
+			select {
+			case <-time.After(time.Second):
+				assert.Fail(t, "test timed out")
+			case j := <-done:
+				assert.Equal(t, i, j)
+			}
+		}
+	})
+	t.Run("priority_across_subscriptions", func(t *testing.T) {
+		s := newSendScheduler()
+		defer s.close()
+		unblock := make(chan struct{})
+		s.schedule(&sendJob{
+			subscribeID: 0,
+			send: func() {
+				<-unblock
+			},
+		})
+		sent := make(chan uint64, 6)
+		for i := 0; i < 3; i++ {
+			for _, id := range []uint64{2, 1} {
+				s.schedule(&sendJob{
+					subscribeID:        id,
+					subscriberPriority: uint8(id),
+					send: func() {
+						sent <- id
+					},
+				})
+			}
+		}
+		close(unblock)
+		res := []uint64{}
+		for len(res) < 6 {
+			select {
+			case <-time.After(time.Second):
+				assert.Fail(t, "test timed out")
+				return
+			case id := <-sent:
+				res = append(res, id)
+			}
+		}
+		assert.Equal(t, []uint64{1, 1, 1, 2, 2, 2}, res)
+	})
+	t.Run("stalled_job", func(t *testing.T) {
+		s := newSendScheduler()
+		defer s.close()
+		unblock := make(chan struct{})
+		defer close(unblock)
+		s.schedule(&sendJob{
+			subscribeID: 1,
+			send: func() {
+				<-unblock
+			},
+		})
+		done := make(chan struct{})
+		s.schedule(&sendJob{
+			subscribeID: 2,
+			send: func() {
+				close(done)
+			},
+		})
+		select {
+		case <-time.After(sendStallTimeout / 2):
+		case <-done:
+			assert.Fail(t, "job ran while another job was active")
+		}
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "job blocked by stalled job")
+		case <-done:
+		}
+	})
+}
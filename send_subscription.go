@@ -3,8 +3,11 @@ package moqtransport
 import (
 	"context"
 	"errors"
+	"io"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mengelbart/moqtransport/internal/wire"
 	"github.com/quic-go/quic-go"
@@ -18,81 +21,487 @@ type sendSubscription struct {
 	cancelWG  sync.WaitGroup
 	ctx       context.Context
 
+	trackLock               sync.Mutex
+	track                   *LocalTrack
 	subscriptionIDinTrack   subscriberID
 	subscribeID, trackAlias uint64
 	namespace, trackname    string
 	conn                    Connection
-	objectCh                chan Object
+	version                 wire.Version
+	tracer                  Tracer
+	scheduler               *sendScheduler
+	objectCh                chan *queuedObject
+	sentCh                  chan sendResult
 	trackHeaderStream       *trackHeaderStream
+	groupStreams            groupStreamConfig
 	groupHeaderStreams      map[uint64]*groupHeaderStream
+	newestGroup             uint64
+	hasGroupStream          bool
+
+	// onDone is called in a new goroutine once the subscription reached the
+	// end of its delivery window or failed to send an object.
+	onDone   func(statusCode uint64, reason string)
+	ended    bool
+	stopped  atomic.Bool
+	err      error
+	sentAny  bool
+	lastSent location
+
+	// windowLock protects the window, its start when the subscription was
+	// added to the track and the largest location of the track at that time,
+	// which is sent in SUBSCRIBE_OK.
+	windowLock         sync.Mutex
+	window             deliveryWindow
+	resolvedStart      location
+	largest            location
+	contentExists      bool
+	filterType         FilterType
+	subscriberPriority uint8
+	groupOrder         uint8
+
+	// queue holds the objects accepted by WriteObject until they are sent or
+	// dropped, in the order they were accepted.
+	queueLock   sync.Mutex
+	queueConfig sendQueueConfig
+	queue       []*queuedObject
+	dequeued    chan struct{}
+	dropped     atomic.Uint64
+
+	counters objectCounters
 }
 
-func newSendSubscription(conn Connection, subscribeID, trackAlias uint64, namespace, trackname string) *sendSubscription {
+// A sendResult reports the outcome of a scheduled object write back to the
+// loop of the subscription.
+type sendResult struct {
+	object Object
+	err    error
+}
+
+func newSendSubscription(conn Connection, scheduler *sendScheduler, sub *Subscription, groupStreams groupStreamConfig, queueConfig sendQueueConfig, version wire.Version, tracer Tracer, onDone func(uint64, string)) *sendSubscription {
+	groupOrder := sub.GroupOrder
+	if groupOrder == GroupOrderPublisher {
+		groupOrder = GroupOrderAscending
+	}
 	ctx, cancelCtx := context.WithCancel(context.Background())
-	sub := &sendSubscription{
+	s := &sendSubscription{
 		logger: defaultLogger.WithGroup("MOQ_SEND_SUBSCRIPTION").With(
-			"namespace", namespace,
-			"trackname", trackname,
+			"namespace", sub.Namespace,
+			"trackname", sub.TrackName,
 		),
 		cancelCtx:             cancelCtx,
 		cancelWG:              sync.WaitGroup{},
 		ctx:                   ctx,
+		trackLock:             sync.Mutex{},
+		track:                 nil,
 		subscriptionIDinTrack: -1,
-		subscribeID:           subscribeID,
-		trackAlias:            trackAlias,
-		namespace:             namespace,
-		trackname:             trackname,
+		subscribeID:           sub.ID,
+		trackAlias:            sub.TrackAlias,
+		namespace:             sub.Namespace,
+		trackname:             sub.TrackName,
 		conn:                  conn,
-		objectCh:              make(chan Object, 1024),
+		version:               version,
+		tracer:                tracer,
+		scheduler:             scheduler,
+		objectCh:              make(chan *queuedObject, queueConfig.size),
+		sentCh:                make(chan sendResult, 1024),
 		trackHeaderStream:     nil,
+		groupStreams:          groupStreams,
 		groupHeaderStreams:    map[uint64]*groupHeaderStream{},
+		newestGroup:           0,
+		hasGroupStream:        false,
+		onDone:                onDone,
+		ended:                 false,
+		stopped:               atomic.Bool{},
+		err:                   nil,
+		sentAny:               false,
+		lastSent:              location{},
+		windowLock:            sync.Mutex{},
+		window:                sub.window(),
+		resolvedStart:         sub.window().start,
+		largest:               location{},
+		contentExists:         false,
+		filterType:            sub.FilterType,
+		subscriberPriority:    sub.SubscriberPriority,
+		groupOrder:            groupOrder,
+		queueLock:             sync.Mutex{},
+		queueConfig:           queueConfig,
+		queue:                 []*queuedObject{},
+		dequeued:              make(chan struct{}, 1),
+		dropped:               atomic.Uint64{},
+		counters:              objectCounters{},
 	}
-	sub.cancelWG.Add(1)
-	go sub.loop()
-	return sub
+	s.cancelWG.Add(1)
+	go s.loop()
+	return s
 }
 
 func (s *sendSubscription) loop() {
 	defer s.cancelWG.Done()
 	for {
 		select {
-		case o := <-s.objectCh:
-			s.sendObject(o)
+		case q := <-s.objectCh:
+			s.handleObject(q)
+		case r := <-s.sentCh:
+			s.handleSent(r)
 		case <-s.ctx.Done():
 			return
 		}
 	}
 }
 
-func (s *sendSubscription) sendObject(o Object) {
+func (s *sendSubscription) setTrack(t *LocalTrack, id subscriberID) {
+	s.trackLock.Lock()
+	defer s.trackLock.Unlock()
+	s.track = t
+	s.subscriptionIDinTrack = id
+}
+
+func (s *sendSubscription) localTrack() *LocalTrack {
+	s.trackLock.Lock()
+	defer s.trackLock.Unlock()
+	return s.track
+}
+
+// unsubscribeFromTrack removes the subscription from the track it was added
+// to, if any.
+func (s *sendSubscription) unsubscribeFromTrack() {
+	s.trackLock.Lock()
+	t, id := s.track, s.subscriptionIDinTrack
+	s.trackLock.Unlock()
+	if t != nil {
+		t.unsubscribe(id)
+	}
+}
+
+func (s *sendSubscription) getWindow() deliveryWindow {
+	s.windowLock.Lock()
+	defer s.windowLock.Unlock()
+	return s.window
+}
+
+func (s *sendSubscription) inWindow(o Object) bool {
+	return s.getWindow().contains(location{group: o.GroupID, object: o.ObjectID})
+}
+
+// startAtLatest resolves the start of the delivery window of subscriptions
+// with FilterTypeLatestGroup or FilterTypeLatestObject. It implements
+// latestStarter.
+func (s *sendSubscription) startAtLatest(largest location, hasObjects bool) {
+	s.windowLock.Lock()
+	defer s.windowLock.Unlock()
+	s.window = s.window.startAtLatest(s.filterType, largest, hasObjects)
+	s.resolvedStart = s.window.start
+	s.largest = largest
+	s.contentExists = hasObjects
+}
+
+// latest returns the largest location of the track when the subscription was
+// added and whether the track had any objects.
+func (s *sendSubscription) latest() (location, bool) {
+	s.windowLock.Lock()
+	defer s.windowLock.Unlock()
+	return s.largest, s.contentExists
+}
+
+// update narrows the delivery window of the subscription and sets a new
+// subscriber priority. A start before the resolved start of the window is
+// moved to the resolved start, because the subscriber may not have known the
+// resolved start when it sent the update.
+func (s *sendSubscription) update(w deliveryWindow, subscriberPriority uint8) error {
+	s.windowLock.Lock()
+	defer s.windowLock.Unlock()
+	if w.start.less(s.resolvedStart) {
+		w.start = s.resolvedStart
+	}
+	if err := s.window.narrow(w); err != nil {
+		return err
+	}
+	s.window = w
+	s.subscriberPriority = subscriberPriority
+	return nil
+}
+
+func (s *sendSubscription) getSubscriberPriority() uint8 {
+	s.windowLock.Lock()
+	defer s.windowLock.Unlock()
+	return s.subscriberPriority
+}
+
+// end marks the subscription as ended and notifies the session. It must only be
+// called from the loop.
+func (s *sendSubscription) end(statusCode uint64, reason string) {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.logger.Info("subscription ended", "reason", reason)
+	if s.onDone != nil {
+		go s.onDone(statusCode, reason)
+	}
+}
+
+// fail marks the subscription as ended because sending an object failed and
+// notifies the session. It must only be called from the loop.
+func (s *sendSubscription) fail(err error) {
+	if s.ended {
+		return
+	}
+	s.ended = true
+	s.stopped.Store(true)
+	s.err = err
+	s.logger.Error("failed to send object", "error", err)
+	if s.onDone != nil {
+		go s.onDone(SubscribeStatusInternalError, err.Error())
+	}
+}
+
+// failure returns the error that ended the subscription, if any. It must not
+// be called before the subscription was closed.
+func (s *sendSubscription) failure() error {
+	return s.err
+}
+
+// finalLocation returns the location of the largest object sent on the
+// subscription, if any. The end of track counts as an object, so that
+// subscribers wait for it. It must not be called before the subscription was
+// closed.
+func (s *sendSubscription) finalLocation() (location, bool) {
+	return s.lastSent, s.sentAny
+}
+
+func (s *sendSubscription) handleObject(q *queuedObject) {
+	o := q.object
+	if s.ended {
+		s.dequeue(q)
+		return
+	}
+	l := location{group: o.GroupID, object: o.ObjectID}
+	w := s.getWindow()
+	if w.passed(l) {
+		s.dequeue(q)
+		s.end(SubscribeStatusSubscriptionEnded, "end of subscription range reached")
+		return
+	}
+	if !w.contains(l) {
+		s.dequeue(q)
+		s.logger.Info("skipping object outside of delivery window", "group-id", o.GroupID, "object-id", o.ObjectID)
+		return
+	}
+	s.scheduler.schedule(&sendJob{
+		subscribeID:        s.subscribeID,
+		subscriberPriority: s.getSubscriberPriority(),
+		publisherPriority:  o.PublisherPriority,
+		groupOrder:         s.groupOrder,
+		groupID:            o.GroupID,
+		seq:                0,
+		send: func() {
+			if !s.dequeue(q) || s.stopped.Load() || s.ctx.Err() != nil {
+				return
+			}
+			err := s.sendObject(o)
+			if err == nil {
+				s.counters.addObject(len(o.Payload))
+				s.tracer.ObjectSent(newObjectEvent(s.subscribeID, s.trackAlias, o, len(o.Payload)))
+			}
+			s.reportSent(o, err)
+		},
+	})
+}
+
+// dequeue removes q from the send queue. It returns false if q was dropped
+// before.
+func (s *sendSubscription) dequeue(q *queuedObject) bool {
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	if q.dropped {
+		return false
+	}
+	for i, other := range s.queue {
+		if other == q {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	signal(s.dequeued)
+	return true
+}
+
+// enqueue adds q to the send queue. If the queue is full, enqueue applies the
+// policy of the queue. It returns false if q was dropped.
+func (s *sendSubscription) enqueue(q *queuedObject) bool {
+	var deadline <-chan time.Time
+	s.queueLock.Lock()
+	defer s.queueLock.Unlock()
+	for len(s.queue) >= s.queueConfig.size {
+		switch s.queueConfig.policy {
+		case SendQueuePolicyDropOldest:
+			s.drop(s.queue[0])
+			s.queue = s.queue[1:]
+		case SendQueuePolicyDropStaleGroups:
+			kept := s.queue[:0]
+			for _, other := range s.queue {
+				if other.object.GroupID < q.object.GroupID {
+					s.drop(other)
+					continue
+				}
+				kept = append(kept, other)
+			}
+			s.queue = kept
+			if len(s.queue) >= s.queueConfig.size {
+				s.drop(q)
+				return false
+			}
+		case SendQueuePolicyBlock:
+			if deadline == nil {
+				deadline = time.After(s.queueConfig.deadline)
+			}
+			s.queueLock.Unlock()
+			expired := false
+			select {
+			case <-s.dequeued:
+			case <-deadline:
+				expired = true
+			case <-s.ctx.Done():
+				expired = true
+			}
+			s.queueLock.Lock()
+			if expired && len(s.queue) >= s.queueConfig.size {
+				s.drop(q)
+				return false
+			}
+		default:
+			s.drop(q)
+			return false
+		}
+	}
+	s.queue = append(s.queue, q)
+	if len(s.queue) < s.queueConfig.size {
+		// Pass on the signal to other writers waiting for space.
+		signal(s.dequeued)
+	}
+	return true
+}
+
+// drop marks q as dropped. It must be called with the queue lock held.
+func (s *sendSubscription) drop(q *queuedObject) {
+	q.dropped = true
+	s.dropped.Add(1)
+	s.logger.Warn("send subscription dropped object", "group-id", q.object.GroupID, "object-id", q.object.ObjectID)
+}
+
+// stats returns the counters of the send queue of the subscription.
+func (s *sendSubscription) stats() SendSubscriptionStats {
+	s.queueLock.Lock()
+	queued := len(s.queue)
+	s.queueLock.Unlock()
+	return SendSubscriptionStats{
+		SubscribeID:    s.subscribeID,
+		Namespace:      s.namespace,
+		TrackName:      s.trackname,
+		QueuedObjects:  queued,
+		DroppedObjects: s.dropped.Load(),
+	}
+}
+
+// reportSent hands the outcome of writing o to the loop.
+func (s *sendSubscription) reportSent(o Object, err error) {
+	select {
+	case s.sentCh <- sendResult{object: o, err: err}:
+	case <-s.ctx.Done():
+	}
+}
+
+// openObjectStream opens an object stream for the object with the given header
+// and returns a writer of its payload. Unlike objects passed to WriteObject,
+// the object is not scheduled and the caller writes the payload directly to
+// the stream. It returns a nil writer if the object is outside of the delivery
+// window or the stream could not be opened, in which case the subscription
+// fails.
+func (s *sendSubscription) openObjectStream(header Object) (io.WriteCloser, error) {
+	if s.stopped.Load() || s.ctx.Err() != nil {
+		return nil, errUnsubscribed
+	}
+	if !s.inWindow(header) {
+		return nil, nil
+	}
+	stream, err := s.openUniStream(header)
+	if err != nil {
+		s.reportSent(header, err)
+		return nil, nil
+	}
+	os, err := newObjectStream(stream, s.version, s.subscribeID, s.trackAlias, header.GroupID, header.ObjectID, header.PublisherPriority, header.Status)
+	if err != nil {
+		s.reportSent(header, err)
+		return nil, nil
+	}
+	return &objectPayloadWriter{
+		subscription: s,
+		header:       header,
+		stream:       os,
+		written:      0,
+		err:          nil,
+	}, nil
+}
+
+// handleSent records the outcome of a scheduled object write. It must only be
+// called from the loop.
+func (s *sendSubscription) handleSent(r sendResult) {
+	if s.ended {
+		return
+	}
+	if r.err != nil {
+		s.fail(r.err)
+		return
+	}
+	l := location{group: r.object.GroupID, object: r.object.ObjectID}
+	switch r.object.Status {
+	case ObjectStatusNormal, ObjectStatusObjectDoesNotExist, ObjectStatusEndOfTrack:
+		if !s.sentAny || s.lastSent.less(l) {
+			s.lastSent = l
+		}
+		s.sentAny = true
+	}
+	if r.object.Status == ObjectStatusEndOfTrack {
+		s.end(SubscribeStatusTrackEnded, "track ended")
+		return
+	}
+	if s.getWindow().last(l, r.object.Status) {
+		s.end(SubscribeStatusSubscriptionEnded, "end of subscription range reached")
+	}
+}
+
+func (s *sendSubscription) sendObject(o Object) error {
 	s.logger.Info("sending object", "group-id", o.GroupID, "object-id", o.ObjectID)
 	switch o.ForwardingPreference {
 	case ObjectForwardingPreferenceDatagram:
-		if err := s.sendDatagram(o); err != nil {
-			panic(err)
-		}
+		return s.sendDatagram(o)
 	case ObjectForwardingPreferenceStream:
-		if err := s.sendObjectStream(o); err != nil {
-			panic(err)
-		}
+		return s.sendObjectStream(o)
 	case ObjectForwardingPreferenceStreamGroup:
-		if err := s.sendGroupHeaderStream(o); err != nil {
-			panic(err)
-		}
+		return s.sendGroupHeaderStream(o)
 	case ObjectForwardingPreferenceStreamTrack:
-		if err := s.sendTrackHeaderStream(o); err != nil {
-			panic(err)
-		}
+		return s.sendTrackHeaderStream(o)
 	}
+	return nil
 }
 
+// WriteObject queues o for sending. If the send queue is full, WriteObject
+// applies the policy of the queue.
 func (s *sendSubscription) WriteObject(o Object) error {
+	if s.ctx.Err() != nil {
+		return errUnsubscribed
+	}
+	q := &queuedObject{
+		object:  o,
+		dropped: false,
+	}
+	if !s.enqueue(q) {
+		return nil
+	}
 	select {
-	case s.objectCh <- o:
+	case s.objectCh <- q:
 	case <-s.ctx.Done():
 		return errUnsubscribed
-	default:
-		s.logger.Warn("send subscription dropped object", "group-id", o.GroupID, "object-id", o.ObjectID)
 	}
 	return nil
 }
@@ -105,11 +514,11 @@ func (s *sendSubscription) sendDatagram(o Object) error {
 		GroupID:           o.GroupID,
 		ObjectID:          o.ObjectID,
 		PublisherPriority: o.PublisherPriority,
-		ObjectStatus:      0,
+		ObjectStatus:      o.Status,
 		ObjectPayload:     o.Payload,
 	}
 	buf := make([]byte, 0, 48+len(o.Payload))
-	buf = om.Append(buf)
+	buf = om.AppendVersion(buf, s.version)
 	err := s.conn.SendDatagram(buf)
 	if !errors.Is(err, &quic.DatagramTooLargeError{}) {
 		return err
@@ -117,12 +526,25 @@ func (s *sendSubscription) sendDatagram(o Object) error {
 	return nil
 }
 
-func (s *sendSubscription) sendObjectStream(o Object) error {
+// openUniStream opens a new stream for o.
+func (s *sendSubscription) openUniStream(o Object) (SendStream, error) {
 	stream, err := s.conn.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	e := newStreamEvent(StreamDirectionSend, s.subscribeID, s.trackAlias, o)
+	s.tracer.StreamOpened(e)
+	return newCountingSendStream(stream, &s.counters, func() {
+		s.tracer.StreamClosed(e)
+	}), nil
+}
+
+func (s *sendSubscription) sendObjectStream(o Object) error {
+	stream, err := s.openUniStream(o)
 	if err != nil {
 		return err
 	}
-	os, err := newObjectStream(stream, s.subscribeID, s.trackAlias, o.GroupID, o.ObjectID, o.PublisherPriority)
+	os, err := newObjectStream(stream, s.version, s.subscribeID, s.trackAlias, o.GroupID, o.ObjectID, o.PublisherPriority, o.Status)
 	if err != nil {
 		return err
 	}
@@ -134,41 +556,168 @@ func (s *sendSubscription) sendObjectStream(o Object) error {
 
 func (s *sendSubscription) sendTrackHeaderStream(o Object) error {
 	if s.trackHeaderStream == nil {
-		stream, err := s.conn.OpenUniStream()
+		stream, err := s.openUniStream(o)
 		if err != nil {
 			return err
 		}
-		ts, err := newTrackHeaderStream(stream, s.subscribeID, s.trackAlias, o.PublisherPriority)
+		ts, err := newTrackHeaderStream(stream, s.version, s.subscribeID, s.trackAlias, o.PublisherPriority)
 		if err != nil {
 			return err
 		}
 		s.trackHeaderStream = ts
 	}
-	_, err := s.trackHeaderStream.writeObject(o.GroupID, o.ObjectID, o.Payload)
-	return err
+	if o.Status == ObjectStatusNormal {
+		_, err := s.trackHeaderStream.writeObject(o.GroupID, o.ObjectID, o.Payload)
+		return err
+	}
+	if _, err := s.trackHeaderStream.writeStatus(o.GroupID, o.ObjectID, o.Status); err != nil {
+		return err
+	}
+	if o.Status == ObjectStatusEndOfTrack {
+		ts := s.trackHeaderStream
+		s.trackHeaderStream = nil
+		return ts.Close()
+	}
+	return nil
 }
 
 func (s *sendSubscription) sendGroupHeaderStream(o Object) error {
+	if s.groupStreams.resetStale && s.hasGroupStream && o.GroupID < s.newestGroup {
+		s.logger.Info("skipping object of stale group", "group-id", o.GroupID, "object-id", o.ObjectID)
+		return nil
+	}
 	gs, ok := s.groupHeaderStreams[o.GroupID]
 	if !ok {
+		s.retireGroupStreams(o.GroupID)
 		var stream SendStream
 		var err error
-		stream, err = s.conn.OpenUniStream()
+		stream, err = s.openUniStream(o)
 		if err != nil {
 			return err
 		}
-		gs, err = newGroupHeaderStream(stream, s.subscribeID, s.trackAlias, o.GroupID, o.PublisherPriority)
+		gs, err = newGroupHeaderStream(stream, s.version, s.subscribeID, s.trackAlias, o.GroupID, o.PublisherPriority)
 		if err != nil {
 			return err
 		}
 		s.groupHeaderStreams[o.GroupID] = gs
+		if !s.hasGroupStream || s.newestGroup < o.GroupID {
+			s.newestGroup = o.GroupID
+		}
+		s.hasGroupStream = true
+	}
+	if o.Status == ObjectStatusNormal {
+		_, err := gs.writeObject(o.ObjectID, o.Payload)
+		return err
+	}
+	if _, err := gs.writeStatus(o.ObjectID, o.Status); err != nil {
+		return err
+	}
+	if o.Status == ObjectStatusEndOfGroup || o.Status == ObjectStatusEndOfTrack {
+		delete(s.groupHeaderStreams, o.GroupID)
+		return gs.Close()
+	}
+	return nil
+}
+
+// retireGroupStreams makes room for the stream of a new group. It closes or
+// resets the streams of all groups older than the new group and, if the limit
+// of open group streams is still reached, the streams of the oldest groups.
+func (s *sendSubscription) retireGroupStreams(groupID uint64) {
+	for id := range s.groupHeaderStreams {
+		if id < groupID {
+			s.retireGroupStream(id)
+		}
+	}
+	for len(s.groupHeaderStreams) >= s.groupStreams.maxOpen {
+		first := true
+		var oldest uint64
+		for id := range s.groupHeaderStreams {
+			if first || id < oldest {
+				oldest = id
+				first = false
+			}
+		}
+		s.retireGroupStream(oldest)
+	}
+}
+
+func (s *sendSubscription) retireGroupStream(groupID uint64) {
+	gs := s.groupHeaderStreams[groupID]
+	delete(s.groupHeaderStreams, groupID)
+	var err error
+	if s.groupStreams.resetStale {
+		err = gs.reset()
+	} else {
+		err = gs.Close()
+	}
+	if err != nil {
+		s.logger.Warn("failed to close group stream", "group-id", groupID, "error", err)
+	}
+}
+
+// closeStreams closes all streams of the subscription that are still open.
+func (s *sendSubscription) closeStreams() {
+	if s.trackHeaderStream != nil {
+		if err := s.trackHeaderStream.Close(); err != nil {
+			s.logger.Warn("failed to close track stream", "error", err)
+		}
+		s.trackHeaderStream = nil
+	}
+	for id, gs := range s.groupHeaderStreams {
+		if err := gs.Close(); err != nil {
+			s.logger.Warn("failed to close group stream", "group-id", id, "error", err)
+		}
+		delete(s.groupHeaderStreams, id)
 	}
-	_, err := gs.writeObject(o.ObjectID, o.Payload)
-	return err
 }
 
 func (s *sendSubscription) Close() error {
 	s.cancelCtx()
 	s.cancelWG.Wait()
+	// Streams are only used by jobs of the scheduler, so they must be closed
+	// by a job, too.
+	s.scheduler.schedule(&sendJob{
+		subscribeID:        s.subscribeID,
+		subscriberPriority: s.getSubscriberPriority(),
+		publisherPriority:  0,
+		groupOrder:         s.groupOrder,
+		groupID:            0,
+		seq:                0,
+		send:               s.closeStreams,
+	})
 	return nil
 }
+
+// objectPayloadWriter writes the payload of an object opened by
+// openObjectStream and reports the outcome to the subscription when it is
+// closed.
+type objectPayloadWriter struct {
+	subscription *sendSubscription
+	header       Object
+	stream       *objectStream
+	written      int
+	err          error
+}
+
+func (w *objectPayloadWriter) Write(p []byte) (int, error) {
+	n, err := w.stream.Write(p)
+	w.written += n
+	w.subscription.counters.bytes.Add(uint64(n))
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *objectPayloadWriter) Close() error {
+	err := w.err
+	if err == nil {
+		err = w.stream.Close()
+	}
+	if err == nil {
+		w.subscription.counters.objects.Add(1)
+		w.subscription.tracer.ObjectSent(newObjectEvent(w.subscription.subscribeID, w.subscription.trackAlias, w.header, w.written))
+	}
+	w.subscription.reportSent(w.header, err)
+	return err
+}
@@ -0,0 +1,233 @@
+package moqtransport
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSendSubscription(t *testing.T) {
+	newTestSendSubscriptionWithDone := func(conn Connection, config groupStreamConfig, onDone func(uint64, string)) *sendSubscription {
+		return newSendSubscription(conn, newSendScheduler(), &Subscription{
+			ID:         1,
+			TrackAlias: 2,
+			Namespace:  "namespace",
+			TrackName:  "track",
+			FilterType: FilterTypeLatestGroup,
+		}, config, defaultSendQueueConfig(), wire.CurrentVersion, nopTracer{}, onDone)
+	}
+	newTestSendSubscription := func(conn Connection, config groupStreamConfig) *sendSubscription {
+		return newTestSendSubscriptionWithDone(conn, config, nil)
+	}
+	// stop ends the loop of s and closes its remaining streams without the
+	// scheduler, so that all calls to the streams happen before the test ends.
+	stop := func(s *sendSubscription) {
+		s.cancelCtx()
+		s.cancelWG.Wait()
+		s.closeStreams()
+	}
+	groupObject := func(groupID, objectID uint64) Object {
+		return Object{
+			GroupID:              groupID,
+			ObjectID:             objectID,
+			PublisherPriority:    0,
+			ForwardingPreference: ObjectForwardingPreferenceStreamGroup,
+			Payload:              []byte("hello"),
+		}
+	}
+	t.Run("close_group_stream_on_newer_group", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		first := NewMockSendStream(ctrl)
+		second := NewMockSendStream(ctrl)
+		gomock.InOrder(
+			mc.EXPECT().OpenUniStream().Return(first, nil),
+			first.EXPECT().Write(gomock.Any()).Times(2),
+			first.EXPECT().Close(),
+			mc.EXPECT().OpenUniStream().Return(second, nil),
+			second.EXPECT().Write(gomock.Any()).Times(2),
+			second.EXPECT().Close(),
+		)
+		s := newTestSendSubscription(mc, groupStreamConfig{maxOpen: 16, resetStale: false})
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(0, 0)))
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(1, 0)))
+		assert.Len(t, s.groupHeaderStreams, 1)
+		stop(s)
+	})
+	t.Run("close_group_stream_on_end_of_group", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		stream := NewMockSendStream(ctrl)
+		gomock.InOrder(
+			mc.EXPECT().OpenUniStream().Return(stream, nil),
+			stream.EXPECT().Write(gomock.Any()).Times(3),
+			stream.EXPECT().Close(),
+		)
+		s := newTestSendSubscription(mc, groupStreamConfig{maxOpen: 16, resetStale: false})
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(0, 0)))
+		end := groupObject(0, 1)
+		end.Payload = nil
+		end.Status = ObjectStatusEndOfGroup
+		assert.NoError(t, s.sendGroupHeaderStream(end))
+		assert.Empty(t, s.groupHeaderStreams)
+		stop(s)
+	})
+	t.Run("limit_open_group_streams", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		newer := NewMockSendStream(ctrl)
+		older := NewMockSendStream(ctrl)
+		oldest := NewMockSendStream(ctrl)
+		gomock.InOrder(
+			mc.EXPECT().OpenUniStream().Return(newer, nil),
+			newer.EXPECT().Write(gomock.Any()).Times(2),
+			mc.EXPECT().OpenUniStream().Return(older, nil),
+			older.EXPECT().Write(gomock.Any()).Times(2),
+			older.EXPECT().Close(),
+			mc.EXPECT().OpenUniStream().Return(oldest, nil),
+			oldest.EXPECT().Write(gomock.Any()).Times(2),
+		)
+		newer.EXPECT().Close()
+		oldest.EXPECT().Close()
+		s := newTestSendSubscription(mc, groupStreamConfig{maxOpen: 2, resetStale: false})
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(5, 0)))
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(4, 0)))
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(3, 0)))
+		assert.Len(t, s.groupHeaderStreams, 2)
+		stop(s)
+	})
+	t.Run("reset_stale_group_streams", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		first := NewMockSendStream(ctrl)
+		second := NewMockSendStream(ctrl)
+		gomock.InOrder(
+			mc.EXPECT().OpenUniStream().Return(first, nil),
+			first.EXPECT().Write(gomock.Any()).Times(2),
+			first.EXPECT().Close(),
+			mc.EXPECT().OpenUniStream().Return(second, nil),
+			second.EXPECT().Write(gomock.Any()).Times(2),
+			second.EXPECT().Close(),
+		)
+		s := newTestSendSubscription(mc, groupStreamConfig{maxOpen: 16, resetStale: true})
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(0, 0)))
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(1, 0)))
+		// Objects of the stale group are dropped.
+		assert.NoError(t, s.sendGroupHeaderStream(groupObject(0, 1)))
+		assert.Len(t, s.groupHeaderStreams, 1)
+		stop(s)
+	})
+	t.Run("end_of_track", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		stream := NewMockSendStream(ctrl)
+		gomock.InOrder(
+			mc.EXPECT().OpenUniStream().Return(stream, nil),
+			stream.EXPECT().Write(gomock.Any()).Times(2),
+			stream.EXPECT().Close(),
+		)
+		type result struct {
+			code   uint64
+			reason string
+		}
+		done := make(chan result, 1)
+		s := newTestSendSubscriptionWithDone(mc, groupStreamConfig{maxOpen: 16, resetStale: false}, func(code uint64, reason string) {
+			done <- result{code: code, reason: reason}
+		})
+		err := s.WriteObject(Object{
+			GroupID:              1,
+			ObjectID:             0,
+			PublisherPriority:    0,
+			ForwardingPreference: ObjectForwardingPreferenceStream,
+			Status:               ObjectStatusEndOfTrack,
+			Payload:              nil,
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case r := <-done:
+			assert.Equal(t, uint64(SubscribeStatusTrackEnded), r.code)
+		}
+		stop(s)
+	})
+	t.Run("send_queue_policies", func(t *testing.T) {
+		cases := []struct {
+			policy        SendQueuePolicy
+			objects       []Object
+			expect        []Object
+			expectDropped uint64
+		}{
+			{
+				policy:        SendQueuePolicyDropNewest,
+				objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+				expect:        []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}},
+				expectDropped: 1,
+			},
+			{
+				policy:        SendQueuePolicyDropOldest,
+				objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+				expect:        []Object{{GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+				expectDropped: 1,
+			},
+			{
+				policy:        SendQueuePolicyDropStaleGroups,
+				objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+				expect:        []Object{{GroupID: 1, ObjectID: 0}},
+				expectDropped: 2,
+			},
+			{
+				policy:        SendQueuePolicyDropStaleGroups,
+				objects:       []Object{{GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}, {GroupID: 1, ObjectID: 2}},
+				expect:        []Object{{GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}},
+				expectDropped: 1,
+			},
+			{
+				policy:        SendQueuePolicyBlock,
+				objects:       []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}, {GroupID: 1, ObjectID: 0}},
+				expect:        []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 0, ObjectID: 1}},
+				expectDropped: 1,
+			},
+		}
+		for i, tc := range cases {
+			t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+				s := newTestSendSubscription(nil, groupStreamConfig{maxOpen: 16, resetStale: false})
+				s.queueConfig = sendQueueConfig{size: 2, policy: tc.policy, deadline: 10 * time.Millisecond}
+				for _, o := range tc.objects {
+					s.enqueue(&queuedObject{object: o, dropped: false})
+				}
+				res := []Object{}
+				for _, q := range s.queue {
+					res = append(res, q.object)
+				}
+				assert.Equal(t, tc.expect, res)
+				assert.Equal(t, tc.expectDropped, s.stats().DroppedObjects)
+				stop(s)
+			})
+		}
+	})
+	t.Run("send_queue_block_until_dequeued", func(t *testing.T) {
+		s := newTestSendSubscription(nil, groupStreamConfig{maxOpen: 16, resetStale: false})
+		s.queueConfig = sendQueueConfig{size: 1, policy: SendQueuePolicyBlock, deadline: time.Second}
+		first := &queuedObject{object: Object{ObjectID: 0}, dropped: false}
+		assert.True(t, s.enqueue(first))
+		enqueued := make(chan bool)
+		go func() {
+			enqueued <- s.enqueue(&queuedObject{object: Object{ObjectID: 1}, dropped: false})
+		}()
+		time.Sleep(10 * time.Millisecond)
+		assert.True(t, s.dequeue(first))
+		select {
+		case ok := <-enqueued:
+			assert.True(t, ok)
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		}
+		assert.Equal(t, uint64(0), s.stats().DroppedObjects)
+		stop(s)
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"log/slog"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mengelbart/moqtransport/internal/wire"
 )
@@ -18,8 +20,18 @@ const (
 	clientLoggingSuffix = "CLIENT"
 )
 
+// maxTrackAliasRetries is the number of times Subscribe retries a subscription
+// with a track alias suggested by the publisher.
+const maxTrackAliasRetries = 3
+
+// finalObjectTimeout is how long a subscription stays open after
+// SUBSCRIBE_DONE to receive objects which are still in flight.
+const finalObjectTimeout = 5 * time.Second
+
 var (
-	errClosed = errors.New("session closed")
+	errGoingAway = errors.New("session is going away")
+
+	errUnsupportedVersion = errors.New("unsupported version")
 )
 
 type subscribeIDer interface {
@@ -43,11 +55,24 @@ type sessionInternals struct {
 	controlStreamStoreCh  chan controlMessageSender // Needs to be buffered
 	closeOnce             sync.Once
 	closed                chan struct{}
+	err                   error
+	goAwayOnce            sync.Once
+	goAwayCh              chan struct{}
+	version               atomic.Uint64
+	nextSubscribeID       atomic.Uint64
+	nextTrackAlias        atomic.Uint64
 	sendSubscriptions     *syncMap[uint64, *sendSubscription]
 	receiveSubscriptions  *syncMap[uint64, *RemoteTrack]
 	localAnnouncements    *syncMap[string, *Announcement]
 	remoteAnnouncements   *syncMap[string, *Announcement]
 	localTracks           *syncMap[trackKey, *LocalTrack]
+	trackStatusRequests   *trackStatusRequests
+	scheduler             *sendScheduler
+	messagesSent          *messageCounter
+	messagesReceived      *messageCounter
+	latencies             *latencyRecorder
+	endedTracks           *trackTotals
+	tracer                Tracer
 }
 
 func newSessionInternals(logSuffix string) *sessionInternals {
@@ -57,11 +82,24 @@ func newSessionInternals(logSuffix string) *sessionInternals {
 		controlStreamStoreCh:  make(chan controlMessageSender, 1),
 		closeOnce:             sync.Once{},
 		closed:                make(chan struct{}),
+		err:                   nil,
+		goAwayOnce:            sync.Once{},
+		goAwayCh:              make(chan struct{}),
+		version:               atomic.Uint64{},
+		nextSubscribeID:       atomic.Uint64{},
+		nextTrackAlias:        atomic.Uint64{},
 		sendSubscriptions:     newSyncMap[uint64, *sendSubscription](),
 		receiveSubscriptions:  newSyncMap[uint64, *RemoteTrack](),
 		localAnnouncements:    newSyncMap[string, *Announcement](),
 		remoteAnnouncements:   newSyncMap[string, *Announcement](),
 		localTracks:           newSyncMap[trackKey, *LocalTrack](),
+		trackStatusRequests:   newTrackStatusRequests(),
+		scheduler:             newSendScheduler(),
+		messagesSent:          newMessageCounter(),
+		messagesReceived:      newMessageCounter(),
+		latencies:             newLatencyRecorder(),
+		endedTracks:           newTrackTotals(),
+		tracer:                nopTracer{},
 	}
 }
 
@@ -71,13 +109,24 @@ type controlMessageSender interface {
 }
 
 type Session struct {
-	Conn                Connection
-	EnableDatagrams     bool
-	LocalRole           Role
-	RemoteRole          Role
-	AnnouncementHandler AnnouncementHandler
-	SubscriptionHandler SubscriptionHandler
-	Path                string
+	Conn                      Connection
+	EnableDatagrams           bool
+	LocalRole                 Role
+	RemoteRole                Role
+	AnnouncementHandler       AnnouncementHandler
+	AnnouncementCancelHandler AnnouncementCancelHandler
+	SubscriptionHandler       SubscriptionHandler
+	TrackStatusHandler        TrackStatusHandler
+	GoAwayHandler             GoAwayHandler
+	Path                      string
+
+	// SupportedVersions are the versions the session offers or accepts
+	// during the handshake. If nil, DefaultSupportedVersions are used.
+	SupportedVersions []Version
+
+	// Tracer receives the events of the session. If nil, events are not
+	// traced.
+	Tracer Tracer
 
 	handshakeDone bool
 	controlStream controlMessageSender
@@ -116,6 +165,64 @@ func (s *Session) validateRemoteRoleParameter(setupParameters wire.Parameters) e
 	return nil
 }
 
+func (s *Session) supportedVersions() []Version {
+	if s.SupportedVersions == nil {
+		return DefaultSupportedVersions
+	}
+	return s.SupportedVersions
+}
+
+func (s *Session) validateSupportedVersions() error {
+	versions := s.supportedVersions()
+	if len(versions) == 0 {
+		return errUnsupportedVersion
+	}
+	for _, v := range versions {
+		if !slices.Contains(DefaultSupportedVersions, v) {
+			return fmt.Errorf("%w: %v", errUnsupportedVersion, v)
+		}
+	}
+	return nil
+}
+
+// Version returns the version negotiated during the handshake or 0 if the
+// handshake is not done yet.
+func (s *Session) Version() Version {
+	return Version(s.si.version.Load())
+}
+
+// wireVersion returns the version to use for encoding and parsing messages.
+// Before the handshake is done, that is the highest version the session
+// supports.
+func (s *Session) wireVersion() wire.Version {
+	if v := s.Version(); v != 0 {
+		return v
+	}
+	return slices.Max(s.supportedVersions())
+}
+
+func (s *Session) initTracer() {
+	if s.Tracer != nil {
+		s.si.tracer = s.Tracer
+	}
+}
+
+// controlMessageSent is called by the control stream for every message it
+// wrote.
+func (s *Session) controlMessageSent(msg wire.Message) {
+	s.si.messagesSent.add(msg)
+	if s.tracing() {
+		s.si.tracer.ControlMessageSent(newControlMessageEvent(msg))
+	}
+}
+
+// tracing reports whether the session has a Tracer. Control message events
+// are built using reflection, so they are only built for a Tracer.
+func (s *Session) tracing() bool {
+	_, ok := s.si.tracer.(nopTracer)
+	return !ok
+}
+
 func (s *Session) storeControlStream(cs controlMessageSender) {
 	s.si.controlStreamStoreCh <- cs
 }
@@ -126,15 +233,19 @@ func (s *Session) loadControlStream() controlMessageSender {
 
 func (s *Session) RunClient() error {
 	s.si = newSessionInternals(clientLoggingSuffix)
+	s.initTracer()
 	s.isClient = true
 	s.initRole()
+	if err := s.validateSupportedVersions(); err != nil {
+		return err
+	}
 	controlStream, err := s.Conn.OpenStream()
 	if err != nil {
 		return err
 	}
-	s.controlStream = newControlStream(controlStream, s.handleControlMessage)
+	s.controlStream = newControlStream(controlStream, s.handleControlMessage, s.handleControlStreamError, s.controlMessageSent, s.wireVersion)
 	s.controlStream.enqueue(&wire.ClientSetupMessage{
-		SupportedVersions: []wire.Version{wire.CurrentVersion},
+		SupportedVersions: s.supportedVersions(),
 		SetupParameters: wire.Parameters{
 			wire.RoleParameterKey: wire.VarintParameter{
 				Type:  wire.RoleParameterKey,
@@ -148,13 +259,17 @@ func (s *Session) RunClient() error {
 
 func (s *Session) RunServer(ctx context.Context) error {
 	s.si = newSessionInternals(serverLoggingSuffix)
+	s.initTracer()
 	s.isClient = false
 	s.initRole()
+	if err := s.validateSupportedVersions(); err != nil {
+		return err
+	}
 	controlStream, err := s.Conn.AcceptStream(ctx)
 	if err != nil {
 		return err
 	}
-	s.storeControlStream(newControlStream(controlStream, s.handleControlMessage))
+	s.storeControlStream(newControlStream(controlStream, s.handleControlMessage, s.handleControlStreamError, s.controlMessageSent, s.wireVersion))
 	select {
 	case <-ctx.Done():
 		s.si.logger.Error("context done before control stream handshake done")
@@ -168,22 +283,23 @@ func (s *Session) RunServer(ctx context.Context) error {
 }
 
 func (s *Session) initClient(setup *wire.ServerSetupMessage) error {
-	if setup.SelectedVersion != wire.CurrentVersion {
-		s.si.logger.Error("unsupported version", "remote_server_supported_version", setup.SelectedVersion, "client_supported_version", wire.CurrentVersion)
+	if !slices.Contains(s.supportedVersions(), setup.SelectedVersion) {
+		s.si.logger.Error("unsupported version", "remote_server_selected_version", setup.SelectedVersion, "client_supported_versions", s.supportedVersions())
 		return s.CloseWithError(ErrorCodeUnsupportedVersion, "unsupported version")
 	}
 	if err := s.validateRemoteRoleParameter(setup.SetupParameters); err != nil {
 		s.si.logger.Error("failed to validate remote role parameter", "error", err)
 		return err
 	}
+	s.si.version.Store(uint64(setup.SelectedVersion))
 	s.handshakeDone = true
 	return nil
 }
 
 func (s *Session) initServer(setup *wire.ClientSetupMessage) error {
-	s.controlStream = s.loadControlStream()
-	if !slices.Contains(setup.SupportedVersions, wire.CurrentVersion) {
-		s.si.logger.Error("unsupported version", "remote_client_supported_versions", setup.SupportedVersions, "server_supported_version", wire.CurrentVersion)
+	version, ok := s.selectVersion(setup.SupportedVersions)
+	if !ok {
+		s.si.logger.Error("unsupported version", "remote_client_supported_versions", setup.SupportedVersions, "server_supported_versions", s.supportedVersions())
 		return s.CloseWithError(ErrorCodeUnsupportedVersion, "unsupported version")
 	}
 	if err := s.validateRemoteRoleParameter(setup.SetupParameters); err != nil {
@@ -198,8 +314,9 @@ func (s *Session) initServer(setup *wire.ClientSetupMessage) error {
 		}
 		s.Path = pathParamValue.Value
 	}
+	s.si.version.Store(uint64(version))
 	ssm := &wire.ServerSetupMessage{
-		SelectedVersion: wire.CurrentVersion,
+		SelectedVersion: version,
 		SetupParameters: wire.Parameters{
 			wire.RoleParameterKey: &wire.VarintParameter{
 				Type:  wire.RoleParameterKey,
@@ -213,6 +330,20 @@ func (s *Session) initServer(setup *wire.ClientSetupMessage) error {
 	return nil
 }
 
+// selectVersion returns the highest version supported by both the session and
+// the peer.
+func (s *Session) selectVersion(remote []wire.Version) (wire.Version, bool) {
+	var selected wire.Version
+	found := false
+	for _, v := range s.supportedVersions() {
+		if slices.Contains(remote, v) && (!found || v > selected) {
+			selected = v
+			found = true
+		}
+	}
+	return selected, found
+}
+
 func (s *Session) run() {
 	go s.acceptUnidirectionalStreams()
 	if s.EnableDatagrams {
@@ -238,7 +369,7 @@ func (s *Session) acceptUnidirectionalStreams() {
 		stream, err := s.acceptUnidirectionalStream()
 		if err != nil {
 			s.si.logger.Error("failed to accept uni stream", "error", err)
-			s.peerClosed()
+			s.terminate(err)
 			return
 		}
 		go s.handleIncomingUniStream(stream)
@@ -246,8 +377,8 @@ func (s *Session) acceptUnidirectionalStreams() {
 }
 
 func (s *Session) handleIncomingUniStream(stream ReceiveStream) {
-	p := wire.NewObjectStreamParser(stream)
-	msg, err := p.Parse()
+	p := wire.NewObjectStreamParser(stream, s.wireVersion())
+	msg, payload, err := p.ParseStream()
 	if err != nil {
 		s.si.logger.Error("failed to parse message", "error", err)
 		return
@@ -257,13 +388,26 @@ func (s *Session) handleIncomingUniStream(stream ReceiveStream) {
 		s.si.logger.Warn("got object for unknown subscribe ID")
 		return
 	}
-	sub.push(Object{
+	o := Object{
 		GroupID:              msg.GroupID,
 		ObjectID:             msg.ObjectID,
 		PublisherPriority:    msg.PublisherPriority,
 		ForwardingPreference: objectForwardingPreferenceFromMessageType(msg.Type),
+		Status:               msg.ObjectStatus,
 		Payload:              msg.ObjectPayload,
-	})
+	}
+	e := newStreamEvent(StreamDirectionReceive, sub.subscribeID, sub.trackAlias, o)
+	s.si.tracer.StreamOpened(e)
+	if msg.Type == wire.ObjectStreamMessageType {
+		// The payload is the remainder of the stream and is read by the
+		// subscriber.
+		sub.pushStream(o, newCountingReader(payload, stream, &sub.counters, func() {
+			s.si.tracer.StreamClosed(e)
+		}))
+		return
+	}
+	defer s.si.tracer.StreamClosed(e)
+	sub.push(o)
 	sub.readObjectStream(p)
 }
 
@@ -285,7 +429,7 @@ func (s *Session) acceptDatagrams() {
 		dgram, err := s.acceptDatagram()
 		if err != nil {
 			s.si.logger.Error("failed to receive datagram", "error", err)
-			s.peerClosed()
+			s.terminate(err)
 			return
 		}
 		go s.readObjectMessage(bytes.NewReader(dgram))
@@ -293,18 +437,14 @@ func (s *Session) acceptDatagrams() {
 }
 
 func (s *Session) readObjectMessage(r io.Reader) {
-	msgParser := wire.NewObjectStreamParser(r)
+	msgParser := wire.NewObjectStreamParser(r, s.wireVersion())
 	o, err := msgParser.Parse()
 	if err != nil {
 		if err == io.EOF {
 			return
 		}
 		s.si.logger.Error("failed to parse message", "error", err)
-		pe := &ProtocolError{
-			code:    ErrorCodeProtocolViolation,
-			message: "invalid message format",
-		}
-		_ = s.Conn.CloseWithError(pe.code, pe.message)
+		_ = s.CloseWithError(ErrorCodeProtocolViolation, "invalid message format")
 		return
 	}
 	sub, ok := s.si.receiveSubscriptions.get(o.SubscribeID)
@@ -317,12 +457,20 @@ func (s *Session) readObjectMessage(r io.Reader) {
 		ObjectID:             o.ObjectID,
 		PublisherPriority:    o.PublisherPriority,
 		ForwardingPreference: ObjectForwardingPreferenceDatagram,
+		Status:               o.ObjectStatus,
 		Payload:              o.ObjectPayload,
 	})
 }
 
 func (s *Session) handleControlMessage(msg wire.Message) error {
 	s.si.logger.Info("received control message", "type", fmt.Sprintf("%T", msg), "message", msg)
+	s.si.messagesReceived.add(msg)
+	if s.tracing() {
+		s.si.tracer.ControlMessageParsed(newControlMessageEvent(msg))
+	}
+	if s.controlStream == nil {
+		s.controlStream = s.loadControlStream()
+	}
 	if s.handshakeDone {
 		if err := s.handleNonSetupMessage(msg); err != nil {
 			return err
@@ -336,21 +484,46 @@ func (s *Session) handleControlMessage(msg wire.Message) error {
 		return s.initServer(mt)
 	}
 	s.si.logger.Info("received message during handshake", "message", msg)
-	pe := ProtocolError{
+	return ProtocolError{
 		code:    ErrorCodeProtocolViolation,
 		message: "received unexpected first message on control stream",
 	}
-	s.controlStream.close()
-	_ = s.Conn.CloseWithError(pe.code, pe.message)
-	return pe
+}
+
+// handleControlStreamError closes the session after the control stream failed
+// to parse or handle a message. ProtocolErrors close the connection with their
+// error code, other errors with ErrorCodeInternal. If reading from the control
+// stream failed, the connection is already gone and the session ends with the
+// error of the stream.
+func (s *Session) handleControlStreamError(err error) {
+	select {
+	case <-s.si.closed:
+		return
+	default:
+	}
+	var re streamReadError
+	if errors.As(err, &re) {
+		s.terminate(re.err)
+		return
+	}
+	var pe ProtocolError
+	if !errors.As(err, &pe) {
+		pe = ProtocolError{
+			code:    ErrorCodeInternal,
+			message: err.Error(),
+		}
+	}
+	if err := s.CloseWithError(pe.code, pe.message); err != nil {
+		s.si.logger.Error("failed to close connection", "error", err)
+	}
 }
 
 func (s *Session) handleNonSetupMessage(msg wire.Message) error {
 	switch m := msg.(type) {
 	case *wire.SubscribeMessage:
-		s.handleSubscribe(m)
+		return s.handleSubscribe(m)
 	case *wire.SubscribeUpdateMessage:
-		panic("TODO")
+		return s.handleSubscribeUpdate(m)
 	case *wire.SubscribeOkMessage:
 		return s.handleSubscriptionResponse(m)
 	case *wire.SubscribeErrorMessage:
@@ -362,21 +535,21 @@ func (s *Session) handleNonSetupMessage(msg wire.Message) error {
 	case *wire.AnnounceErrorMessage:
 		return s.handleAnnouncementResponse(m)
 	case *wire.UnannounceMessage:
-		panic("TODO")
+		s.handleUnannounceMessage(m)
 	case *wire.UnsubscribeMessage:
 		return s.handleUnsubscribe(m)
 	case *wire.SubscribeDoneMessage:
 		s.handleSubscribeDone(m)
 	case *wire.AnnounceCancelMessage:
-		panic("TODO")
+		s.handleAnnounceCancelMessage(m)
 	case *wire.TrackStatusRequestMessage:
-		panic("TODO")
+		s.handleTrackStatusRequest(m)
 	case *wire.TrackStatusMessage:
-		panic("TODO")
+		s.handleTrackStatus(m)
 	case *wire.GoAwayMessage:
-		panic("TODO")
+		return s.handleGoAway(m)
 	default:
-		return &ProtocolError{
+		return ProtocolError{
 			code:    ErrorCodeInternal,
 			message: "received unexpected message type on control stream",
 		}
@@ -387,40 +560,63 @@ func (s *Session) handleNonSetupMessage(msg wire.Message) error {
 func (s *Session) handleSubscriptionResponse(msg subscribeIDer) error {
 	sub, ok := s.si.receiveSubscriptions.get(msg.GetSubscribeID())
 	if !ok {
-		return &ProtocolError{
-			code:    ErrorCodeInternal,
+		return ProtocolError{
+			code:    ErrorCodeProtocolViolation,
 			message: "received subscription response message to an unknown subscription",
 		}
 	}
-	// TODO: Run a goroutine to avoid blocking here?
-	select {
-	case sub.responseCh <- msg:
-	case <-s.si.closed:
-		return errClosed
+	if !sub.response.deliver(msg) {
+		s.handleAbandonedSubscriptionResponse(sub, msg)
 	}
 	return nil
 }
 
+// handleAbandonedSubscriptionResponse ends a subscription whose Subscribe
+// call returned before the response arrived. If the publisher accepted the
+// subscription, it is unsubscribed again.
+func (s *Session) handleAbandonedSubscriptionResponse(sub *RemoteTrack, msg subscribeIDer) {
+	s.si.logger.Info("received response to abandoned subscription", "subscribe_id", sub.subscribeID, "message", msg)
+	s.endReceiveSubscription(sub)
+	if _, ok := msg.(*wire.SubscribeOkMessage); ok {
+		s.unsubscribe(sub.subscribeID)
+	}
+}
+
 func (s *Session) handleAnnouncementResponse(msg trackNamespacer) error {
 	a, ok := s.si.localAnnouncements.get(msg.GetTrackNamespace())
 	if !ok {
-		return &ProtocolError{
-			code:    ErrorCodeInternal,
+		return ProtocolError{
+			code:    ErrorCodeProtocolViolation,
 			message: "received announcement response message to an unknown announcement",
 		}
 	}
-	// TODO: Run a goroutine to avoid blocking here?
-	select {
-	case a.responseCh <- msg:
-	case <-s.si.closed:
-		return errClosed
+	if !a.response.deliver(msg) {
+		s.handleAbandonedAnnouncementResponse(msg)
 	}
 	return nil
 }
 
-func (s *Session) subscribeToLocalTrack(sub *Subscription, t *LocalTrack) {
-	sendSub := newSendSubscription(s.Conn, sub.ID, sub.TrackAlias, sub.Namespace, sub.TrackName)
+// handleAbandonedAnnouncementResponse removes an announcement whose Announce
+// call returned before the response arrived. If the peer accepted the
+// announcement, it is withdrawn again.
+func (s *Session) handleAbandonedAnnouncementResponse(msg trackNamespacer) {
+	s.si.logger.Info("received response to abandoned announcement", "namespace", msg.GetTrackNamespace(), "message", msg)
+	s.si.localAnnouncements.delete(msg.GetTrackNamespace())
+	if _, ok := msg.(*wire.AnnounceOkMessage); ok {
+		s.controlStream.enqueue(&wire.UnannounceMessage{
+			TrackNamespace: msg.GetTrackNamespace(),
+		})
+	}
+}
+
+func (s *Session) subscribeToLocalTrack(sub *Subscription, t *LocalTrack, queueConfig sendQueueConfig) {
+	sendSub := newSendSubscription(s.Conn, s.si.scheduler, sub, t.groupStreams, queueConfig, s.wireVersion(), s.si.tracer, func(code uint64, reason string) {
+		if err := s.endSendSubscription(sub.ID, code, reason); err != nil {
+			s.si.logger.Error("failed to end subscription", "error", err)
+		}
+	})
 	if err := s.si.sendSubscriptions.add(sub.ID, sendSub); err != nil {
+		_ = sendSub.Close()
 		s.controlStream.enqueue(&wire.SubscribeErrorMessage{
 			SubscribeID:  sub.ID,
 			ErrorCode:    ErrorCodeInternal, // TODO: Set better error code?
@@ -430,8 +626,10 @@ func (s *Session) subscribeToLocalTrack(sub *Subscription, t *LocalTrack) {
 		s.si.logger.Error("failed to save subscription", "error", err)
 		return
 	}
-	id, err := t.subscribe(sendSub)
+	id, err := t.subscribe(sendSub, sub.FilterType)
 	if err != nil {
+		s.si.sendSubscriptions.delete(sub.ID)
+		_ = sendSub.Close()
 		s.controlStream.enqueue(&wire.SubscribeErrorMessage{
 			SubscribeID:  sub.ID,
 			ErrorCode:    ErrorCodeInternal, // TODO: Set better error code?
@@ -441,14 +639,17 @@ func (s *Session) subscribeToLocalTrack(sub *Subscription, t *LocalTrack) {
 		s.si.logger.Error("failed to subscribe to track", "error", err)
 		return
 	}
-	sendSub.subscriptionIDinTrack = id
+	sendSub.setTrack(t, id)
+	// The largest location the window was resolved from, so that the
+	// subscriber resolves the same window.
+	largest, contentExists := sendSub.latest()
 	s.controlStream.enqueue(&wire.SubscribeOkMessage{
 		SubscribeID:   sub.ID,
-		Expires:       0,     // TODO
-		GroupOrder:    1,     // TODO
-		ContentExists: false, // TODO
-		FinalGroup:    0,     // TODO
-		FinalObject:   0,     // TODO
+		Expires:       0, // TODO
+		GroupOrder:    sendSub.groupOrder,
+		ContentExists: contentExists,
+		FinalGroup:    largest.group,
+		FinalObject:   largest.object,
 	})
 }
 
@@ -461,7 +662,7 @@ func (s *Session) rejectSubscription(sub *Subscription, code uint64, reason stri
 	})
 }
 
-func (s *Session) handleSubscribe(msg *wire.SubscribeMessage) {
+func (s *Session) handleSubscribe(msg *wire.SubscribeMessage) error {
 	var authValue string
 	auth, ok := msg.Parameters[wire.AuthorizationParameterKey]
 	authString, isStringParam := auth.(*wire.StringParameter)
@@ -469,73 +670,196 @@ func (s *Session) handleSubscribe(msg *wire.SubscribeMessage) {
 		authValue = authString.Value
 	}
 	sub := &Subscription{
-		ID:            msg.SubscribeID,
-		TrackAlias:    msg.TrackAlias,
-		Namespace:     msg.TrackNamespace,
-		TrackName:     msg.TrackName,
-		Authorization: authValue,
+		ID:                 msg.SubscribeID,
+		TrackAlias:         msg.TrackAlias,
+		Namespace:          msg.TrackNamespace,
+		TrackName:          msg.TrackName,
+		Authorization:      authValue,
+		SubscriberPriority: msg.SubscriberPriority,
+		GroupOrder:         msg.GroupOrder,
+		FilterType:         msg.FilterType,
+		StartGroup:         msg.StartGroup,
+		StartObject:        msg.StartObject,
+		EndGroup:           msg.EndGroup,
+		EndObject:          msg.EndObject,
+	}
+	for _, other := range s.si.sendSubscriptions.values() {
+		if other.trackAlias == msg.TrackAlias && (other.namespace != msg.TrackNamespace || other.trackname != msg.TrackName) {
+			return s.CloseWithError(ErrorCodeDuplicateTrackAlias, "duplicate track alias")
+		}
+	}
+	if s.goingAway() {
+		s.rejectSubscription(sub, SubscribeErrorInternal, errGoingAway.Error())
+		return nil
+	}
+	if err := sub.window().valid(); err != nil {
+		s.rejectSubscription(sub, SubscribeErrorInvalidRange, err.Error())
+		return nil
 	}
 	t, ok := s.si.localTracks.get(trackKey{
 		namespace: msg.TrackNamespace,
 		trackname: msg.TrackName,
 	})
 	if ok {
-		s.subscribeToLocalTrack(sub, t)
-		return
+		s.subscribeToLocalTrack(sub, t, defaultSendQueueConfig())
+		return nil
 	}
 	if s.SubscriptionHandler != nil {
 		s.SubscriptionHandler.HandleSubscription(s, sub, &defaultSubscriptionResponseWriter{
 			subscription: sub,
 			session:      s,
 		})
-		return
+		return nil
 	}
 	s.rejectSubscription(sub, ErrorCodeTrackNotFound, "track not found")
+	return nil
 }
 
-func (s *Session) handleUnsubscribe(msg *wire.UnsubscribeMessage) error {
+func (s *Session) handleSubscribeUpdate(msg *wire.SubscribeUpdateMessage) error {
 	sub, ok := s.si.sendSubscriptions.get(msg.SubscribeID)
 	if !ok {
-		return errors.New("subscription not found")
+		return s.CloseWithError(ErrorCodeProtocolViolation, "received subscribe update for unknown subscription")
 	}
-	track, ok := s.si.localTracks.get(trackKey{
-		namespace: sub.namespace,
-		trackname: sub.trackname,
-	})
+	if err := sub.update(windowFromSubscribeUpdate(msg), msg.SubscriberPriority); err != nil {
+		s.si.logger.Error("invalid subscribe update", "error", err)
+		return s.CloseWithError(ErrorCodeProtocolViolation, err.Error())
+	}
+	return nil
+}
+
+func (s *Session) handleUnsubscribe(msg *wire.UnsubscribeMessage) error {
+	return s.endSendSubscription(msg.SubscribeID, SubscribeStatusUnsubscribed, "unsubscribed")
+}
+
+// endSendSubscription removes a subscription from its track, closes it and
+// sends a SUBSCRIBE_DONE message with the given status to the subscriber.
+func (s *Session) endSendSubscription(id uint64, statusCode uint64, reason string) error {
+	sub, ok := s.si.sendSubscriptions.getAndDelete(id)
 	if !ok {
-		return errors.New("no track related to subscription found")
+		return errors.New("subscription not found")
 	}
-	track.unsubscribe(sub.subscriptionIDinTrack)
+	defer s.si.endedTracks.add(sub.trackStats())
+	sub.unsubscribeFromTrack()
 	if err := sub.Close(); err != nil {
-		panic(err)
+		return err
+	}
+	if t := sub.localTrack(); t != nil && sub.failure() != nil {
+		t.subscriberFailed(fmt.Errorf("subscription %v to %v/%v: %w", id, sub.namespace, sub.trackname, sub.failure()))
 	}
-	s.si.sendSubscriptions.delete(msg.SubscribeID)
+	final, contentExists := sub.finalLocation()
 	s.controlStream.enqueue(&wire.SubscribeDoneMessage{
-		SubscribeID:   msg.SubscribeID,
-		StatusCode:    0,
-		ReasonPhrase:  "unsubscribed",
-		ContentExists: false, // TODO
-		FinalGroup:    0,     // TODO
-		FinalObject:   0,     // TODO
+		SubscribeID:   id,
+		StatusCode:    statusCode,
+		ReasonPhrase:  reason,
+		ContentExists: contentExists,
+		FinalGroup:    final.group,
+		FinalObject:   final.object,
 	})
 	return nil
 }
 
+// handleSubscribeDone ends a subscription. Objects may still be in flight on
+// streams the peer opened before it sent SUBSCRIBE_DONE, so if the peer sent
+// any content, the subscription stays open until the final object was
+// received or finalObjectTimeout expired.
 func (s *Session) handleSubscribeDone(msg *wire.SubscribeDoneMessage) {
 	sub, ok := s.si.receiveSubscriptions.get(msg.SubscribeID)
 	if !ok {
 		s.si.logger.Info("got SubscribeDone for unknown subscription")
 		return
 	}
+	if !msg.ContentExists {
+		s.endReceiveSubscription(sub)
+		return
+	}
+	received := sub.finalReceived(location{group: msg.FinalGroup, object: msg.FinalObject})
+	go func() {
+		timer := time.NewTimer(finalObjectTimeout)
+		defer timer.Stop()
+		select {
+		case <-received:
+		case <-timer.C:
+			s.si.logger.Warn("final object not received after SubscribeDone", "subscribe-id", msg.SubscribeID, "final-group", msg.FinalGroup, "final-object", msg.FinalObject)
+		case <-s.si.closed:
+			return
+		}
+		s.endReceiveSubscription(sub)
+	}()
+}
+
+// endReceiveSubscription removes sub from the session and closes it.
+func (s *Session) endReceiveSubscription(sub *RemoteTrack) {
+	if _, ok := s.si.receiveSubscriptions.getAndDelete(sub.subscribeID); !ok {
+		return
+	}
 	sub.close()
-	s.si.receiveSubscriptions.delete(msg.SubscribeID)
+	s.si.endedTracks.add(sub.trackStats())
+}
+
+func (s *Session) handleTrackStatusRequest(msg *wire.TrackStatusRequestMessage) {
+	req := &TrackStatusRequest{
+		Namespace: msg.TrackNamespace,
+		TrackName: msg.TrackName,
+	}
+	t, ok := s.si.localTracks.get(trackKey{
+		namespace: msg.TrackNamespace,
+		trackname: msg.TrackName,
+	})
+	if ok {
+		s.replyTrackStatus(req, t.Status())
+		return
+	}
+	if s.TrackStatusHandler != nil {
+		s.TrackStatusHandler.HandleTrackStatus(s, req, &defaultTrackStatusResponseWriter{
+			request: req,
+			session: s,
+		})
+		return
+	}
+	s.replyTrackStatus(req, TrackStatus{
+		StatusCode:     TrackStatusDoesNotExist,
+		LatestGroupID:  0,
+		LatestObjectID: 0,
+	})
+}
+
+func (s *Session) replyTrackStatus(req *TrackStatusRequest, status TrackStatus) {
+	s.controlStream.enqueue(&wire.TrackStatusMessage{
+		TrackNamespace: req.Namespace,
+		TrackName:      req.TrackName,
+		StatusCode:     status.StatusCode,
+		LatestGroupID:  status.LatestGroupID,
+		LatestObjectID: status.LatestObjectID,
+	})
+}
+
+func (s *Session) handleTrackStatus(msg *wire.TrackStatusMessage) {
+	responseCh, ok := s.si.trackStatusRequests.next(trackKey{
+		namespace: msg.TrackNamespace,
+		trackname: msg.TrackName,
+	})
+	if !ok {
+		s.si.logger.Info("got track status for unknown request", "namespace", msg.TrackNamespace, "trackname", msg.TrackName)
+		return
+	}
+	// responseCh is buffered and receives at most one response.
+	responseCh <- msg
 }
 
 func (s *Session) handleAnnounceMessage(msg *wire.AnnounceMessage) {
+	if s.goingAway() {
+		s.controlStream.enqueue(&wire.AnnounceErrorMessage{
+			TrackNamespace: msg.TrackNamespace,
+			ErrorCode:      ErrorCodeInternal,
+			ReasonPhrase:   errGoingAway.Error(),
+		})
+		return
+	}
 	a := &Announcement{
-		responseCh: make(chan trackNamespacer),
+		response:   newPendingResponse[trackNamespacer](),
 		namespace:  msg.TrackNamespace,
 		parameters: msg.Parameters,
+		session:    s,
 	}
 	if err := s.si.remoteAnnouncements.add(a.namespace, a); err != nil {
 		s.si.logger.Error("dropping announcement", "error", err)
@@ -549,6 +873,67 @@ func (s *Session) handleAnnounceMessage(msg *wire.AnnounceMessage) {
 	}
 }
 
+func (s *Session) handleUnannounceMessage(msg *wire.UnannounceMessage) {
+	a, ok := s.si.remoteAnnouncements.getAndDelete(msg.TrackNamespace)
+	if !ok {
+		s.si.logger.Info("got unannounce for unknown announcement", "namespace", msg.TrackNamespace)
+		return
+	}
+	if h, ok := s.AnnouncementHandler.(UnannouncementHandler); ok {
+		go h.HandleUnannouncement(s, a)
+	}
+}
+
+func (s *Session) handleAnnounceCancelMessage(msg *wire.AnnounceCancelMessage) {
+	if _, ok := s.si.localAnnouncements.getAndDelete(msg.TrackNamespace); !ok {
+		s.si.logger.Info("got announce cancel for unknown announcement", "namespace", msg.TrackNamespace)
+		return
+	}
+	s.si.logger.Info("peer canceled announcement", "namespace", msg.TrackNamespace)
+	if s.AnnouncementCancelHandler != nil {
+		go s.AnnouncementCancelHandler.HandleAnnouncementCancel(s, msg.TrackNamespace)
+	}
+}
+
+func (s *Session) cancelAnnouncement(a *Announcement, code uint64, reason string) error {
+	if _, ok := s.si.remoteAnnouncements.getAndDelete(a.namespace); !ok {
+		return errors.New("unknown announcement")
+	}
+	s.si.logger.Info("canceling announcement", "namespace", a.namespace, "code", code, "reason", reason)
+	s.controlStream.enqueue(&wire.AnnounceCancelMessage{
+		TrackNamespace: a.namespace,
+	})
+	return nil
+}
+
+func (s *Session) handleGoAway(msg *wire.GoAwayMessage) error {
+	if !s.isClient {
+		return s.CloseWithError(ErrorCodeProtocolViolation, "received GOAWAY from client")
+	}
+	first := false
+	s.si.goAwayOnce.Do(func() {
+		close(s.si.goAwayCh)
+		first = true
+	})
+	if !first {
+		s.si.logger.Info("ignoring duplicate GOAWAY", "uri", msg.NewSessionURI)
+		return nil
+	}
+	if s.GoAwayHandler != nil {
+		go s.GoAwayHandler.HandleGoAway(s, msg.NewSessionURI)
+	}
+	return nil
+}
+
+func (s *Session) goingAway() bool {
+	select {
+	case <-s.si.goAwayCh:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *Session) rejectAnnouncement(a *Announcement, code uint64, reason string) {
 	s.si.remoteAnnouncements.delete(a.namespace)
 	s.controlStream.enqueue(&wire.AnnounceErrorMessage{
@@ -564,28 +949,103 @@ func (s *Session) acceptAnnouncement(a *Announcement) {
 	})
 }
 
+func (s *Session) subscribeUpdate(msg *wire.SubscribeUpdateMessage) error {
+	select {
+	case <-s.si.closed:
+		return s.closedError()
+	default:
+	}
+	s.controlStream.enqueue(msg)
+	return nil
+}
+
 func (s *Session) unsubscribe(id uint64) {
 	s.controlStream.enqueue(&wire.UnsubscribeMessage{
 		SubscribeID: id,
 	})
 }
 
-func (s *Session) peerClosed() {
-	s.si.logger.Info("peerClosed called")
+// terminate ends the session with the given cause without closing the
+// connection. It releases all subscriptions and unblocks pending calls.
+func (s *Session) terminate(cause error) {
 	s.si.closeOnce.Do(func() {
+		s.si.logger.Info("session terminated", "cause", cause)
+		s.si.err = cause
 		close(s.si.closed)
-		s.controlStream.close()
+		if s.controlStream != nil {
+			s.controlStream.close()
+		}
+		for _, sub := range s.si.sendSubscriptions.deleteAll() {
+			sub.unsubscribeFromTrack()
+			_ = sub.Close()
+			s.si.endedTracks.add(sub.trackStats())
+		}
+		for _, rt := range s.si.receiveSubscriptions.deleteAll() {
+			rt.close()
+			s.si.endedTracks.add(rt.trackStats())
+		}
+		s.si.scheduler.close()
 	})
 }
 
+// SendSubscriptionStats returns the counters of the send queues of all
+// subscriptions of the peer to local tracks.
+func (s *Session) SendSubscriptionStats() []SendSubscriptionStats {
+	if s.si == nil {
+		return nil
+	}
+	subs := s.si.sendSubscriptions.values()
+	stats := make([]SendSubscriptionStats, 0, len(subs))
+	for _, sub := range subs {
+		stats = append(stats, sub.stats())
+	}
+	return stats
+}
+
+// closedError returns the error returned by calls of a session that ended.
+func (s *Session) closedError() error {
+	return SessionClosedError{
+		cause: s.si.err,
+	}
+}
+
+// Done returns a channel that is closed when the session ended, either because
+// it was closed locally, the peer closed it or a protocol error occurred.
+// Before the session runs, Done returns nil.
+func (s *Session) Done() <-chan struct{} {
+	if s.si == nil {
+		return nil
+	}
+	return s.si.closed
+}
+
+// Err returns nil if Done is not yet closed. Otherwise, it returns the reason
+// the session ended. If the session was closed by CloseWithError, or because
+// of a protocol error, the reason is a ProtocolError carrying the error code.
+// If the connection failed, the reason is the error of the connection.
+func (s *Session) Err() error {
+	if s.si == nil {
+		return nil
+	}
+	select {
+	case <-s.si.closed:
+		return s.si.err
+	default:
+		return nil
+	}
+}
+
 func (s *Session) CloseWithError(code uint64, msg string) error {
 	s.si.logger.Info("CloseWithError called", "code", code, "msg", msg)
-	s.peerClosed()
+	s.terminate(ProtocolError{
+		code:    code,
+		message: msg,
+	})
 	return s.Conn.CloseWithError(code, msg)
 }
 
 func (s *Session) Close() error {
-	return s.CloseWithError(0, "")
+	return s.CloseWithError(ErrorCodeNoError, "session closed")
 }
 
 func (s *Session) AddLocalTrack(t *LocalTrack) error {
@@ -595,18 +1055,43 @@ func (s *Session) AddLocalTrack(t *LocalTrack) error {
 	}, t)
 }
 
-func (s *Session) Subscribe(ctx context.Context, subscribeID, trackAlias uint64, namespace, trackname string, auth string) (*RemoteTrack, error) {
+// Subscribe subscribes to a track of the peer. opts selects the range of
+// objects to receive, if opts is nil, the subscription starts at the latest
+// group. The session allocates the subscribe ID and track alias. If the
+// publisher rejects the track alias and suggests a different one, Subscribe
+// retries with the suggested alias. If ctx expires before the publisher
+// responds, Subscribe returns the error of ctx and unsubscribes as soon as the
+// publisher accepts the subscription.
+func (s *Session) Subscribe(ctx context.Context, namespace, trackname string, auth string, opts *SubscribeOptions) (*RemoteTrack, error) {
+	if s.goingAway() {
+		return nil, errGoingAway
+	}
+	if opts == nil {
+		opts = &SubscribeOptions{}
+	}
+	filterType := opts.FilterType
+	switch filterType {
+	case FilterTypeLatestGroup, FilterTypeLatestObject, FilterTypeAbsoluteStart, FilterTypeAbsoluteRange:
+	default:
+		filterType = FilterTypeLatestGroup
+	}
 	sm := &wire.SubscribeMessage{
-		SubscribeID:    subscribeID,
-		TrackAlias:     trackAlias,
-		TrackNamespace: namespace,
-		TrackName:      trackname,
-		FilterType:     0,
-		StartGroup:     0,
-		StartObject:    0,
-		EndGroup:       0,
-		EndObject:      0,
-		Parameters:     wire.Parameters{},
+		SubscribeID:        0,
+		TrackAlias:         s.allocateTrackAlias(),
+		TrackNamespace:     namespace,
+		TrackName:          trackname,
+		SubscriberPriority: opts.SubscriberPriority,
+		GroupOrder:         opts.GroupOrder,
+		FilterType:         filterType,
+		StartGroup:         opts.StartGroup,
+		StartObject:        opts.StartObject,
+		EndGroup:           opts.EndGroup,
+		EndObject:          opts.EndObject,
+		Parameters:         wire.Parameters{},
+	}
+	window := windowFromFilter(sm.FilterType, sm.StartGroup, sm.StartObject, sm.EndGroup, sm.EndObject)
+	if err := window.valid(); err != nil {
+		return nil, err
 	}
 	if len(auth) > 0 {
 		sm.Parameters[wire.AuthorizationParameterKey] = &wire.StringParameter{
@@ -614,19 +1099,51 @@ func (s *Session) Subscribe(ctx context.Context, subscribeID, trackAlias uint64,
 			Value: auth,
 		}
 	}
-	sub := newRemoteTrack(sm.SubscribeID, s)
+	for retries := 0; ; retries++ {
+		sm.SubscribeID = s.si.nextSubscribeID.Add(1) - 1
+		sub, err := s.subscribe(ctx, sm, window, opts)
+		var retry retryTrackAliasError
+		if !errors.As(err, &retry) {
+			return sub, err
+		}
+		if retries >= maxTrackAliasRetries {
+			return nil, retry.ApplicationError
+		}
+		if s.trackAliasInUse(retry.trackAlias) {
+			return nil, fmt.Errorf("%w: suggested track alias %v is already in use", retry.ApplicationError, retry.trackAlias)
+		}
+		s.si.logger.Info("retrying subscription with suggested track alias", "namespace", namespace, "trackname", trackname, "track_alias", retry.trackAlias)
+		sm.TrackAlias = retry.trackAlias
+	}
+}
+
+// subscribe sends sm and waits for the response of the publisher. If the
+// publisher asks to retry with a different track alias, subscribe returns a
+// retryTrackAliasError.
+func (s *Session) subscribe(ctx context.Context, sm *wire.SubscribeMessage, window deliveryWindow, opts *SubscribeOptions) (*RemoteTrack, error) {
+	sub := newRemoteTrack(sm.SubscribeID, sm.TrackAlias, s, opts.BufferSize, opts.OverflowPolicy)
+	sub.window = window
+	sub.namespace = sm.TrackNamespace
+	sub.trackname = sm.TrackName
 	if err := s.si.receiveSubscriptions.add(sm.SubscribeID, sub); err != nil {
 		return nil, err
 	}
+	start := time.Now()
 	s.controlStream.enqueue(sm)
 	var resp subscribeIDer
 	select {
 	case <-ctx.Done():
+		// Keep the subscription until the response arrives, so that a late
+		// response does not look like a protocol violation.
+		if resp, ok := sub.response.abandon(); ok {
+			s.handleAbandonedSubscriptionResponse(sub, resp)
+		}
 		return nil, ctx.Err()
 	case <-s.si.closed:
-		return nil, errClosed
-	case resp = <-sub.responseCh:
+		return nil, s.closedError()
+	case resp = <-sub.response.ch:
 	}
+	s.si.latencies.observe(sm, start)
 	if resp.GetSubscribeID() != sm.SubscribeID {
 		// Should never happen, because messages are routed based on subscribe
 		// ID. Wrong IDs would thus never end up here.
@@ -635,13 +1152,25 @@ func (s *Session) Subscribe(ctx context.Context, subscribeID, trackAlias uint64,
 	}
 	switch v := resp.(type) {
 	case *wire.SubscribeOkMessage:
+		// Resolve the window like the publisher, so that Update rejects
+		// updates the publisher would consider widening.
+		sub.windowLock.Lock()
+		sub.window = sub.window.startAtLatest(sm.FilterType, location{group: v.FinalGroup, object: v.FinalObject}, v.ContentExists)
+		sub.windowLock.Unlock()
 		return sub, nil
 	case *wire.SubscribeErrorMessage:
 		s.si.receiveSubscriptions.delete(sm.SubscribeID)
-		return nil, ApplicationError{
+		err := ApplicationError{
 			code:   v.ErrorCode,
 			mesage: v.ReasonPhrase,
 		}
+		if v.ErrorCode == SubscribeErrorRetryTrackAlias {
+			return nil, retryTrackAliasError{
+				ApplicationError: err,
+				trackAlias:       v.TrackAlias,
+			}
+		}
+		return nil, err
 	}
 	// Should never happen, because only subscribeMessage, subscribeOkMessage
 	// and susbcribeErrorMessage implement the SubscribeIDer interface and
@@ -649,30 +1178,62 @@ func (s *Session) Subscribe(ctx context.Context, subscribeID, trackAlias uint64,
 	return nil, errors.New("received unexpected response message type to subscribeRequestMessage")
 }
 
+// allocateTrackAlias returns the next track alias which is not used by any
+// subscription of the session.
+func (s *Session) allocateTrackAlias() uint64 {
+	for {
+		alias := s.si.nextTrackAlias.Add(1) - 1
+		if !s.trackAliasInUse(alias) {
+			return alias
+		}
+	}
+}
+
+func (s *Session) trackAliasInUse(alias uint64) bool {
+	for _, t := range s.si.receiveSubscriptions.values() {
+		if t.trackAlias == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// Announce announces namespace to the peer and waits for the response. If ctx
+// expires before the peer responds, Announce returns the error of ctx and
+// withdraws the announcement as soon as the peer accepts it.
 func (s *Session) Announce(ctx context.Context, namespace string) error {
 	if len(namespace) == 0 {
 		return errors.New("invalid track namespace")
 	}
+	if s.goingAway() {
+		return errGoingAway
+	}
 	am := &wire.AnnounceMessage{
 		TrackNamespace: namespace,
 		Parameters:     wire.Parameters{},
 	}
-	responseCh := make(chan trackNamespacer)
 	a := &Announcement{
-		responseCh: responseCh,
+		response: newPendingResponse[trackNamespacer](),
 	}
 	if err := s.si.localAnnouncements.add(am.TrackNamespace, a); err != nil {
 		return err
 	}
+	start := time.Now()
 	s.controlStream.enqueue(am)
 	var resp trackNamespacer
 	select {
 	case <-ctx.Done():
+		// Keep the announcement until the response arrives, so that a late
+		// response does not look like a protocol violation.
+		if resp, ok := a.response.abandon(); ok {
+			s.handleAbandonedAnnouncementResponse(resp)
+		}
 		return ctx.Err()
 	case <-s.si.closed:
-		return errClosed
-	case resp = <-responseCh:
+		return s.closedError()
+	case resp = <-a.response.ch:
 	}
+	s.si.latencies.observe(am, start)
 	if resp.GetTrackNamespace() != am.TrackNamespace {
 		// Should never happen, because messages are routed based on trackname.
 		// Wrong tracknames would thus never end up here.
@@ -683,6 +1244,7 @@ func (s *Session) Announce(ctx context.Context, namespace string) error {
 	case *wire.AnnounceOkMessage:
 		return nil
 	case *wire.AnnounceErrorMessage:
+		s.si.localAnnouncements.delete(am.TrackNamespace)
 		return ApplicationError{
 			code:   v.ErrorCode,
 			mesage: v.ReasonPhrase,
@@ -693,3 +1255,79 @@ func (s *Session) Announce(ctx context.Context, namespace string) error {
 	// announceMessages should not be routed to this method.
 	return errors.New("received unexpected response message type to announceMessage")
 }
+
+// Unannounce withdraws an announcement of namespace previously made with
+// Announce.
+func (s *Session) Unannounce(namespace string) error {
+	if _, ok := s.si.localAnnouncements.getAndDelete(namespace); !ok {
+		return errors.New("unknown announcement")
+	}
+	s.controlStream.enqueue(&wire.UnannounceMessage{
+		TrackNamespace: namespace,
+	})
+	return nil
+}
+
+// TrackStatus requests the status of a track from the peer. Concurrent
+// requests for the same track receive the responses in the order in which
+// they were sent.
+func (s *Session) TrackStatus(ctx context.Context, namespace, trackname string) (TrackStatus, error) {
+	key := trackKey{
+		namespace: namespace,
+		trackname: trackname,
+	}
+	responseCh := make(chan *wire.TrackStatusMessage, 1)
+	s.si.trackStatusRequests.add(key, responseCh)
+	req := &wire.TrackStatusRequestMessage{
+		TrackNamespace: namespace,
+		TrackName:      trackname,
+	}
+	start := time.Now()
+	s.controlStream.enqueue(req)
+	select {
+	case <-ctx.Done():
+		// The request stays queued to consume its response.
+		return TrackStatus{}, ctx.Err()
+	case <-s.si.closed:
+		return TrackStatus{}, s.closedError()
+	case resp := <-responseCh:
+		s.si.latencies.observe(req, start)
+		return TrackStatus{
+			StatusCode:     resp.StatusCode,
+			LatestGroupID:  resp.LatestGroupID,
+			LatestObjectID: resp.LatestObjectID,
+		}, nil
+	}
+}
+
+// GoAway asks the client to migrate to a new session at uri. New subscriptions
+// and announcements are refused after calling GoAway. If the client does not
+// close the session within timeout, the session is closed with
+// ErrorCodeGoAwayTimeout. GoAway may only be called on server sessions.
+func (s *Session) GoAway(uri string, timeout time.Duration) error {
+	if s.isClient {
+		return errors.New("only servers can send GOAWAY")
+	}
+	first := false
+	s.si.goAwayOnce.Do(func() {
+		close(s.si.goAwayCh)
+		first = true
+	})
+	if !first {
+		return errors.New("GOAWAY already sent")
+	}
+	s.controlStream.enqueue(&wire.GoAwayMessage{
+		NewSessionURI: uri,
+	})
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-s.si.closed:
+		case <-timer.C:
+			s.si.logger.Info("peer did not close session after GOAWAY")
+			_ = s.CloseWithError(ErrorCodeGoAwayTimeout, "GOAWAY timeout")
+		}
+	}()
+	return nil
+}
@@ -2,6 +2,9 @@ package moqtransport
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"testing"
 	"time"
 
@@ -12,16 +15,20 @@ import (
 
 func session(conn Connection, ctrl controlMessageSender, h AnnouncementHandler) *Session {
 	s := &Session{
-		Conn:                conn,
-		EnableDatagrams:     false,
-		LocalRole:           0,
-		RemoteRole:          0,
-		AnnouncementHandler: h,
-		SubscriptionHandler: nil,
-		handshakeDone:       false,
-		controlStream:       nil,
-		isClient:            false,
-		si:                  newSessionInternals("SERVER"),
+		Conn:                      conn,
+		EnableDatagrams:           false,
+		LocalRole:                 0,
+		RemoteRole:                0,
+		AnnouncementHandler:       h,
+		AnnouncementCancelHandler: nil,
+		SubscriptionHandler:       nil,
+		TrackStatusHandler:        nil,
+		GoAwayHandler:             nil,
+		SupportedVersions:         nil,
+		handshakeDone:             false,
+		controlStream:             nil,
+		isClient:                  false,
+		si:                        newSessionInternals("SERVER"),
 	}
 	s.storeControlStream(ctrl)
 	return s
@@ -33,7 +40,7 @@ func TestSession(t *testing.T) {
 		mc := NewMockConnection(ctrl)
 		done := make(chan struct{})
 		s := session(mc, nil, nil)
-		err := s.si.receiveSubscriptions.add(0, newRemoteTrack(0, s))
+		err := s.si.receiveSubscriptions.add(0, newRemoteTrack(0, 0, s, 0, OverflowPolicyBlock))
 		assert.NoError(t, err)
 		object := Object{
 			GroupID:              0,
@@ -84,6 +91,185 @@ func TestSession(t *testing.T) {
 		assert.NoError(t, err)
 		close(done)
 	})
+	t.Run("handle_client_setup_selects_highest_common_version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(&wire.ServerSetupMessage{
+			SelectedVersion: wire.Draft_ietf_moq_transport_04,
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.Draft_ietf_moq_transport_03, wire.Draft_ietf_moq_transport_04},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, VersionDraft04, s.Version())
+	})
+	t.Run("handle_client_setup_unsupported_version", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.SupportedVersions = []Version{VersionDraft05}
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeUnsupportedVersion), gomock.Any())
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.Draft_ietf_moq_transport_04},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, Version(0), s.Version())
+	})
+	t.Run("unexpected_message_type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeInternal), "received unexpected message type on control stream")
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ServerSetupMessage{
+			SelectedVersion: wire.CurrentVersion,
+			SetupParameters: wire.Parameters{},
+		})
+		var pe ProtocolError
+		if assert.ErrorAs(t, err, &pe) {
+			assert.Equal(t, uint64(ErrorCodeInternal), pe.Code())
+		}
+		s.handleControlStreamError(err)
+		assert.ErrorAs(t, s.Err(), &pe)
+	})
+	t.Run("handle_control_stream_error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeProtocolViolation), "invalid control message")
+		assert.NoError(t, s.Err())
+		s.handleControlStreamError(ProtocolError{
+			code:    ErrorCodeProtocolViolation,
+			message: "invalid control message",
+		})
+		select {
+		case <-s.Done():
+		default:
+			assert.Fail(t, "session not done")
+		}
+		var pe ProtocolError
+		assert.ErrorAs(t, s.Err(), &pe)
+		assert.Equal(t, uint64(ErrorCodeProtocolViolation), pe.Code())
+	})
+	t.Run("handle_control_stream_read_error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		csh.EXPECT().close()
+		connErr := ApplicationError{
+			code:   3,
+			mesage: "peer closed the connection",
+		}
+		s.handleControlStreamError(streamReadError{
+			err: connErr,
+		})
+		select {
+		case <-s.Done():
+		default:
+			assert.Fail(t, "session not done")
+		}
+		assert.Equal(t, connErr, s.Err())
+	})
+	t.Run("unexpected_subscription_response_does_not_block", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		err := s.si.receiveSubscriptions.add(0, newRemoteTrack(0, 0, s, 0, OverflowPolicyBlock))
+		assert.NoError(t, err)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 2; i++ {
+				assert.NoError(t, s.handleSubscriptionResponse(&wire.SubscribeOkMessage{
+					SubscribeID: 0,
+				}))
+			}
+		}()
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+	})
+	t.Run("close_unblocks_pending_calls", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		enqueued := make(chan struct{}, 2)
+		csh.EXPECT().enqueue(gomock.Any()).Do(func(wire.Message) {
+			enqueued <- struct{}{}
+		}).Times(2)
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeInternal), "failure")
+		errCh := make(chan error, 2)
+		go func() {
+			_, err := s.Subscribe(context.Background(), "namespace", "track", "", nil)
+			errCh <- err
+		}()
+		go func() {
+			errCh <- s.Announce(context.Background(), "namespace")
+		}()
+		<-enqueued
+		<-enqueued
+		assert.NoError(t, s.CloseWithError(ErrorCodeInternal, "failure"))
+		for i := 0; i < 2; i++ {
+			select {
+			case <-time.After(time.Second):
+				assert.Fail(t, "test timed out")
+			case err := <-errCh:
+				var sce SessionClosedError
+				assert.ErrorAs(t, err, &sce)
+				var pe ProtocolError
+				assert.ErrorAs(t, err, &pe)
+				assert.Equal(t, uint64(ErrorCodeInternal), pe.Code())
+			}
+		}
+	})
 	t.Run("handle_subscribe_request", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		mc := NewMockConnection(ctrl)
@@ -136,22 +322,32 @@ func TestSession(t *testing.T) {
 		case <-done:
 		}
 	})
-	t.Run("handle_announcement", func(t *testing.T) {
+	t.Run("send_object_failure", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		mc := NewMockConnection(ctrl)
 		csh := NewMockControlMessageSender(ctrl)
-		s := session(mc, csh, AnnouncementHandlerFunc(func(s *Session, a *Announcement, arw AnnouncementResponseWriter) {
-			assert.NotNil(t, a)
-			arw.Accept()
-		}))
+		s := session(mc, csh, nil)
 		done := make(chan struct{})
-		csh.EXPECT().enqueue(gomock.Any()).Times(1) // setup message
-		csh.EXPECT().enqueue(&wire.AnnounceOkMessage{
-			TrackNamespace: "namespace",
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and SubscribeOk message
+		csh.EXPECT().enqueue(&wire.SubscribeDoneMessage{
+			SubscribeID:   17,
+			StatusCode:    SubscribeStatusInternalError,
+			ReasonPhrase:  "stream limit reached",
+			ContentExists: false,
+			FinalGroup:    0,
+			FinalObject:   0,
 		}).Do(func(_ wire.Message) {
 			close(done)
 		})
-		err := s.handleControlMessage(&wire.ClientSetupMessage{
+		mc.EXPECT().OpenUniStream().Return(nil, errors.New("stream limit reached"))
+		errCh := make(chan error, 1)
+		track := NewLocalTrack("namespace", "track", WithSubscriberErrorHandler(func(err error) {
+			errCh <- err
+		}))
+		defer track.Close()
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
 			SupportedVersions: []wire.Version{wire.CurrentVersion},
 			SetupParameters: wire.Parameters{
 				wire.RoleParameterKey: &wire.VarintParameter{
@@ -161,46 +357,60 @@ func TestSession(t *testing.T) {
 			},
 		})
 		assert.NoError(t, err)
-		err = s.handleControlMessage(&wire.AnnounceMessage{
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackAlias:     0,
 			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestObject,
 			Parameters:     wire.Parameters{},
 		})
 		assert.NoError(t, err)
+		err = track.WriteObject(context.Background(), Object{
+			GroupID:              0,
+			ObjectID:             0,
+			ForwardingPreference: ObjectForwardingPreferenceStream,
+			Payload:              []byte("hello"),
+		})
+		assert.NoError(t, err)
 		select {
 		case <-time.After(time.Second):
 			assert.Fail(t, "test timed out")
 		case <-done:
 		}
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case err = <-errCh:
+			assert.ErrorContains(t, err, "stream limit reached")
+		}
+		assert.Equal(t, 0, track.SubscriberCount())
+		_, ok := s.si.sendSubscriptions.get(17)
+		assert.False(t, ok)
 	})
-	t.Run("subscribe", func(t *testing.T) {
+	t.Run("handle_subscribe_absolute_range", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		mc := NewMockConnection(ctrl)
 		csh := NewMockControlMessageSender(ctrl)
 		s := session(mc, csh, nil)
 		done := make(chan struct{})
-		csh.EXPECT().enqueue(gomock.Any()).Times(1)
-		csh.EXPECT().enqueue(&wire.SubscribeMessage{
-			SubscribeID:    17,
-			TrackAlias:     0,
-			TrackNamespace: "namespace",
-			TrackName:      "track",
-			FilterType:     0,
-			StartGroup:     0,
-			StartObject:    0,
-			EndGroup:       0,
-			EndObject:      0,
-			Parameters:     wire.Parameters{wire.AuthorizationParameterKey: &wire.StringParameter{Type: wire.AuthorizationParameterKey, Value: "auth"}},
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and SubscribeOk message
+		mc.EXPECT().SendDatagram(gomock.Any()).Times(2)
+		csh.EXPECT().enqueue(&wire.SubscribeDoneMessage{
+			SubscribeID:   17,
+			StatusCode:    SubscribeStatusSubscriptionEnded,
+			ReasonPhrase:  "end of subscription range reached",
+			ContentExists: true,
+			FinalGroup:    1,
+			FinalObject:   1,
 		}).Do(func(_ wire.Message) {
-			go func() {
-				err := s.handleControlMessage(&wire.SubscribeOkMessage{
-					SubscribeID: 17,
-					Expires:     time.Second,
-				})
-				assert.NoError(t, err)
-				close(done)
-			}()
+			close(done)
 		})
-		err := s.handleControlMessage(&wire.ClientSetupMessage{
+		track := NewLocalTrack("namespace", "track")
+		defer track.Close()
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
 			SupportedVersions: []wire.Version{wire.CurrentVersion},
 			SetupParameters: wire.Parameters{
 				wire.RoleParameterKey: &wire.VarintParameter{
@@ -210,35 +420,76 @@ func TestSession(t *testing.T) {
 			},
 		})
 		assert.NoError(t, err)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		track, err := s.Subscribe(ctx, 17, 0, "namespace", "track", "auth")
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeAbsoluteRange,
+			StartGroup:     1,
+			StartObject:    0,
+			EndGroup:       1,
+			EndObject:      2,
+			Parameters:     wire.Parameters{},
+		})
 		assert.NoError(t, err)
-		assert.NotNil(t, track)
+		for _, o := range []Object{{GroupID: 0, ObjectID: 0}, {GroupID: 1, ObjectID: 0}, {GroupID: 1, ObjectID: 1}} {
+			err = track.WriteObject(context.Background(), o)
+			assert.NoError(t, err)
+		}
 		select {
 		case <-time.After(time.Second):
 			assert.Fail(t, "test timed out")
 		case <-done:
 		}
+		_, ok := s.si.sendSubscriptions.get(17)
+		assert.False(t, ok)
 	})
-	t.Run("announce", func(t *testing.T) {
+	t.Run("handle_subscribe_invalid_range", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		mc := NewMockConnection(ctrl)
 		csh := NewMockControlMessageSender(ctrl)
 		s := session(mc, csh, nil)
-		csh.EXPECT().enqueue(gomock.Any()).Times(1)
-		csh.EXPECT().enqueue(&wire.AnnounceMessage{
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.SubscribeErrorMessage{
+			SubscribeID:  17,
+			ErrorCode:    SubscribeErrorInvalidRange,
+			ReasonPhrase: errInvalidWindow.Error(),
+			TrackAlias:   0,
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
 			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeAbsoluteRange,
+			StartGroup:     4,
+			StartObject:    0,
+			EndGroup:       2,
+			EndObject:      0,
 			Parameters:     wire.Parameters{},
-		}).Do(func(_ wire.Message) {
-			go func() {
-				err := s.handleControlMessage(&wire.AnnounceOkMessage{
-					TrackNamespace: "namespace",
-				})
-				assert.NoError(t, err)
-			}()
 		})
-		err := s.handleControlMessage(&wire.ClientSetupMessage{
+		assert.NoError(t, err)
+	})
+	t.Run("handle_subscribe_update", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and SubscribeOk message
+		track := NewLocalTrack("namespace", "track")
+		defer track.Close()
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
 			SupportedVersions: []wire.Version{wire.CurrentVersion},
 			SetupParameters: wire.Parameters{
 				wire.RoleParameterKey: &wire.VarintParameter{
@@ -248,9 +499,1083 @@ func TestSession(t *testing.T) {
 			},
 		})
 		assert.NoError(t, err)
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
-		err = s.Announce(ctx, "namespace")
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestGroup,
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeUpdateMessage{
+			SubscribeID:        17,
+			StartGroup:         2,
+			StartObject:        0,
+			EndGroup:           5,
+			EndObject:          0,
+			SubscriberPriority: 3,
+			Parameters:         wire.Parameters{},
+		})
 		assert.NoError(t, err)
+		sub, ok := s.si.sendSubscriptions.get(17)
+		assert.True(t, ok)
+		assert.Equal(t, uint8(3), sub.subscriberPriority)
+		assert.False(t, sub.inWindow(Object{GroupID: 1, ObjectID: 7}))
+		assert.True(t, sub.inWindow(Object{GroupID: 4, ObjectID: 7}))
+		assert.False(t, sub.inWindow(Object{GroupID: 5, ObjectID: 0}))
 	})
+	t.Run("handle_subscribe_update_before_resolved_start", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.SubscribeOkMessage{
+			SubscribeID:   17,
+			Expires:       0,
+			GroupOrder:    1,
+			ContentExists: true,
+			FinalGroup:    4,
+			FinalObject:   0,
+		})
+		track := NewLocalTrack("namespace", "track")
+		defer track.Close()
+		for g := uint64(0); g < 5; g++ {
+			assert.NoError(t, track.WriteObject(context.Background(), Object{GroupID: g, ObjectID: 0, Payload: []byte{}}))
+		}
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestGroup,
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+
+		// The update starts before the resolved start, which is moved to
+		// the resolved start instead of closing the session.
+		err = s.handleControlMessage(&wire.SubscribeUpdateMessage{
+			SubscribeID: 17,
+			StartGroup:  0,
+			EndGroup:    10,
+			Parameters:  wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		sub, ok := s.si.sendSubscriptions.get(17)
+		assert.True(t, ok)
+		assert.False(t, sub.inWindow(Object{GroupID: 3, ObjectID: 0}))
+		assert.True(t, sub.inWindow(Object{GroupID: 4, ObjectID: 0}))
+		assert.False(t, sub.inWindow(Object{GroupID: 10, ObjectID: 0}))
+	})
+	t.Run("handle_widening_subscribe_update", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and SubscribeOk message
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeProtocolViolation), gomock.Any())
+		track := NewLocalTrack("namespace", "track")
+		defer track.Close()
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestGroup,
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeUpdateMessage{
+			SubscribeID: 17,
+			StartGroup:  2,
+			EndGroup:    5,
+			Parameters:  wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeUpdateMessage{
+			SubscribeID: 17,
+			StartGroup:  1,
+			EndGroup:    5,
+			Parameters:  wire.Parameters{},
+		})
+		assert.NoError(t, err)
+	})
+	t.Run("handle_announcement", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, AnnouncementHandlerFunc(func(s *Session, a *Announcement, arw AnnouncementResponseWriter) {
+			assert.NotNil(t, a)
+			arw.Accept()
+		}))
+		done := make(chan struct{})
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // setup message
+		csh.EXPECT().enqueue(&wire.AnnounceOkMessage{
+			TrackNamespace: "namespace",
+		}).Do(func(_ wire.Message) {
+			close(done)
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+	})
+	t.Run("subscribe", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		done := make(chan struct{})
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(&wire.SubscribeMessage{
+			SubscribeID:    0,
+			TrackAlias:     0,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestGroup,
+			StartGroup:     0,
+			StartObject:    0,
+			EndGroup:       0,
+			EndObject:      0,
+			Parameters:     wire.Parameters{wire.AuthorizationParameterKey: &wire.StringParameter{Type: wire.AuthorizationParameterKey, Value: "auth"}},
+		}).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.SubscribeOkMessage{
+					SubscribeID: 0,
+					Expires:     time.Second,
+				})
+				assert.NoError(t, err)
+				close(done)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		track, err := s.Subscribe(ctx, "namespace", "track", "auth", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, track)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+	})
+	t.Run("stats_before_run", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		s := &Session{
+			Conn: mc,
+		}
+		assert.Equal(t, SessionStats{}, s.Stats())
+		assert.Empty(t, s.SendSubscriptionStats())
+		assert.Nil(t, s.Done())
+		assert.NoError(t, s.Err())
+	})
+	t.Run("stats", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(gomock.AssignableToTypeOf(&wire.SubscribeMessage{})).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.SubscribeOkMessage{
+					SubscribeID: 0,
+					Expires:     time.Second,
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		track, err := s.Subscribe(ctx, "namespace", "track", "auth", nil)
+		assert.NoError(t, err)
+		track.push(Object{GroupID: 0, ObjectID: 0, Payload: []byte("hello")})
+		track.push(Object{GroupID: 0, ObjectID: 1, Payload: []byte("world!")})
+
+		stats := s.Stats()
+		assert.Equal(t, 0, stats.SendSubscriptions)
+		assert.Equal(t, 1, stats.ReceiveSubscriptions)
+		assert.Equal(t, map[string]uint64{
+			"CLIENT_SETUP": 1,
+			"SUBSCRIBE_OK": 1,
+		}, stats.ControlMessagesReceived)
+		assert.Equal(t, []TrackStats{{
+			Namespace:             "namespace",
+			TrackName:             "track",
+			ObjectsSent:           0,
+			BytesSent:             0,
+			SendDroppedObjects:    0,
+			ObjectsReceived:       2,
+			BytesReceived:         11,
+			ReceiveDroppedObjects: 0,
+		}}, stats.Tracks)
+
+		// Counters of ended subscriptions remain in the stats.
+		err = s.handleControlMessage(&wire.SubscribeDoneMessage{
+			SubscribeID:   0,
+			StatusCode:    0,
+			ReasonPhrase:  "",
+			ContentExists: false,
+			FinalGroup:    0,
+			FinalObject:   0,
+		})
+		assert.NoError(t, err)
+		stats = s.Stats()
+		assert.Equal(t, 0, stats.ReceiveSubscriptions)
+		assert.Equal(t, []TrackStats{{
+			Namespace:             "namespace",
+			TrackName:             "track",
+			ObjectsSent:           0,
+			BytesSent:             0,
+			SendDroppedObjects:    0,
+			ObjectsReceived:       2,
+			BytesReceived:         11,
+			ReceiveDroppedObjects: 0,
+		}}, stats.Tracks)
+	})
+	t.Run("handle_subscribe_done_waits_for_final_object", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(gomock.AssignableToTypeOf(&wire.SubscribeMessage{})).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.SubscribeOkMessage{
+					SubscribeID: 0,
+					Expires:     time.Second,
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		track, err := s.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		track.push(Object{GroupID: 0, ObjectID: 0, Payload: []byte("hello")})
+		err = s.handleControlMessage(&wire.SubscribeDoneMessage{
+			SubscribeID:   0,
+			StatusCode:    0,
+			ReasonPhrase:  "",
+			ContentExists: true,
+			FinalGroup:    0,
+			FinalObject:   1,
+		})
+		assert.NoError(t, err)
+
+		// The final object arrives after SUBSCRIBE_DONE.
+		o, err := track.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(0), o.ObjectID)
+		_, ok := s.si.receiveSubscriptions.get(0)
+		assert.True(t, ok)
+		track.push(Object{GroupID: 0, ObjectID: 1, Payload: []byte("world")})
+		o, err = track.ReadObject(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(1), o.ObjectID)
+		_, err = track.ReadObject(ctx)
+		assert.ErrorIs(t, err, io.EOF)
+		_, ok = s.si.receiveSubscriptions.get(0)
+		assert.False(t, ok)
+	})
+	t.Run("subscribe_allocates_ids", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		assert.NoError(t, s.handleControlMessage(&wire.ServerSetupMessage{
+			SelectedVersion: wire.CurrentVersion,
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		}))
+		for i := uint64(0); i < 2; i++ {
+			csh.EXPECT().enqueue(&wire.SubscribeMessage{
+				SubscribeID:    i,
+				TrackAlias:     i,
+				TrackNamespace: "namespace",
+				TrackName:      fmt.Sprintf("track%v", i),
+				FilterType:     wire.FilterTypeLatestGroup,
+				Parameters:     wire.Parameters{},
+			}).Do(func(_ wire.Message) {
+				go func() {
+					assert.NoError(t, s.handleControlMessage(&wire.SubscribeOkMessage{
+						SubscribeID: i,
+					}))
+				}()
+			})
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		for i := 0; i < 2; i++ {
+			track, err := s.Subscribe(ctx, "namespace", fmt.Sprintf("track%v", i), "", nil)
+			assert.NoError(t, err)
+			assert.NotNil(t, track)
+		}
+	})
+	t.Run("subscribe_retry_track_alias", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		assert.NoError(t, s.handleControlMessage(&wire.ServerSetupMessage{
+			SelectedVersion: wire.CurrentVersion,
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		}))
+		gomock.InOrder(
+			csh.EXPECT().enqueue(&wire.SubscribeMessage{
+				SubscribeID:    0,
+				TrackAlias:     0,
+				TrackNamespace: "namespace",
+				TrackName:      "track",
+				FilterType:     wire.FilterTypeLatestGroup,
+				Parameters:     wire.Parameters{},
+			}).Do(func(_ wire.Message) {
+				go func() {
+					assert.NoError(t, s.handleControlMessage(&wire.SubscribeErrorMessage{
+						SubscribeID:  0,
+						ErrorCode:    SubscribeErrorRetryTrackAlias,
+						ReasonPhrase: "retry track alias",
+						TrackAlias:   7,
+					}))
+				}()
+			}),
+			csh.EXPECT().enqueue(&wire.SubscribeMessage{
+				SubscribeID:    1,
+				TrackAlias:     7,
+				TrackNamespace: "namespace",
+				TrackName:      "track",
+				FilterType:     wire.FilterTypeLatestGroup,
+				Parameters:     wire.Parameters{},
+			}).Do(func(_ wire.Message) {
+				go func() {
+					assert.NoError(t, s.handleControlMessage(&wire.SubscribeOkMessage{
+						SubscribeID: 1,
+					}))
+				}()
+			}),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		track, err := s.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(7), track.trackAlias)
+	})
+	t.Run("handle_subscribe_duplicate_track_alias", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and SubscribeOk message
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeDuplicateTrackAlias), gomock.Any())
+		for _, name := range []string{"track1", "track2"} {
+			track := NewLocalTrack("namespace", name)
+			defer track.Close()
+			assert.NoError(t, s.AddLocalTrack(track))
+		}
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		for i, name := range []string{"track1", "track2"} {
+			err = s.handleControlMessage(&wire.SubscribeMessage{
+				SubscribeID:    uint64(i),
+				TrackAlias:     3,
+				TrackNamespace: "namespace",
+				TrackName:      name,
+				FilterType:     wire.FilterTypeLatestGroup,
+				Parameters:     wire.Parameters{},
+			})
+			assert.NoError(t, err)
+		}
+		select {
+		case <-s.Done():
+		default:
+			assert.Fail(t, "session not closed")
+		}
+	})
+	t.Run("announce", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		}).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.AnnounceOkMessage{
+					TrackNamespace: "namespace",
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = s.Announce(ctx, "namespace")
+		assert.NoError(t, err)
+	})
+	t.Run("announce_timeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		})
+		csh.EXPECT().enqueue(&wire.UnannounceMessage{
+			TrackNamespace: "namespace",
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err = s.Announce(ctx, "namespace")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		err = s.handleControlMessage(&wire.AnnounceOkMessage{
+			TrackNamespace: "namespace",
+		})
+		assert.NoError(t, err)
+		_, ok := s.si.localAnnouncements.get("namespace")
+		assert.False(t, ok)
+	})
+	t.Run("subscribe_timeout", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(2)
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = s.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		csh.EXPECT().enqueue(&wire.UnsubscribeMessage{
+			SubscribeID: 0,
+		})
+		err = s.handleControlMessage(&wire.SubscribeOkMessage{
+			SubscribeID: 0,
+			Expires:     time.Second,
+		})
+		assert.NoError(t, err)
+		_, ok := s.si.receiveSubscriptions.get(0)
+		assert.False(t, ok)
+		assert.NoError(t, s.Err())
+	})
+	t.Run("subscribe_update", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.SubscribeUpdateMessage{
+			SubscribeID:        17,
+			StartGroup:         2,
+			StartObject:        0,
+			EndGroup:           5,
+			EndObject:          0,
+			SubscriberPriority: 1,
+			Parameters:         wire.Parameters{},
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		track := newRemoteTrack(17, 0, s, 0, OverflowPolicyBlock)
+		err = track.Update(context.Background(), 2, 0, 5, 0, 1)
+		assert.NoError(t, err)
+		err = track.Update(context.Background(), 2, 0, 0, 0, 1)
+		assert.Error(t, err)
+		err = track.Update(context.Background(), 1, 0, 5, 0, 1)
+		assert.Error(t, err)
+	})
+	t.Run("subscribe_latest_update", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(gomock.AssignableToTypeOf(&wire.SubscribeMessage{})).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.SubscribeOkMessage{
+					SubscribeID:   0,
+					Expires:       0,
+					GroupOrder:    1,
+					ContentExists: true,
+					FinalGroup:    4,
+					FinalObject:   2,
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		csh.EXPECT().enqueue(&wire.SubscribeUpdateMessage{
+			SubscribeID:        0,
+			StartGroup:         4,
+			StartObject:        0,
+			EndGroup:           10,
+			EndObject:          0,
+			SubscriberPriority: 0,
+			Parameters:         wire.Parameters{},
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		track, err := s.Subscribe(ctx, "namespace", "track", "", nil)
+		assert.NoError(t, err)
+
+		// The latest group filter resolved to group 4, so an update starting
+		// at group 0 widens the subscription.
+		err = track.Update(ctx, 0, 0, 10, 0, 0)
+		assert.ErrorIs(t, err, errWindowNotNarrow)
+		err = track.Update(ctx, 4, 0, 10, 0, 0)
+		assert.NoError(t, err)
+	})
+	t.Run("unannounce", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1)
+		csh.EXPECT().enqueue(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		}).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.AnnounceOkMessage{
+					TrackNamespace: "namespace",
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		csh.EXPECT().enqueue(&wire.UnannounceMessage{
+			TrackNamespace: "namespace",
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = s.Announce(ctx, "namespace")
+		assert.NoError(t, err)
+		err = s.Unannounce("namespace")
+		assert.NoError(t, err)
+		err = s.Unannounce("namespace")
+		assert.Error(t, err)
+	})
+	t.Run("handle_unannounce", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		accepted := make(chan struct{})
+		done := make(chan struct{})
+		s := session(mc, csh, &unannouncementHandler{
+			AnnouncementHandlerFunc: func(_ *Session, _ *Announcement, arw AnnouncementResponseWriter) {
+				arw.Accept()
+				close(accepted)
+			},
+			unannounced: func(_ *Session, a *Announcement) {
+				assert.Equal(t, "namespace", a.Namespace())
+				close(done)
+			},
+		})
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and AnnounceOk message
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		<-accepted
+		err = s.handleControlMessage(&wire.UnannounceMessage{
+			TrackNamespace: "namespace",
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+		_, ok := s.si.remoteAnnouncements.get("namespace")
+		assert.False(t, ok)
+	})
+	t.Run("cancel_announcement", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		done := make(chan struct{})
+		s := session(mc, csh, AnnouncementHandlerFunc(func(_ *Session, a *Announcement, arw AnnouncementResponseWriter) {
+			arw.Accept()
+			assert.NoError(t, a.Cancel(0, "done"))
+		}))
+		csh.EXPECT().enqueue(gomock.Any()).Times(2) // Setup and AnnounceOk message
+		csh.EXPECT().enqueue(&wire.AnnounceCancelMessage{
+			TrackNamespace: "namespace",
+		}).Do(func(_ wire.Message) {
+			close(done)
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+		_, ok := s.si.remoteAnnouncements.get("namespace")
+		assert.False(t, ok)
+	})
+	t.Run("handle_announce_cancel", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		done := make(chan struct{})
+		s.AnnouncementCancelHandler = AnnouncementCancelHandlerFunc(func(_ *Session, namespace string) {
+			assert.Equal(t, "namespace", namespace)
+			close(done)
+		})
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.AnnounceMessage{
+			TrackNamespace: "namespace",
+			Parameters:     wire.Parameters{},
+		}).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.AnnounceOkMessage{
+					TrackNamespace: "namespace",
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err = s.Announce(ctx, "namespace")
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.AnnounceCancelMessage{
+			TrackNamespace: "namespace",
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+		_, ok := s.si.localAnnouncements.get("namespace")
+		assert.False(t, ok)
+	})
+	t.Run("handle_track_status_request", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		done := make(chan struct{})
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.TrackStatusMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			StatusCode:     TrackStatusInProgress,
+			LatestGroupID:  3,
+			LatestObjectID: 2,
+		})
+		csh.EXPECT().enqueue(&wire.TrackStatusMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "unknown",
+			StatusCode:     TrackStatusDoesNotExist,
+			LatestGroupID:  0,
+			LatestObjectID: 0,
+		}).Do(func(_ wire.Message) {
+			close(done)
+		})
+		track := NewLocalTrack("namespace", "track")
+		defer track.Close()
+		err := s.AddLocalTrack(track)
+		assert.NoError(t, err)
+		for _, o := range []Object{{GroupID: 3, ObjectID: 1}, {GroupID: 3, ObjectID: 2}, {GroupID: 2, ObjectID: 5}} {
+			err = track.WriteObject(context.Background(), o)
+			assert.NoError(t, err)
+		}
+		err = s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.TrackStatusRequestMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.TrackStatusRequestMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "unknown",
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+	})
+	t.Run("track_status", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.TrackStatusRequestMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+		}).Do(func(_ wire.Message) {
+			go func() {
+				err := s.handleControlMessage(&wire.TrackStatusMessage{
+					TrackNamespace: "namespace",
+					TrackName:      "track",
+					StatusCode:     TrackStatusInProgress,
+					LatestGroupID:  7,
+					LatestObjectID: 8,
+				})
+				assert.NoError(t, err)
+			}()
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		status, err := s.TrackStatus(ctx, "namespace", "track")
+		assert.NoError(t, err)
+		assert.Equal(t, TrackStatus{
+			StatusCode:     TrackStatusInProgress,
+			LatestGroupID:  7,
+			LatestObjectID: 8,
+		}, status)
+	})
+	t.Run("go_away", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		done := make(chan struct{})
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.GoAwayMessage{
+			NewSessionURI: "https://example.com/moq",
+		})
+		csh.EXPECT().enqueue(&wire.SubscribeErrorMessage{
+			SubscribeID:  17,
+			ErrorCode:    SubscribeErrorInternal,
+			ReasonPhrase: errGoingAway.Error(),
+			TrackAlias:   0,
+		})
+		csh.EXPECT().close()
+		mc.EXPECT().CloseWithError(uint64(ErrorCodeGoAwayTimeout), gomock.Any()).Do(func(uint64, string) {
+			close(done)
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.GoAway("https://example.com/moq", 10*time.Millisecond)
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.SubscribeMessage{
+			SubscribeID:    17,
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+			FilterType:     wire.FilterTypeLatestGroup,
+			Parameters:     wire.Parameters{},
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+	})
+	t.Run("concurrent_track_status", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		requested := make(chan struct{}, 2)
+		csh.EXPECT().enqueue(gomock.Any()).Times(1) // Setup message
+		csh.EXPECT().enqueue(&wire.TrackStatusRequestMessage{
+			TrackNamespace: "namespace",
+			TrackName:      "track",
+		}).Times(2).Do(func(_ wire.Message) {
+			requested <- struct{}{}
+		})
+		err := s.handleControlMessage(&wire.ClientSetupMessage{
+			SupportedVersions: []wire.Version{wire.CurrentVersion},
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		statusChs := []chan TrackStatus{}
+		for i := 0; i < 2; i++ {
+			statusCh := make(chan TrackStatus, 1)
+			statusChs = append(statusChs, statusCh)
+			go func() {
+				status, err := s.TrackStatus(ctx, "namespace", "track")
+				assert.NoError(t, err)
+				statusCh <- status
+			}()
+			<-requested
+		}
+		for i := range statusChs {
+			err = s.handleControlMessage(&wire.TrackStatusMessage{
+				TrackNamespace: "namespace",
+				TrackName:      "track",
+				StatusCode:     TrackStatusInProgress,
+				LatestGroupID:  uint64(i),
+				LatestObjectID: 0,
+			})
+			assert.NoError(t, err)
+		}
+		for i, statusCh := range statusChs {
+			select {
+			case <-time.After(time.Second):
+				assert.Fail(t, "test timed out")
+			case status := <-statusCh:
+				assert.Equal(t, uint64(i), status.LatestGroupID)
+			}
+		}
+	})
+	t.Run("handle_go_away", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		mc := NewMockConnection(ctrl)
+		csh := NewMockControlMessageSender(ctrl)
+		s := session(mc, csh, nil)
+		s.isClient = true
+		s.controlStream = csh
+		done := make(chan struct{})
+		s.GoAwayHandler = GoAwayHandlerFunc(func(_ *Session, uri string) {
+			assert.Equal(t, "https://example.com/moq", uri)
+			close(done)
+		})
+		err := s.handleControlMessage(&wire.ServerSetupMessage{
+			SelectedVersion: wire.CurrentVersion,
+			SetupParameters: wire.Parameters{
+				wire.RoleParameterKey: &wire.VarintParameter{
+					Type:  wire.RoleParameterKey,
+					Value: uint64(wire.RolePubSub),
+				},
+			},
+		})
+		assert.NoError(t, err)
+		err = s.handleControlMessage(&wire.GoAwayMessage{
+			NewSessionURI: "https://example.com/moq",
+		})
+		assert.NoError(t, err)
+		select {
+		case <-time.After(time.Second):
+			assert.Fail(t, "test timed out")
+		case <-done:
+		}
+		_, err = s.Subscribe(context.Background(), "namespace", "track", "", nil)
+		assert.ErrorIs(t, err, errGoingAway)
+		err = s.Announce(context.Background(), "namespace")
+		assert.ErrorIs(t, err, errGoingAway)
+	})
+}
+
+type unannouncementHandler struct {
+	AnnouncementHandlerFunc
+	unannounced func(*Session, *Announcement)
+}
+
+func (h *unannouncementHandler) HandleUnannouncement(s *Session, a *Announcement) {
+	h.unannounced(s, a)
 }
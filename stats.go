@@ -0,0 +1,395 @@
+package moqtransport
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+)
+
+// SessionStats is a snapshot of the state of a session.
+type SessionStats struct {
+	SendSubscriptions    int
+	ReceiveSubscriptions int
+	LocalAnnouncements   int
+	RemoteAnnouncements  int
+
+	// ControlMessagesSent and ControlMessagesReceived count the control
+	// messages by message type, e.g. "SUBSCRIBE" or "SUBSCRIBE_OK".
+	ControlMessagesSent     map[string]uint64
+	ControlMessagesReceived map[string]uint64
+
+	// ControlMessageLatency holds the time between sending a request and
+	// receiving its response by the type of the request, e.g. "SUBSCRIBE",
+	// "ANNOUNCE" or "TRACK_STATUS_REQUEST".
+	ControlMessageLatency map[string]LatencyStats
+
+	// Tracks holds the counters of all subscriptions by track, including
+	// subscriptions that ended, ordered by namespace and track name.
+	Tracks []TrackStats
+
+	// OpenSendStreams and OpenReceiveStreams are the numbers of
+	// unidirectional streams carrying objects of active subscriptions.
+	OpenSendStreams    int
+	OpenReceiveStreams int
+}
+
+// TrackStats are the counters of the subscriptions to a track. The counters
+// include subscriptions that ended, so they never decrease. Objects and bytes
+// sent count objects delivered to the peer and their payload. Objects and bytes
+// received count objects received from the peer and their payload. Payloads of
+// objects sent on their own stream are counted as they are read by the
+// application. SendDroppedObjects counts objects dropped from send queues and
+// ReceiveDroppedObjects counts objects dropped from receive buffers.
+type TrackStats struct {
+	Namespace             string
+	TrackName             string
+	ObjectsSent           uint64
+	BytesSent             uint64
+	SendDroppedObjects    uint64
+	ObjectsReceived       uint64
+	BytesReceived         uint64
+	ReceiveDroppedObjects uint64
+}
+
+func (ts *TrackStats) add(o TrackStats) {
+	ts.ObjectsSent += o.ObjectsSent
+	ts.BytesSent += o.BytesSent
+	ts.SendDroppedObjects += o.SendDroppedObjects
+	ts.ObjectsReceived += o.ObjectsReceived
+	ts.BytesReceived += o.BytesReceived
+	ts.ReceiveDroppedObjects += o.ReceiveDroppedObjects
+}
+
+// trackTotals accumulate the counters of ended subscriptions by track.
+type trackTotals struct {
+	lock   sync.Mutex
+	tracks map[trackKey]TrackStats
+}
+
+func newTrackTotals() *trackTotals {
+	return &trackTotals{
+		lock:   sync.Mutex{},
+		tracks: map[trackKey]TrackStats{},
+	}
+}
+
+func (t *trackTotals) add(stats TrackStats) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := trackKey{namespace: stats.Namespace, trackname: stats.TrackName}
+	ts, ok := t.tracks[key]
+	if !ok {
+		ts = TrackStats{Namespace: stats.Namespace, TrackName: stats.TrackName}
+	}
+	ts.add(stats)
+	t.tracks[key] = ts
+}
+
+func (t *trackTotals) snapshot() map[trackKey]TrackStats {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	res := make(map[trackKey]TrackStats, len(t.tracks))
+	for k, v := range t.tracks {
+		res[k] = v
+	}
+	return res
+}
+
+// LatencyStats summarize the latencies of a type of request. Count is the
+// number of responses received and Sum the total time spent waiting for them.
+type LatencyStats struct {
+	Count uint64
+	Sum   time.Duration
+}
+
+// messageCounter counts control messages by type.
+type messageCounter struct {
+	lock   sync.Mutex
+	counts map[string]uint64
+}
+
+func newMessageCounter() *messageCounter {
+	return &messageCounter{
+		lock:   sync.Mutex{},
+		counts: map[string]uint64{},
+	}
+}
+
+func (c *messageCounter) add(m wire.Message) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counts[controlMessageName(m)]++
+}
+
+func (c *messageCounter) snapshot() map[string]uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res := make(map[string]uint64, len(c.counts))
+	for k, v := range c.counts {
+		res[k] = v
+	}
+	return res
+}
+
+// latencyRecorder records the latencies of requests by type.
+type latencyRecorder struct {
+	lock      sync.Mutex
+	latencies map[string]LatencyStats
+}
+
+func newLatencyRecorder() *latencyRecorder {
+	return &latencyRecorder{
+		lock:      sync.Mutex{},
+		latencies: map[string]LatencyStats{},
+	}
+}
+
+// observe records the latency of the response to request, which was sent at
+// start.
+func (r *latencyRecorder) observe(request wire.Message, start time.Time) {
+	d := time.Since(start)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name := controlMessageName(request)
+	l := r.latencies[name]
+	l.Count++
+	l.Sum += d
+	r.latencies[name] = l
+}
+
+func (r *latencyRecorder) snapshot() map[string]LatencyStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	res := make(map[string]LatencyStats, len(r.latencies))
+	for k, v := range r.latencies {
+		res[k] = v
+	}
+	return res
+}
+
+func controlMessageName(m wire.Message) string {
+	switch m.(type) {
+	case *wire.ClientSetupMessage:
+		return "CLIENT_SETUP"
+	case *wire.ServerSetupMessage:
+		return "SERVER_SETUP"
+	case *wire.SubscribeMessage:
+		return "SUBSCRIBE"
+	case *wire.SubscribeUpdateMessage:
+		return "SUBSCRIBE_UPDATE"
+	case *wire.SubscribeOkMessage:
+		return "SUBSCRIBE_OK"
+	case *wire.SubscribeErrorMessage:
+		return "SUBSCRIBE_ERROR"
+	case *wire.SubscribeDoneMessage:
+		return "SUBSCRIBE_DONE"
+	case *wire.UnsubscribeMessage:
+		return "UNSUBSCRIBE"
+	case *wire.AnnounceMessage:
+		return "ANNOUNCE"
+	case *wire.AnnounceOkMessage:
+		return "ANNOUNCE_OK"
+	case *wire.AnnounceErrorMessage:
+		return "ANNOUNCE_ERROR"
+	case *wire.AnnounceCancelMessage:
+		return "ANNOUNCE_CANCEL"
+	case *wire.UnannounceMessage:
+		return "UNANNOUNCE"
+	case *wire.TrackStatusRequestMessage:
+		return "TRACK_STATUS_REQUEST"
+	case *wire.TrackStatusMessage:
+		return "TRACK_STATUS"
+	case *wire.GoAwayMessage:
+		return "GOAWAY"
+	}
+	return "UNKNOWN"
+}
+
+// objectCounters count the objects and payload bytes of a subscription and
+// the streams it has open.
+type objectCounters struct {
+	objects     atomic.Uint64
+	bytes       atomic.Uint64
+	openStreams atomic.Int64
+}
+
+func (c *objectCounters) addObject(payloadLen int) {
+	c.objects.Add(1)
+	c.bytes.Add(uint64(payloadLen))
+}
+
+// countingSendStream counts a stream as open until it is closed or reset.
+// onClose is called once when the stream is closed or reset.
+type countingSendStream struct {
+	SendStream
+	counters *objectCounters
+	onClose  func()
+	once     sync.Once
+}
+
+func newCountingSendStream(s SendStream, counters *objectCounters, onClose func()) *countingSendStream {
+	counters.openStreams.Add(1)
+	return &countingSendStream{
+		SendStream: s,
+		counters:   counters,
+		onClose:    onClose,
+		once:       sync.Once{},
+	}
+}
+
+func (s *countingSendStream) closed() {
+	s.once.Do(func() {
+		s.counters.openStreams.Add(-1)
+		s.onClose()
+	})
+}
+
+func (s *countingSendStream) Close() error {
+	s.closed()
+	return s.SendStream.Close()
+}
+
+// CancelWrite resets the stream if it supports it and closes it otherwise.
+func (s *countingSendStream) CancelWrite(code uint64) {
+	s.closed()
+	if rs, ok := s.SendStream.(ResettableSendStream); ok {
+		rs.CancelWrite(code)
+		return
+	}
+	_ = s.SendStream.Close()
+}
+
+// countingReader counts the bytes read from a payload stream and counts the
+// stream as open until reading it ends or it is discarded. r reads the payload
+// from stream. onClose is called once when reading the stream ends.
+type countingReader struct {
+	reader   io.Reader
+	stream   ReceiveStream
+	counters *objectCounters
+	onClose  func()
+	once     sync.Once
+}
+
+func newCountingReader(r io.Reader, stream ReceiveStream, counters *objectCounters, onClose func()) *countingReader {
+	counters.openStreams.Add(1)
+	return &countingReader{
+		reader:   r,
+		stream:   stream,
+		counters: counters,
+		onClose:  onClose,
+		once:     sync.Once{},
+	}
+}
+
+func (r *countingReader) closed() {
+	r.once.Do(func() {
+		r.counters.openStreams.Add(-1)
+		r.onClose()
+	})
+}
+
+// discard stops reading the payload. The stream is canceled if it supports
+// it, otherwise the rest of the stream is read and discarded in the
+// background.
+func (r *countingReader) discard() {
+	if cs, ok := r.stream.(CancelableReceiveStream); ok {
+		cs.CancelRead(stopCodeObjectDropped)
+		r.closed()
+		return
+	}
+	go func() {
+		_, _ = io.Copy(io.Discard, r)
+	}()
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.counters.bytes.Add(uint64(n))
+	if err != nil {
+		r.closed()
+	}
+	return n, err
+}
+
+// Stats returns a snapshot of the state of the session. Before the session
+// runs, Stats returns the zero value.
+func (s *Session) Stats() SessionStats {
+	if s.si == nil {
+		return SessionStats{}
+	}
+	stats := SessionStats{
+		SendSubscriptions:       0,
+		ReceiveSubscriptions:    0,
+		LocalAnnouncements:      len(s.si.localAnnouncements.values()),
+		RemoteAnnouncements:     len(s.si.remoteAnnouncements.values()),
+		ControlMessagesSent:     s.si.messagesSent.snapshot(),
+		ControlMessagesReceived: s.si.messagesReceived.snapshot(),
+		ControlMessageLatency:   s.si.latencies.snapshot(),
+		Tracks:                  []TrackStats{},
+		OpenSendStreams:         0,
+		OpenReceiveStreams:      0,
+	}
+	tracks := s.si.endedTracks.snapshot()
+	add := func(o TrackStats) {
+		key := trackKey{namespace: o.Namespace, trackname: o.TrackName}
+		ts, ok := tracks[key]
+		if !ok {
+			ts = TrackStats{Namespace: o.Namespace, TrackName: o.TrackName}
+		}
+		ts.add(o)
+		tracks[key] = ts
+	}
+	for _, sub := range s.si.sendSubscriptions.values() {
+		stats.SendSubscriptions++
+		stats.OpenSendStreams += int(sub.counters.openStreams.Load())
+		add(sub.trackStats())
+	}
+	for _, rt := range s.si.receiveSubscriptions.values() {
+		stats.ReceiveSubscriptions++
+		stats.OpenReceiveStreams += int(rt.counters.openStreams.Load())
+		add(rt.trackStats())
+	}
+	for _, ts := range tracks {
+		stats.Tracks = append(stats.Tracks, ts)
+	}
+	sort.Slice(stats.Tracks, func(i, j int) bool {
+		if stats.Tracks[i].Namespace != stats.Tracks[j].Namespace {
+			return stats.Tracks[i].Namespace < stats.Tracks[j].Namespace
+		}
+		return stats.Tracks[i].TrackName < stats.Tracks[j].TrackName
+	})
+	return stats
+}
+
+// trackStats returns the counters of the subscription.
+func (s *sendSubscription) trackStats() TrackStats {
+	return TrackStats{
+		Namespace:             s.namespace,
+		TrackName:             s.trackname,
+		ObjectsSent:           s.counters.objects.Load(),
+		BytesSent:             s.counters.bytes.Load(),
+		SendDroppedObjects:    s.dropped.Load(),
+		ObjectsReceived:       0,
+		BytesReceived:         0,
+		ReceiveDroppedObjects: 0,
+	}
+}
+
+// trackStats returns the counters of the subscription.
+func (t *RemoteTrack) trackStats() TrackStats {
+	received, dropped := t.buffer.stats()
+	return TrackStats{
+		Namespace:             t.namespace,
+		TrackName:             t.trackname,
+		ObjectsSent:           0,
+		BytesSent:             0,
+		SendDroppedObjects:    0,
+		ObjectsReceived:       received,
+		BytesReceived:         t.counters.bytes.Load(),
+		ReceiveDroppedObjects: dropped,
+	}
+}
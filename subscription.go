@@ -10,16 +10,60 @@ const (
 	SubscribeStatusExpired           = 0x06
 )
 
+// Group orders as carried in SUBSCRIBE and SUBSCRIBE_OK messages.
+// GroupOrderPublisher lets the publisher choose the order.
+const (
+	GroupOrderPublisher  = 0x00
+	GroupOrderAscending  = 0x01
+	GroupOrderDescending = 0x02
+)
+
 type Subscription struct {
-	ID            uint64
-	TrackAlias    uint64
-	Namespace     string
-	TrackName     string
-	Authorization string
+	ID                 uint64
+	TrackAlias         uint64
+	Namespace          string
+	TrackName          string
+	Authorization      string
+	SubscriberPriority uint8
+	GroupOrder         uint8
+	FilterType         FilterType
+	StartGroup         uint64
+	StartObject        uint64
+	EndGroup           uint64
+	EndObject          uint64
+}
+
+func (s *Subscription) window() deliveryWindow {
+	return windowFromFilter(s.FilterType, s.StartGroup, s.StartObject, s.EndGroup, s.EndObject)
+}
+
+// SubscribeOptions configure the range of objects requested by a
+// subscription. The zero value requests objects starting at the latest group.
+// EndGroup and EndObject are only used with FilterTypeAbsoluteRange. EndGroup
+// is the last requested group, EndObject is one larger than the last requested
+// object in EndGroup and 0 requests the entire EndGroup. Lower subscriber
+// priorities are delivered first. GroupOrder requests groups to be delivered
+// in ascending or descending order.
+//
+// BufferSize is the number of received objects the RemoteTrack buffers until
+// they are read. If it is 0, DefaultReceiveBufferSize is used. OverflowPolicy
+// decides what happens to new objects if the buffer is full.
+type SubscribeOptions struct {
+	SubscriberPriority uint8
+	GroupOrder         uint8
+	FilterType         FilterType
+	StartGroup         uint64
+	StartObject        uint64
+	EndGroup           uint64
+	EndObject          uint64
+	BufferSize         int
+	OverflowPolicy     OverflowPolicy
 }
 
 type SubscriptionResponseWriter interface {
-	Accept(*LocalTrack)
+	// Accept subscribes the peer to t. The options configure the queue of
+	// objects waiting to be sent to the peer.
+	Accept(t *LocalTrack, opts ...AcceptOption)
 	Reject(code uint64, reason string)
 }
 
@@ -38,8 +82,12 @@ type defaultSubscriptionResponseWriter struct {
 	session      *Session
 }
 
-func (w *defaultSubscriptionResponseWriter) Accept(t *LocalTrack) {
-	w.session.subscribeToLocalTrack(w.subscription, t)
+func (w *defaultSubscriptionResponseWriter) Accept(t *LocalTrack, opts ...AcceptOption) {
+	config := defaultSendQueueConfig()
+	for _, opt := range opts {
+		opt(&config)
+	}
+	w.session.subscribeToLocalTrack(w.subscription, t, config)
 }
 
 func (w *defaultSubscriptionResponseWriter) Reject(code uint64, reason string) {
@@ -39,3 +39,29 @@ func (m *syncMap[K, V]) delete(k K) {
 	defer m.mutex.Unlock()
 	delete(m.elements, k)
 }
+
+func (m *syncMap[K, V]) getAndDelete(k K) (V, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	v, ok := m.elements[k]
+	delete(m.elements, k)
+	return v, ok
+}
+
+func (m *syncMap[K, V]) values() []V {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	values := make([]V, 0, len(m.elements))
+	for _, v := range m.elements {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (m *syncMap[K, V]) deleteAll() map[K]V {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	elements := m.elements
+	m.elements = make(map[K]V)
+	return elements
+}
@@ -0,0 +1,435 @@
+// Package tcpmoq implements moqtransport.Connection on top of a single TCP (or
+// TLS over TCP) connection for networks that block UDP. A lightweight
+// multiplexer carries bidirectional and unidirectional streams as well as
+// emulated datagrams, which are dropped instead of queued when the connection
+// is congested. Streams are flow controlled, so that a writer waits for a slow
+// reader instead of overflowing its buffer. Both endpoints must use tcpmoq.
+package tcpmoq
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+const (
+	streamTypeBidi = 0x00
+	streamTypeUni  = 0x02
+
+	serverInitiated = 0x01
+)
+
+const (
+	// acceptQueueSize is the number of streams opened by the peer that are
+	// queued until they are accepted. Reading from the connection blocks
+	// while the queue is full.
+	acceptQueueSize = 1024
+
+	// datagramQueueSize is the number of datagrams queued for sending or
+	// receiving. Datagrams are dropped while the queue is full.
+	datagramQueueSize = 64
+
+	// maxStreamReceiveBuffer is the flow control window of a stream: the
+	// peer may send at most this many bytes which the application did not
+	// read yet. The receiver extends the window with MAX_STREAM_DATA frames
+	// as the application reads.
+	maxStreamReceiveBuffer = 4 << 20
+
+	// maxReceiveBuffer is the number of bytes buffered for all streams of a
+	// connection. The connection is closed if the peer exceeds the limit.
+	maxReceiveBuffer = 16 << 20
+)
+
+var (
+	errReceiveBufferExceeded = errors.New("receive buffer limit exceeded")
+
+	errFlowControlViolation = errors.New("stream flow control limit exceeded")
+)
+
+// ApplicationError is the error of a connection after it was closed using
+// CloseWithError. Remote is true if the peer closed the connection.
+type ApplicationError struct {
+	Remote  bool
+	Code    uint64
+	Message string
+}
+
+func (e *ApplicationError) Error() string {
+	if e.Remote {
+		return fmt.Sprintf("connection closed by peer with code %v: %v", e.Code, e.Message)
+	}
+	return fmt.Sprintf("connection closed with code %v: %v", e.Code, e.Message)
+}
+
+type conn struct {
+	logger   *slog.Logger
+	netConn  net.Conn
+	isClient bool
+
+	writeLock sync.Mutex
+
+	lock           sync.Mutex
+	streams        map[uint64]*receiveStream
+	sendStreams    map[uint64]*sendStream
+	buffered       int
+	nextBidi       uint64
+	nextUni        uint64
+	nextPeerStream map[uint64]uint64
+
+	acceptCh     chan *stream
+	acceptUniCh  chan *receiveStream
+	datagramsOut chan []byte
+	datagramsIn  chan []byte
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	err       error
+}
+
+var _ moqtransport.Connection = (*conn)(nil)
+
+// New returns a moqtransport.Connection multiplexing streams and datagrams on
+// netConn. isClient must be true on the endpoint which dialed netConn and false
+// on the other one.
+func New(netConn net.Conn, isClient bool) moqtransport.Connection {
+	c := &conn{
+		logger:      moqtransport.Logger().WithGroup("MOQ_TCP_CONNECTION"),
+		netConn:     netConn,
+		isClient:    isClient,
+		writeLock:   sync.Mutex{},
+		lock:        sync.Mutex{},
+		streams:     map[uint64]*receiveStream{},
+		sendStreams: map[uint64]*sendStream{},
+		buffered:    0,
+		nextBidi:    streamTypeBidi,
+		nextUni:     streamTypeUni,
+		nextPeerStream: map[uint64]uint64{
+			streamTypeBidi: streamTypeBidi,
+			streamTypeUni:  streamTypeUni,
+		},
+		acceptCh:     make(chan *stream, acceptQueueSize),
+		acceptUniCh:  make(chan *receiveStream, acceptQueueSize),
+		datagramsOut: make(chan []byte, datagramQueueSize),
+		datagramsIn:  make(chan []byte, datagramQueueSize),
+		closeOnce:    sync.Once{},
+		closed:       make(chan struct{}),
+		err:          nil,
+	}
+	if !isClient {
+		c.nextBidi |= serverInitiated
+		c.nextUni |= serverInitiated
+	} else {
+		c.nextPeerStream[streamTypeBidi] |= serverInitiated
+		c.nextPeerStream[streamTypeUni] |= serverInitiated
+	}
+	go c.readLoop()
+	go c.sendDatagrams()
+	return c
+}
+
+func (c *conn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *conn) writeFrame(f *frame) error {
+	if c.isClosed() {
+		return c.err
+	}
+	buf := f.append(make([]byte, 0, 16+len(f.data)))
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if _, err := c.netConn.Write(buf); err != nil {
+		c.close(err)
+		return err
+	}
+	return nil
+}
+
+func (c *conn) OpenStream() (moqtransport.Stream, error) {
+	if c.isClosed() {
+		return nil, c.err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := c.nextBidi
+	c.nextBidi += 4
+	rs := newReceiveStream(c, id)
+	c.streams[id] = rs
+	return &stream{
+		receiveStream: rs,
+		send:          c.newSendStream(id),
+	}, nil
+}
+
+func (c *conn) OpenStreamSync(context.Context) (moqtransport.Stream, error) {
+	return c.OpenStream()
+}
+
+func (c *conn) OpenUniStream() (moqtransport.SendStream, error) {
+	if c.isClosed() {
+		return nil, c.err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := c.nextUni
+	c.nextUni += 4
+	return c.newSendStream(id), nil
+}
+
+func (c *conn) OpenUniStreamSync(context.Context) (moqtransport.SendStream, error) {
+	return c.OpenUniStream()
+}
+
+func (c *conn) AcceptStream(ctx context.Context) (moqtransport.Stream, error) {
+	select {
+	case s := <-c.acceptCh:
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+func (c *conn) AcceptUniStream(ctx context.Context) (moqtransport.ReceiveStream, error) {
+	select {
+	case s := <-c.acceptUniCh:
+		return s, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+// SendDatagram queues b for sending. Like QUIC datagrams, datagrams are
+// unreliable: they are dropped if the send queue is full.
+func (c *conn) SendDatagram(b []byte) error {
+	if c.isClosed() {
+		return c.err
+	}
+	select {
+	case c.datagramsOut <- append([]byte{}, b...):
+	default:
+		c.logger.Debug("dropping datagram, send queue full")
+	}
+	return nil
+}
+
+func (c *conn) sendDatagrams() {
+	for {
+		select {
+		case d := <-c.datagramsOut:
+			if err := c.writeFrame(&frame{
+				typ:      frameTypeDatagram,
+				streamID: 0,
+				code:     0,
+				limit:    0,
+				data:     d,
+			}); err != nil {
+				return
+			}
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *conn) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case d := <-c.datagramsIn:
+		return d, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, c.err
+	}
+}
+
+// CloseWithError tells the peer that the connection is closed and closes the
+// underlying connection.
+func (c *conn) CloseWithError(code uint64, msg string) error {
+	if c.isClosed() {
+		return nil
+	}
+	_ = c.writeFrame(&frame{
+		typ:      frameTypeClose,
+		streamID: 0,
+		code:     code,
+		limit:    0,
+		data:     []byte(msg),
+	})
+	c.close(&ApplicationError{
+		Remote:  false,
+		Code:    code,
+		Message: msg,
+	})
+	return nil
+}
+
+func (c *conn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.closed)
+		if cerr := c.netConn.Close(); cerr != nil {
+			c.logger.Debug("failed to close connection", "error", cerr)
+		}
+	})
+}
+
+// forgetStream removes a stream which does not expect any more frames,
+// because it was finished, reset or canceled.
+func (c *conn) forgetStream(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.streams, id)
+}
+
+// newSendStream creates the sending part of the stream with id, which
+// receives the flow control frames of the peer. c.lock must be held.
+func (c *conn) newSendStream(id uint64) *sendStream {
+	ss := newSendStream(c, id)
+	c.sendStreams[id] = ss
+	return ss
+}
+
+// sendStream returns the sending part of the stream with id or nil if the
+// stream was closed, reset or stopped.
+func (c *conn) sendStream(id uint64) *sendStream {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.sendStreams[id]
+}
+
+// forgetSendStream removes the sending part of a stream which does not need
+// flow control frames anymore.
+func (c *conn) forgetSendStream(id uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.sendStreams, id)
+}
+
+// reserve adds n bytes to the data buffered by the streams of the connection.
+// It returns false if the connection would exceed maxReceiveBuffer.
+func (c *conn) reserve(n int) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.buffered+n > maxReceiveBuffer {
+		return false
+	}
+	c.buffered += n
+	return true
+}
+
+// release removes n bytes, which were read or discarded, from the data
+// buffered by the streams of the connection.
+func (c *conn) release(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.buffered -= n
+}
+
+func (c *conn) isPeerInitiated(id uint64) bool {
+	return (id&serverInitiated == serverInitiated) == c.isClient
+}
+
+// receiveStream returns the stream with id. If the peer opened a new stream,
+// it creates the stream and queues it for accepting. It returns nil for
+// frames of streams that were already finished, reset or canceled.
+func (c *conn) receiveStream(id uint64) *receiveStream {
+	c.lock.Lock()
+	if rs, ok := c.streams[id]; ok {
+		c.lock.Unlock()
+		return rs
+	}
+	typ := id & streamTypeUni
+	if !c.isPeerInitiated(id) || id < c.nextPeerStream[typ] {
+		c.lock.Unlock()
+		return nil
+	}
+	c.nextPeerStream[typ] = id + 4
+	rs := newReceiveStream(c, id)
+	c.streams[id] = rs
+	if typ == streamTypeUni {
+		c.lock.Unlock()
+		select {
+		case c.acceptUniCh <- rs:
+		case <-c.closed:
+		}
+		return rs
+	}
+	ss := c.newSendStream(id)
+	c.lock.Unlock()
+	select {
+	case c.acceptCh <- &stream{receiveStream: rs, send: ss}:
+	case <-c.closed:
+	}
+	return rs
+}
+
+func (c *conn) readLoop() {
+	r := bufio.NewReader(c.netConn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			if !c.isClosed() {
+				c.logger.Info("connection failed", "error", err)
+			}
+			c.close(err)
+			return
+		}
+		switch f.typ {
+		case frameTypeStream:
+			if rs := c.receiveStream(f.streamID); rs != nil {
+				if err := rs.push(f.data); err != nil {
+					c.logger.Warn("closing connection", "error", err)
+					_ = c.CloseWithError(moqtransport.ErrorCodeProtocolViolation, err.Error())
+					return
+				}
+			}
+		case frameTypeFin:
+			if rs := c.receiveStream(f.streamID); rs != nil {
+				rs.finish()
+			}
+		case frameTypeReset:
+			if rs := c.receiveStream(f.streamID); rs != nil {
+				rs.reset(f.code)
+			}
+		case frameTypeMaxStreamData:
+			if ss := c.sendStream(f.streamID); ss != nil {
+				ss.increaseLimit(f.limit)
+			}
+		case frameTypeStopSending:
+			if ss := c.sendStream(f.streamID); ss != nil {
+				ss.stop(f.code)
+			}
+		case frameTypeDatagram:
+			select {
+			case c.datagramsIn <- f.data:
+			default:
+				c.logger.Debug("dropping datagram, receive queue full")
+			}
+		case frameTypeClose:
+			c.close(&ApplicationError{
+				Remote:  true,
+				Code:    f.code,
+				Message: string(f.data),
+			})
+			return
+		default:
+			c.close(errors.New("unexpected frame"))
+			return
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package tcpmoq
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pipe() (*conn, *conn) {
+	a, b := net.Pipe()
+	return New(a, true).(*conn), New(b, false).(*conn)
+}
+
+func buffered(c *conn) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.buffered
+}
+
+func streams(c *conn) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.streams)
+}
+
+func TestConn(t *testing.T) {
+	t.Run("bidirectional_stream", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		cs, err := client.OpenStream()
+		assert.NoError(t, err)
+		_, err = cs.Write([]byte("ping"))
+		assert.NoError(t, err)
+		assert.NoError(t, cs.Close())
+
+		ss, err := server.AcceptStream(ctx)
+		assert.NoError(t, err)
+		buf, err := io.ReadAll(ss)
+		assert.NoError(t, err)
+		assert.Equal(t, "ping", string(buf))
+
+		_, err = ss.Write([]byte("pong"))
+		assert.NoError(t, err)
+		assert.NoError(t, ss.Close())
+		buf, err = io.ReadAll(cs)
+		assert.NoError(t, err)
+		assert.Equal(t, "pong", string(buf))
+	})
+	t.Run("unidirectional_streams", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		large := make([]byte, 3*maxStreamFrameSize+1)
+		for i := range large {
+			large[i] = byte(i)
+		}
+		for _, payload := range [][]byte{[]byte("first"), large} {
+			s, err := server.OpenUniStream()
+			assert.NoError(t, err)
+			_, err = s.Write(payload)
+			assert.NoError(t, err)
+			assert.NoError(t, s.Close())
+		}
+		for _, expected := range [][]byte{[]byte("first"), large} {
+			r, err := client.AcceptUniStream(ctx)
+			assert.NoError(t, err)
+			buf, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, buf)
+		}
+	})
+	t.Run("reset_stream", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		s, err := client.OpenUniStream()
+		assert.NoError(t, err)
+		s.(*sendStream).CancelWrite(5)
+		r, err := server.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		_, err = r.Read(make([]byte, 8))
+		assert.Equal(t, &StreamError{StreamID: 2, Code: 5}, err)
+	})
+	t.Run("stream_flow_control", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		payload := make([]byte, 3*maxStreamReceiveBuffer)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+		s, err := server.OpenUniStream()
+		assert.NoError(t, err)
+		written := make(chan error, 1)
+		go func() {
+			_, err := s.Write(payload)
+			written <- err
+		}()
+		r, err := client.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+
+		// The writer blocks when the window of the stream is used up.
+		assert.Eventually(t, func() bool {
+			return buffered(client) == maxStreamReceiveBuffer
+		}, time.Second, 10*time.Millisecond)
+		select {
+		case <-written:
+			assert.Fail(t, "write exceeded the flow control limit")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		// Reading extends the window until all data arrived.
+		buf := make([]byte, len(payload))
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, buf)
+		select {
+		case err := <-written:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			assert.Fail(t, "write blocked")
+		}
+		assert.Equal(t, 0, buffered(client))
+	})
+	t.Run("flow_control_violation", func(t *testing.T) {
+		client, server := pipe()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		// Bypass the flow control of the send stream.
+		for i := 0; i <= maxStreamReceiveBuffer/maxFrameSize; i++ {
+			if err := server.writeFrame(&frame{
+				typ:      frameTypeStream,
+				streamID: 3,
+				code:     0,
+				limit:    0,
+				data:     make([]byte, maxFrameSize),
+			}); err != nil {
+				break
+			}
+		}
+		_, err := client.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: false, Code: 3, Message: errFlowControlViolation.Error()}, err)
+		_, err = server.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: true, Code: 3, Message: errFlowControlViolation.Error()}, err)
+	})
+	t.Run("connection_buffer_limit", func(t *testing.T) {
+		client, server := pipe()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		for i := 0; i <= maxReceiveBuffer/maxStreamReceiveBuffer; i++ {
+			s, err := server.OpenUniStream()
+			assert.NoError(t, err)
+			if _, err = s.Write(make([]byte, maxStreamReceiveBuffer)); err != nil {
+				break
+			}
+		}
+		_, err := client.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: false, Code: 3, Message: errReceiveBufferExceeded.Error()}, err)
+		_, err = server.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: true, Code: 3, Message: errReceiveBufferExceeded.Error()}, err)
+	})
+	t.Run("cancel_read", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		s, err := server.OpenUniStream()
+		assert.NoError(t, err)
+		_, err = s.Write([]byte("unread"))
+		assert.NoError(t, err)
+		r, err := client.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return buffered(client) == 6
+		}, time.Second, 10*time.Millisecond)
+		r.(*receiveStream).CancelRead(7)
+		assert.Equal(t, 0, buffered(client))
+		assert.Equal(t, 0, streams(client))
+		_, err = r.Read(make([]byte, 8))
+		assert.ErrorIs(t, err, errReadCanceled)
+
+		// The peer stops sending.
+		assert.Eventually(t, func() bool {
+			_, err := s.Write([]byte("late"))
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+		_, err = s.Write([]byte("late"))
+		assert.Equal(t, &StreamError{StreamID: 3, Code: 7}, err)
+	})
+	t.Run("cancel_read_unblocks_writer", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		s, err := server.OpenUniStream()
+		assert.NoError(t, err)
+		written := make(chan error, 1)
+		go func() {
+			_, err := s.Write(make([]byte, 2*maxStreamReceiveBuffer))
+			written <- err
+		}()
+		r, err := client.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return buffered(client) == maxStreamReceiveBuffer
+		}, time.Second, 10*time.Millisecond)
+		r.(*receiveStream).CancelRead(7)
+		select {
+		case err := <-written:
+			assert.Equal(t, &StreamError{StreamID: 3, Code: 7}, err)
+		case <-time.After(time.Second):
+			assert.Fail(t, "write blocked")
+		}
+	})
+
+	t.Run("cancel_write_unblocks_writer", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		s, err := server.OpenUniStream()
+		assert.NoError(t, err)
+		written := make(chan error, 1)
+		go func() {
+			_, err := s.Write(make([]byte, 2*maxStreamReceiveBuffer))
+			written <- err
+		}()
+		_, err = client.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return buffered(client) == maxStreamReceiveBuffer
+		}, time.Second, 10*time.Millisecond)
+		s.(*sendStream).CancelWrite(5)
+		select {
+		case err := <-written:
+			assert.ErrorIs(t, err, errWriteAfterClose)
+		case <-time.After(time.Second):
+			assert.Fail(t, "write blocked")
+		}
+	})
+	t.Run("forget_finished_stream", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		s, err := server.OpenUniStream()
+		assert.NoError(t, err)
+		_, err = s.Write([]byte("data"))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Close())
+		r, err := client.AcceptUniStream(ctx)
+		assert.NoError(t, err)
+		assert.Eventually(t, func() bool {
+			return streams(client) == 0
+		}, time.Second, 10*time.Millisecond)
+
+		// The stream can still be read after the connection forgot it.
+		buf, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "data", string(buf))
+		assert.Equal(t, 0, buffered(client))
+	})
+	t.Run("datagrams", func(t *testing.T) {
+		client, server := pipe()
+		defer client.CloseWithError(0, "")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.NoError(t, client.SendDatagram([]byte("datagram")))
+		d, err := server.ReceiveDatagram(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "datagram", string(d))
+	})
+	t.Run("close", func(t *testing.T) {
+		client, server := pipe()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		assert.NoError(t, server.CloseWithError(4, "bye"))
+		_, err := client.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: true, Code: 4, Message: "bye"}, err)
+		_, err = server.AcceptStream(ctx)
+		assert.Equal(t, &ApplicationError{Remote: false, Code: 4, Message: "bye"}, err)
+		assert.Error(t, client.SendDatagram([]byte("late")))
+	})
+}
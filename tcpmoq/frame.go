@@ -0,0 +1,133 @@
+package tcpmoq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Frames are encoded as a varint frame type followed by the fields of the
+// frame. Stream IDs follow QUIC: the lowest bit is set for streams initiated
+// by the server and the second bit for unidirectional streams.
+const (
+	frameTypeStream   = 0x00 // stream ID, length, data
+	frameTypeFin      = 0x01 // stream ID
+	frameTypeReset    = 0x02 // stream ID, error code
+	frameTypeDatagram = 0x03 // length, data
+	frameTypeClose    = 0x04 // error code, length, reason
+
+	frameTypeMaxStreamData = 0x05 // stream ID, limit
+	frameTypeStopSending   = 0x06 // stream ID, error code
+)
+
+// maxStreamFrameSize is the largest payload of a stream frame. Larger writes
+// are split, so that streams and datagrams are interleaved.
+const maxStreamFrameSize = 16 * 1024
+
+// maxFrameSize limits the length of frames accepted from the peer.
+const maxFrameSize = 1 << 20
+
+type frame struct {
+	typ      uint64
+	streamID uint64
+	code     uint64
+	limit    uint64
+	data     []byte
+}
+
+func (f *frame) append(buf []byte) []byte {
+	buf = quicvarint.Append(buf, f.typ)
+	switch f.typ {
+	case frameTypeStream:
+		buf = quicvarint.Append(buf, f.streamID)
+		buf = quicvarint.Append(buf, uint64(len(f.data)))
+		buf = append(buf, f.data...)
+	case frameTypeFin:
+		buf = quicvarint.Append(buf, f.streamID)
+	case frameTypeReset:
+		buf = quicvarint.Append(buf, f.streamID)
+		buf = quicvarint.Append(buf, f.code)
+	case frameTypeDatagram:
+		buf = quicvarint.Append(buf, uint64(len(f.data)))
+		buf = append(buf, f.data...)
+	case frameTypeClose:
+		buf = quicvarint.Append(buf, f.code)
+		buf = quicvarint.Append(buf, uint64(len(f.data)))
+		buf = append(buf, f.data...)
+	case frameTypeMaxStreamData:
+		buf = quicvarint.Append(buf, f.streamID)
+		buf = quicvarint.Append(buf, f.limit)
+	case frameTypeStopSending:
+		buf = quicvarint.Append(buf, f.streamID)
+		buf = quicvarint.Append(buf, f.code)
+	}
+	return buf
+}
+
+func readData(r *bufio.Reader) ([]byte, error) {
+	length, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxFrameSize {
+		return nil, fmt.Errorf("frame too large: %v bytes", length)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func readFrame(r *bufio.Reader) (*frame, error) {
+	typ, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	f := &frame{
+		typ:      typ,
+		streamID: 0,
+		code:     0,
+		limit:    0,
+		data:     nil,
+	}
+	switch typ {
+	case frameTypeStream:
+		if f.streamID, err = quicvarint.Read(r); err != nil {
+			return nil, err
+		}
+		f.data, err = readData(r)
+	case frameTypeFin:
+		f.streamID, err = quicvarint.Read(r)
+	case frameTypeReset:
+		if f.streamID, err = quicvarint.Read(r); err != nil {
+			return nil, err
+		}
+		f.code, err = quicvarint.Read(r)
+	case frameTypeDatagram:
+		f.data, err = readData(r)
+	case frameTypeClose:
+		if f.code, err = quicvarint.Read(r); err != nil {
+			return nil, err
+		}
+		f.data, err = readData(r)
+	case frameTypeMaxStreamData:
+		if f.streamID, err = quicvarint.Read(r); err != nil {
+			return nil, err
+		}
+		f.limit, err = quicvarint.Read(r)
+	case frameTypeStopSending:
+		if f.streamID, err = quicvarint.Read(r); err != nil {
+			return nil, err
+		}
+		f.code, err = quicvarint.Read(r)
+	default:
+		return nil, fmt.Errorf("unknown frame type: %v", typ)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
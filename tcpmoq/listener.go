@@ -0,0 +1,137 @@
+package tcpmoq
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+// ALPN is the application protocol negotiated by Dial and Listen if the TLS
+// configuration does not set NextProtos.
+const ALPN = "moq-00-tcp"
+
+func withALPN(tlsConfig *tls.Config) *tls.Config {
+	conf := tlsConfig.Clone()
+	if len(conf.NextProtos) == 0 {
+		conf.NextProtos = []string{ALPN}
+	}
+	return conf
+}
+
+// Dial connects to addr using TLS over TCP and returns a client connection.
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (moqtransport.Connection, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{},
+		Config:    withALPN(tlsConfig),
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn, true), nil
+}
+
+// handshakeTimeout limits the duration of the TLS handshake of accepted
+// connections.
+const handshakeTimeout = 10 * time.Second
+
+// A Listener accepts TLS over TCP connections. TLS handshakes run in the
+// background, so that slow or stalled clients don't block other connections.
+type Listener struct {
+	logger   *slog.Logger
+	listener net.Listener
+	connCh   chan *tls.Conn
+
+	// done is closed when the listener stopped accepting connections, err
+	// is the reason.
+	done chan struct{}
+	err  error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// Listen listens for TLS over TCP connections on addr.
+func Listen(addr string, tlsConfig *tls.Config) (*Listener, error) {
+	l, err := tls.Listen("tcp", addr, withALPN(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	listener := &Listener{
+		logger:    moqtransport.Logger().WithGroup("MOQ_TCP_LISTENER"),
+		listener:  l,
+		connCh:    make(chan *tls.Conn),
+		done:      make(chan struct{}),
+		err:       nil,
+		closeOnce: sync.Once{},
+		closed:    make(chan struct{}),
+	}
+	go listener.acceptLoop()
+	return listener, nil
+}
+
+func (l *Listener) acceptLoop() {
+	defer close(l.done)
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+		go l.handshake(conn.(*tls.Conn))
+	}
+}
+
+// handshake completes the TLS handshake of conn and queues it for Accept.
+func (l *Listener) handshake(conn *tls.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		l.logger.Info("TLS handshake failed", "remote-addr", conn.RemoteAddr(), "error", err)
+		conn.Close()
+		return
+	}
+	select {
+	case l.connCh <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+// Accept waits for the next connection which completed its TLS handshake.
+func (l *Listener) Accept(ctx context.Context) (moqtransport.Connection, error) {
+	select {
+	case conn := <-l.connCh:
+		return New(conn, false), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Addr returns the address the listener listens on.
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close stops listening. Connections accepted before are not closed, but
+// connections which did not complete their handshake yet are.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return l.listener.Close()
+}
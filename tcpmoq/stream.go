@@ -0,0 +1,375 @@
+package tcpmoq
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+)
+
+var (
+	errWriteAfterClose = errors.New("write on closed stream")
+
+	errReadCanceled = errors.New("read on canceled stream")
+)
+
+// StreamError is returned by reads of a stream that was reset by the peer and
+// by writes to a stream the peer stopped reading.
+type StreamError struct {
+	StreamID uint64
+	Code     uint64
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("stream %v reset with code %v", e.StreamID, e.Code)
+}
+
+// receiveStream buffers the data received on a stream until it is read. The
+// peer may send up to limit bytes, which is extended by maxStreamReceiveBuffer
+// bytes beyond the data read whenever half of the window was read. The
+// connection is closed if the peer exceeds the limit or if all streams buffer
+// more than maxReceiveBuffer bytes.
+type receiveStream struct {
+	conn *conn
+	id   uint64
+
+	lock     sync.Mutex
+	chunks   [][]byte
+	buffered int
+	read     uint64
+	limit    uint64
+	fin      bool
+	err      error
+
+	// readable is signaled when data or the end of the stream arrived.
+	readable chan struct{}
+}
+
+var _ moqtransport.CancelableReceiveStream = (*receiveStream)(nil)
+
+func newReceiveStream(c *conn, id uint64) *receiveStream {
+	return &receiveStream{
+		conn:     c,
+		id:       id,
+		lock:     sync.Mutex{},
+		chunks:   [][]byte{},
+		buffered: 0,
+		read:     0,
+		limit:    maxStreamReceiveBuffer,
+		fin:      false,
+		err:      nil,
+		readable: make(chan struct{}, 1),
+	}
+}
+
+func (s *receiveStream) signal() {
+	select {
+	case s.readable <- struct{}{}:
+	default:
+	}
+}
+
+// push buffers data received on the stream. It returns an error if the peer
+// exceeded the flow control limit of the stream or the connection exceeded
+// its buffer limit.
+func (s *receiveStream) push(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.fin || s.err != nil {
+		return nil
+	}
+	if s.read+uint64(s.buffered+len(data)) > s.limit {
+		return errFlowControlViolation
+	}
+	if !s.conn.reserve(len(data)) {
+		return errReceiveBufferExceeded
+	}
+	s.buffered += len(data)
+	s.chunks = append(s.chunks, data)
+	s.signal()
+	return nil
+}
+
+// finish marks the end of the stream. No more frames are expected, so the
+// connection forgets the stream.
+func (s *receiveStream) finish() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.fin = true
+	s.conn.forgetStream(s.id)
+	s.signal()
+}
+
+func (s *receiveStream) reset(code uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cancel(&StreamError{StreamID: s.id, Code: code})
+}
+
+// CancelRead discards the buffered data and the data the peer still sends on
+// the stream and asks the peer to stop sending with a STOP_SENDING frame
+// carrying code. Reads return an error afterwards.
+func (s *receiveStream) CancelRead(code uint64) {
+	s.lock.Lock()
+	stop := !s.fin && s.err == nil
+	s.cancel(errReadCanceled)
+	s.lock.Unlock()
+	if stop {
+		_ = s.conn.writeFrame(&frame{
+			typ:      frameTypeStopSending,
+			streamID: s.id,
+			code:     code,
+			limit:    0,
+			data:     nil,
+		})
+	}
+}
+
+// cancel fails reads with err, releases the buffered data and makes the
+// connection forget the stream. s.lock must be held.
+func (s *receiveStream) cancel(err error) {
+	if s.err == nil {
+		s.err = err
+	}
+	s.conn.release(s.buffered)
+	s.chunks = nil
+	s.buffered = 0
+	s.conn.forgetStream(s.id)
+	s.signal()
+}
+
+// extendLimit extends the flow control limit after half of the window was
+// read. It returns the new limit or zero if the limit was not extended. s.lock
+// must be held.
+func (s *receiveStream) extendLimit() uint64 {
+	if s.fin || s.limit-s.read > maxStreamReceiveBuffer/2 {
+		return 0
+	}
+	s.limit = s.read + maxStreamReceiveBuffer
+	return s.limit
+}
+
+func (s *receiveStream) Read(b []byte) (int, error) {
+	for {
+		s.lock.Lock()
+		if s.err != nil {
+			err := s.err
+			s.lock.Unlock()
+			return 0, err
+		}
+		if len(s.chunks) > 0 {
+			n := copy(b, s.chunks[0])
+			s.chunks[0] = s.chunks[0][n:]
+			if len(s.chunks[0]) == 0 {
+				s.chunks[0] = nil
+				s.chunks = s.chunks[1:]
+			}
+			s.buffered -= n
+			s.read += uint64(n)
+			s.conn.release(n)
+			limit := s.extendLimit()
+			s.lock.Unlock()
+			if limit > 0 {
+				// Written without holding the lock, so that a blocked
+				// write does not block the read loop of the connection.
+				_ = s.conn.writeFrame(&frame{
+					typ:      frameTypeMaxStreamData,
+					streamID: s.id,
+					code:     0,
+					limit:    limit,
+					data:     nil,
+				})
+			}
+			return n, nil
+		}
+		if s.fin {
+			s.lock.Unlock()
+			return 0, io.EOF
+		}
+		s.lock.Unlock()
+		select {
+		case <-s.readable:
+		case <-s.conn.closed:
+			return 0, s.conn.err
+		}
+	}
+}
+
+// sendStream writes the data of a stream as frames to the connection. Writes
+// block while the data sent reaches the flow control limit of the peer.
+type sendStream struct {
+	conn *conn
+	id   uint64
+
+	lock   sync.Mutex
+	closed bool
+
+	// flowLock protects the flow control state, which is updated by the read
+	// loop of the connection. unblocked is signaled when the limit was
+	// extended or the peer stopped the stream.
+	flowLock  sync.Mutex
+	sent      uint64
+	limit     uint64
+	stopErr   error
+	unblocked chan struct{}
+}
+
+var _ moqtransport.ResettableSendStream = (*sendStream)(nil)
+
+func newSendStream(c *conn, id uint64) *sendStream {
+	return &sendStream{
+		conn:      c,
+		id:        id,
+		lock:      sync.Mutex{},
+		closed:    false,
+		flowLock:  sync.Mutex{},
+		sent:      0,
+		limit:     maxStreamReceiveBuffer,
+		stopErr:   nil,
+		unblocked: make(chan struct{}, 1),
+	}
+}
+
+// increaseLimit raises the flow control limit to limit. Limits lower than the
+// current one are ignored.
+func (s *sendStream) increaseLimit(limit uint64) {
+	s.flowLock.Lock()
+	if limit > s.limit {
+		s.limit = limit
+	}
+	s.flowLock.Unlock()
+	s.signal()
+}
+
+// stop fails current and future writes, because the peer stopped reading the
+// stream.
+func (s *sendStream) stop(code uint64) {
+	s.flowLock.Lock()
+	if s.stopErr == nil {
+		s.stopErr = &StreamError{StreamID: s.id, Code: code}
+	}
+	s.flowLock.Unlock()
+	s.conn.forgetSendStream(s.id)
+	s.signal()
+}
+
+func (s *sendStream) signal() {
+	select {
+	case s.unblocked <- struct{}{}:
+	default:
+	}
+}
+
+// credit waits until the flow control limit allows sending and returns the
+// number of bytes that may be sent.
+func (s *sendStream) credit() (int, error) {
+	for {
+		s.flowLock.Lock()
+		if s.stopErr != nil {
+			err := s.stopErr
+			s.flowLock.Unlock()
+			return 0, err
+		}
+		if s.sent < s.limit {
+			n := s.limit - s.sent
+			s.flowLock.Unlock()
+			return int(min(n, maxStreamFrameSize)), nil
+		}
+		s.flowLock.Unlock()
+		select {
+		case <-s.unblocked:
+		case <-s.conn.closed:
+			return 0, s.conn.err
+		}
+	}
+}
+
+func (s *sendStream) Write(b []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return 0, errWriteAfterClose
+	}
+	n := 0
+	for n < len(b) {
+		credit, err := s.credit()
+		if err != nil {
+			return n, err
+		}
+		end := min(n+credit, len(b))
+		if err := s.conn.writeFrame(&frame{
+			typ:      frameTypeStream,
+			streamID: s.id,
+			code:     0,
+			limit:    0,
+			data:     b[n:end],
+		}); err != nil {
+			return n, err
+		}
+		s.flowLock.Lock()
+		s.sent += uint64(end - n)
+		s.flowLock.Unlock()
+		n = end
+	}
+	return n, nil
+}
+
+func (s *sendStream) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.conn.forgetSendStream(s.id)
+	return s.conn.writeFrame(&frame{
+		typ:      frameTypeFin,
+		streamID: s.id,
+		code:     0,
+		limit:    0,
+		data:     nil,
+	})
+}
+
+func (s *sendStream) CancelWrite(code uint64) {
+	// Unblock a write waiting for flow control credit, which holds s.lock.
+	s.flowLock.Lock()
+	if s.stopErr == nil {
+		s.stopErr = errWriteAfterClose
+	}
+	s.flowLock.Unlock()
+	s.signal()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	s.conn.forgetSendStream(s.id)
+	_ = s.conn.writeFrame(&frame{
+		typ:      frameTypeReset,
+		streamID: s.id,
+		code:     code,
+		limit:    0,
+		data:     nil,
+	})
+}
+
+// stream is a bidirectional stream.
+type stream struct {
+	*receiveStream
+	send *sendStream
+}
+
+var _ moqtransport.ResettableSendStream = (*stream)(nil)
+
+func (s *stream) Write(b []byte) (int, error) {
+	return s.send.Write(b)
+}
+
+func (s *stream) Close() error {
+	return s.send.Close()
+}
+
+func (s *stream) CancelWrite(code uint64) {
+	s.send.CancelWrite(code)
+}
@@ -0,0 +1,169 @@
+package moqtransport
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+)
+
+// A Tracer receives the events of a session, e.g. to write them to a qlog file
+// for debugging. Methods are called concurrently from internal goroutines of
+// the session and must not block.
+type Tracer interface {
+	ControlMessageSent(ControlMessageEvent)
+	ControlMessageParsed(ControlMessageEvent)
+	ObjectSent(ObjectEvent)
+	ObjectReceived(ObjectEvent)
+	StreamOpened(StreamEvent)
+	StreamClosed(StreamEvent)
+}
+
+// A ControlMessageEvent describes a control message. Type is the name of the
+// message type, e.g. "SUBSCRIBE". Fields holds the fields of the message by
+// their names in snake case, e.g. "subscribe_id".
+type ControlMessageEvent struct {
+	Type   string
+	Fields map[string]any
+}
+
+// An ObjectEvent describes an object sent or received on a subscription.
+// PayloadLength is -1 for received objects whose payload is read from its own
+// stream, because the payload was not read yet when the object was received.
+type ObjectEvent struct {
+	SubscribeID          uint64
+	TrackAlias           uint64
+	GroupID              uint64
+	ObjectID             uint64
+	PublisherPriority    uint8
+	ForwardingPreference ObjectForwardingPreference
+	Status               ObjectStatus
+	PayloadLength        int
+}
+
+// A StreamDirection tells whether a stream was opened locally or by the peer.
+type StreamDirection int
+
+const (
+	StreamDirectionSend StreamDirection = iota
+	StreamDirectionReceive
+)
+
+// A StreamEvent describes a unidirectional stream carrying objects of a
+// subscription. Type is the forwarding preference of the objects on the
+// stream. GroupID is only set for streams of a single object or group.
+type StreamEvent struct {
+	Direction   StreamDirection
+	Type        ObjectForwardingPreference
+	SubscribeID uint64
+	TrackAlias  uint64
+	GroupID     uint64
+}
+
+// nopTracer is the Tracer of sessions without a Tracer.
+type nopTracer struct{}
+
+func (nopTracer) ControlMessageSent(ControlMessageEvent)   {}
+func (nopTracer) ControlMessageParsed(ControlMessageEvent) {}
+func (nopTracer) ObjectSent(ObjectEvent)                   {}
+func (nopTracer) ObjectReceived(ObjectEvent)               {}
+func (nopTracer) StreamOpened(StreamEvent)                 {}
+func (nopTracer) StreamClosed(StreamEvent)                 {}
+
+func newControlMessageEvent(m wire.Message) ControlMessageEvent {
+	return ControlMessageEvent{
+		Type:   controlMessageName(m),
+		Fields: messageFields(m),
+	}
+}
+
+// messageFields returns the exported fields of the struct m points to by
+// their names in snake case.
+func messageFields(m wire.Message) map[string]any {
+	fields := map[string]any{}
+	v := reflect.Indirect(reflect.ValueOf(m))
+	if v.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fields[snakeCase(f.Name)] = fieldValue(v.Field(i).Interface())
+	}
+	return fields
+}
+
+// fieldValue converts durations to milliseconds and parameters to a list of
+// key and value pairs ordered by key.
+func fieldValue(v any) any {
+	switch x := v.(type) {
+	case time.Duration:
+		return x.Milliseconds()
+	case wire.Parameters:
+		keys := make([]uint64, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		params := make([]map[string]any, 0, len(x))
+		for _, k := range keys {
+			param := map[string]any{"key": k}
+			if value := reflect.Indirect(reflect.ValueOf(x[k])).FieldByName("Value"); value.IsValid() {
+				param["value"] = value.Interface()
+			}
+			params = append(params, param)
+		}
+		return params
+	}
+	return v
+}
+
+// snakeCase converts a Go identifier like SubscribeID to subscribe_id.
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// Start a new word at an upper case letter which follows a lower
+			// case letter or which starts a word after an acronym.
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func newObjectEvent(subscribeID, trackAlias uint64, o Object, payloadLength int) ObjectEvent {
+	return ObjectEvent{
+		SubscribeID:          subscribeID,
+		TrackAlias:           trackAlias,
+		GroupID:              o.GroupID,
+		ObjectID:             o.ObjectID,
+		PublisherPriority:    o.PublisherPriority,
+		ForwardingPreference: o.ForwardingPreference,
+		Status:               o.Status,
+		PayloadLength:        payloadLength,
+	}
+}
+
+func newStreamEvent(direction StreamDirection, subscribeID, trackAlias uint64, o Object) StreamEvent {
+	e := StreamEvent{
+		Direction:   direction,
+		Type:        o.ForwardingPreference,
+		SubscribeID: subscribeID,
+		TrackAlias:  trackAlias,
+		GroupID:     0,
+	}
+	if o.ForwardingPreference != ObjectForwardingPreferenceStreamTrack {
+		e.GroupID = o.GroupID
+	}
+	return e
+}
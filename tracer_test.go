@@ -0,0 +1,91 @@
+package moqtransport
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewControlMessageEvent(t *testing.T) {
+	cases := []struct {
+		msg    wire.Message
+		expect ControlMessageEvent
+	}{
+		{
+			msg: &wire.SubscribeOkMessage{
+				SubscribeID:   1,
+				Expires:       2 * time.Second,
+				GroupOrder:    1,
+				ContentExists: true,
+				FinalGroup:    3,
+				FinalObject:   4,
+			},
+			expect: ControlMessageEvent{
+				Type: "SUBSCRIBE_OK",
+				Fields: map[string]any{
+					"subscribe_id":   uint64(1),
+					"expires":        int64(2000),
+					"group_order":    uint8(1),
+					"content_exists": true,
+					"final_group":    uint64(3),
+					"final_object":   uint64(4),
+				},
+			},
+		},
+		{
+			msg: &wire.AnnounceMessage{
+				TrackNamespace: "namespace",
+				Parameters: wire.Parameters{
+					wire.AuthorizationParameterKey: &wire.StringParameter{
+						Type:  wire.AuthorizationParameterKey,
+						Value: "auth",
+					},
+				},
+			},
+			expect: ControlMessageEvent{
+				Type: "ANNOUNCE",
+				Fields: map[string]any{
+					"track_namespace": "namespace",
+					"parameters": []map[string]any{{
+						"key":   wire.AuthorizationParameterKey,
+						"value": "auth",
+					}},
+				},
+			},
+		},
+	}
+	for i, tc := range cases {
+		t.Run(fmt.Sprintf("%v", i), func(t *testing.T) {
+			assert.Equal(t, tc.expect, newControlMessageEvent(tc.msg))
+		})
+	}
+}
+
+type controlMessageRecorder struct {
+	nopTracer
+	sent []ControlMessageEvent
+}
+
+func (r *controlMessageRecorder) ControlMessageSent(e ControlMessageEvent) {
+	r.sent = append(r.sent, e)
+}
+
+func TestSessionTracing(t *testing.T) {
+	s := session(nil, nil, nil)
+	s.initTracer()
+	assert.False(t, s.tracing())
+
+	r := &controlMessageRecorder{}
+	s = session(nil, nil, nil)
+	s.Tracer = r
+	s.initTracer()
+	assert.True(t, s.tracing())
+	s.controlMessageSent(&wire.GoAwayMessage{NewSessionURI: "uri"})
+	assert.Equal(t, []ControlMessageEvent{{
+		Type:   "GOAWAY",
+		Fields: map[string]any{"new_session_uri": "uri"},
+	}}, r.sent)
+}
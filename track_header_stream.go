@@ -6,14 +6,14 @@ type trackHeaderStream struct {
 	stream SendStream
 }
 
-func newTrackHeaderStream(stream SendStream, subscribeID, trackAlias uint64, publisherPriority uint8) (*trackHeaderStream, error) {
+func newTrackHeaderStream(stream SendStream, version wire.Version, subscribeID, trackAlias uint64, publisherPriority uint8) (*trackHeaderStream, error) {
 	shtm := &wire.StreamHeaderTrackMessage{
 		SubscribeID:       subscribeID,
 		TrackAlias:        trackAlias,
 		PublisherPriority: publisherPriority,
 	}
 	buf := make([]byte, 0, 32)
-	buf = shtm.Append(buf)
+	buf = shtm.AppendVersion(buf, version)
 	_, err := stream.Write(buf)
 	if err != nil {
 		return nil, err
@@ -34,6 +34,19 @@ func (s *trackHeaderStream) writeObject(groupID, objectID uint64, payload []byte
 	return s.stream.Write(buf)
 }
 
+// writeStatus writes an object without payload carrying status.
+func (s *trackHeaderStream) writeStatus(groupID, objectID uint64, status wire.ObjectStatus) (int, error) {
+	shto := wire.StreamHeaderTrackObject{
+		GroupID:       groupID,
+		ObjectID:      objectID,
+		ObjectStatus:  status,
+		ObjectPayload: nil,
+	}
+	buf := make([]byte, 0, 32)
+	buf = shto.Append(buf)
+	return s.stream.Write(buf)
+}
+
 func (s *trackHeaderStream) Close() error {
 	return s.stream.Close()
 }
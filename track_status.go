@@ -0,0 +1,99 @@
+package moqtransport
+
+import (
+	"sync"
+
+	"github.com/mengelbart/moqtransport/internal/wire"
+)
+
+const (
+	TrackStatusInProgress   = 0x00
+	TrackStatusDoesNotExist = 0x01
+	TrackStatusNotYetBegun  = 0x02
+	TrackStatusFinished     = 0x03
+	TrackStatusRelay        = 0x04
+)
+
+// TrackStatus is the status of a track as carried in TRACK_STATUS messages.
+// LatestGroupID and LatestObjectID are only meaningful if StatusCode is
+// TrackStatusInProgress, TrackStatusFinished or TrackStatusRelay.
+type TrackStatus struct {
+	StatusCode     uint64
+	LatestGroupID  uint64
+	LatestObjectID uint64
+}
+
+type TrackStatusRequest struct {
+	Namespace string
+	TrackName string
+}
+
+type TrackStatusResponseWriter interface {
+	// Accept responds with the current status of t.
+	Accept(t *LocalTrack)
+	// Reply responds with the given status.
+	Reply(TrackStatus)
+}
+
+type TrackStatusHandler interface {
+	HandleTrackStatus(*Session, *TrackStatusRequest, TrackStatusResponseWriter)
+}
+
+type TrackStatusHandlerFunc func(*Session, *TrackStatusRequest, TrackStatusResponseWriter)
+
+func (f TrackStatusHandlerFunc) HandleTrackStatus(s *Session, r *TrackStatusRequest, w TrackStatusResponseWriter) {
+	f(s, r, w)
+}
+
+type defaultTrackStatusResponseWriter struct {
+	request *TrackStatusRequest
+	session *Session
+}
+
+func (w *defaultTrackStatusResponseWriter) Accept(t *LocalTrack) {
+	w.session.replyTrackStatus(w.request, t.Status())
+}
+
+func (w *defaultTrackStatusResponseWriter) Reply(status TrackStatus) {
+	w.session.replyTrackStatus(w.request, status)
+}
+
+// trackStatusRequests matches TRACK_STATUS messages to pending requests. The
+// messages do not carry a request ID, so concurrent requests for the same
+// track are queued and receive the responses in the order they were sent.
+type trackStatusRequests struct {
+	lock     sync.Mutex
+	requests map[trackKey][]chan *wire.TrackStatusMessage
+}
+
+func newTrackStatusRequests() *trackStatusRequests {
+	return &trackStatusRequests{
+		lock:     sync.Mutex{},
+		requests: map[trackKey][]chan *wire.TrackStatusMessage{},
+	}
+}
+
+// add queues a request for key. responseCh must be buffered, because requests
+// that were abandoned by the caller remain queued until their response
+// arrives, which keeps the order of the remaining requests intact.
+func (r *trackStatusRequests) add(key trackKey, responseCh chan *wire.TrackStatusMessage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests[key] = append(r.requests[key], responseCh)
+}
+
+// next removes and returns the oldest request for key.
+func (r *trackStatusRequests) next(key trackKey) (chan *wire.TrackStatusMessage, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	queue := r.requests[key]
+	if len(queue) == 0 {
+		return nil, false
+	}
+	if len(queue) == 1 {
+		delete(r.requests, key)
+	} else {
+		r.requests[key] = queue[1:]
+	}
+	return queue[0], true
+}
@@ -0,0 +1,15 @@
+package moqtransport
+
+import "github.com/mengelbart/moqtransport/internal/wire"
+
+type Version = wire.Version
+
+const (
+	VersionDraft04 Version = wire.Draft_ietf_moq_transport_04
+	VersionDraft05 Version = wire.Draft_ietf_moq_transport_05
+)
+
+// DefaultSupportedVersions are the versions a Session offers if its
+// SupportedVersions are not set. They are all versions this package
+// implements.
+var DefaultSupportedVersions = []Version{VersionDraft05, VersionDraft04}
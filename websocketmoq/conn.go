@@ -0,0 +1,59 @@
+// Package websocketmoq implements moqtransport.Connection on top of a WebSocket
+// connection for browsers that do not support WebTransport. Streams and
+// datagrams are multiplexed using the framing of package tcpmoq, every frame
+// is sent in its own binary WebSocket message. Datagrams are dropped instead
+// of queued when the connection is congested.
+package websocketmoq
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/tcpmoq"
+	"golang.org/x/net/websocket"
+)
+
+// Protocol is the WebSocket subprotocol offered by clients and selected by
+// servers.
+const Protocol = "moq-00-ws"
+
+// New returns a moqtransport.Connection multiplexing streams and datagrams on
+// ws. Closing the returned connection closes ws.
+func New(ws *websocket.Conn) moqtransport.Connection {
+	ws.PayloadType = websocket.BinaryFrame
+	return tcpmoq.New(ws, ws.IsClientConn())
+}
+
+// Dial opens a WebSocket connection to url, which uses the ws or wss scheme,
+// and returns a client connection. tlsConfig is used for wss URLs and may be
+// nil to use the default configuration.
+func Dial(ctx context.Context, url string, tlsConfig *tls.Config) (moqtransport.Connection, error) {
+	config, err := websocket.NewConfig(url, url)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{Protocol}
+	config.TlsConfig = tlsConfig
+	ws, err := config.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return New(ws), nil
+}
+
+// closeNotifyConn signals when the WebSocket connection is closed.
+type closeNotifyConn struct {
+	*websocket.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *closeNotifyConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return err
+}
@@ -0,0 +1,99 @@
+package websocketmoq
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mengelbart/moqtransport"
+	"github.com/mengelbart/moqtransport/tcpmoq"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	errOriginNotAllowed   = errors.New("websocketmoq: request origin not allowed")
+	errProtocolNotOffered = errors.New("websocketmoq: client did not offer the MoQ subprotocol")
+	errHandshakeFailed    = errors.New("websocketmoq: websocket handshake failed")
+	errHijackNotSupported = errors.New("websocketmoq: response writer does not support hijacking")
+)
+
+// An Upgrader upgrades HTTP requests to WebSocket connections carrying MoQ.
+// The zero value is ready to use.
+type Upgrader struct {
+	// CheckOrigin returns true if the Origin header of the request is
+	// acceptable. If nil, requests are accepted if they do not have an
+	// Origin header or if its host matches the Host header of the request.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Upgrade performs the WebSocket handshake and returns the server side of the
+// connection. It must be called from an http.Handler, the connection stays
+// open after the handler returns until it is closed. If the upgrade fails,
+// the error response was already written.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request) (moqtransport.Connection, error) {
+	if _, ok := w.(http.Hijacker); !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errHijackNotSupported
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	var handshakeErr error
+	connCh := make(chan moqtransport.Connection, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		websocket.Server{
+			Config: websocket.Config{},
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				if !checkOrigin(r) {
+					handshakeErr = errOriginNotAllowed
+					return handshakeErr
+				}
+				if !slices.Contains(config.Protocol, Protocol) {
+					handshakeErr = errProtocolNotOffered
+					return handshakeErr
+				}
+				config.Protocol = []string{Protocol}
+				return nil
+			},
+			// The server closes the WebSocket connection when the handler
+			// returns, so the handler waits until the connection is closed.
+			Handler: func(ws *websocket.Conn) {
+				ws.PayloadType = websocket.BinaryFrame
+				c := &closeNotifyConn{
+					Conn:      ws,
+					closeOnce: sync.Once{},
+					closed:    make(chan struct{}),
+				}
+				connCh <- tcpmoq.New(c, false)
+				<-c.closed
+			},
+		}.ServeHTTP(w, r)
+	}()
+	select {
+	case conn := <-connCh:
+		return conn, nil
+	case <-done:
+		if handshakeErr != nil {
+			return nil, handshakeErr
+		}
+		return nil, errHandshakeFailed
+	}
+}
+
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
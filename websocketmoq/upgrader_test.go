@@ -0,0 +1,120 @@
+package websocketmoq
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/moqtransport/tcpmoq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"golang.org/x/net/websocket"
+)
+
+func TestUpgrader(t *testing.T) {
+	cases := []struct {
+		name        string
+		checkOrigin func(r *http.Request) bool
+		origin      string
+		protocols   []string
+		expectErr   error
+	}{
+		{
+			name:        "same_origin",
+			checkOrigin: nil,
+			origin:      "",
+			protocols:   []string{Protocol},
+			expectErr:   nil,
+		},
+		{
+			name:        "cross_origin",
+			checkOrigin: nil,
+			origin:      "http://example.com",
+			protocols:   []string{Protocol},
+			expectErr:   errOriginNotAllowed,
+		},
+		{
+			name: "custom_origin_check",
+			checkOrigin: func(r *http.Request) bool {
+				return r.Header.Get("Origin") == "http://example.com"
+			},
+			origin:    "http://example.com",
+			protocols: []string{Protocol},
+			expectErr: nil,
+		},
+		{
+			name:        "missing_protocol",
+			checkOrigin: nil,
+			origin:      "",
+			protocols:   nil,
+			expectErr:   errProtocolNotOffered,
+		},
+		{
+			name:        "select_protocol",
+			checkOrigin: nil,
+			origin:      "",
+			protocols:   []string{"chat", Protocol},
+			expectErr:   nil,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			defer goleak.VerifyNone(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			upgrader := &Upgrader{
+				CheckOrigin: tc.checkOrigin,
+			}
+			errCh := make(chan error, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := upgrader.Upgrade(w, r)
+				errCh <- err
+				if err != nil {
+					return
+				}
+				go func() {
+					s, err := conn.AcceptUniStream(ctx)
+					if !assert.NoError(t, err) {
+						return
+					}
+					buf, err := io.ReadAll(s)
+					assert.NoError(t, err)
+					assert.Equal(t, "hello", string(buf))
+					assert.NoError(t, conn.CloseWithError(0, "done"))
+				}()
+			}))
+			defer server.Close()
+
+			url := "ws" + strings.TrimPrefix(server.URL, "http")
+			origin := tc.origin
+			if origin == "" {
+				origin = server.URL
+			}
+			config, err := websocket.NewConfig(url, origin)
+			assert.NoError(t, err)
+			config.Protocol = tc.protocols
+			ws, err := config.DialContext(ctx)
+			assert.ErrorIs(t, <-errCh, tc.expectErr)
+			if tc.expectErr != nil {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			conn := New(ws)
+			s, err := conn.OpenUniStream()
+			assert.NoError(t, err)
+			_, err = s.Write([]byte("hello"))
+			assert.NoError(t, err)
+			assert.NoError(t, s.Close())
+			_, err = conn.AcceptUniStream(ctx)
+			var appErr *tcpmoq.ApplicationError
+			assert.ErrorAs(t, err, &appErr)
+			assert.True(t, appErr.Remote)
+			assert.Equal(t, "done", appErr.Message)
+		})
+	}
+}
@@ -7,6 +7,38 @@ import (
 	"github.com/quic-go/webtransport-go"
 )
 
+// receiveStream wraps a webtransport.ReceiveStream to implement
+// moqtransport.CancelableReceiveStream.
+type receiveStream struct {
+	stream webtransport.ReceiveStream
+}
+
+func (s *receiveStream) Read(b []byte) (int, error) {
+	return s.stream.Read(b)
+}
+
+func (s *receiveStream) CancelRead(code uint64) {
+	s.stream.CancelRead(webtransport.StreamErrorCode(code))
+}
+
+// sendStream wraps a webtransport.SendStream to implement
+// moqtransport.ResettableSendStream.
+type sendStream struct {
+	stream webtransport.SendStream
+}
+
+func (s *sendStream) Write(b []byte) (int, error) {
+	return s.stream.Write(b)
+}
+
+func (s *sendStream) Close() error {
+	return s.stream.Close()
+}
+
+func (s *sendStream) CancelWrite(code uint64) {
+	s.stream.CancelWrite(webtransport.StreamErrorCode(code))
+}
+
 type webTransportConn struct {
 	session *webtransport.Session
 }
@@ -24,11 +56,19 @@ func (c *webTransportConn) OpenStreamSync(ctx context.Context) (moqtransport.Str
 }
 
 func (c *webTransportConn) OpenUniStream() (moqtransport.SendStream, error) {
-	return c.session.OpenUniStream()
+	s, err := c.session.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	return &sendStream{s}, nil
 }
 
 func (c *webTransportConn) OpenUniStreamSync(ctx context.Context) (moqtransport.SendStream, error) {
-	return c.session.OpenUniStreamSync(ctx)
+	s, err := c.session.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sendStream{s}, nil
 }
 
 func (c *webTransportConn) AcceptStream(ctx context.Context) (moqtransport.Stream, error) {
@@ -36,7 +76,11 @@ func (c *webTransportConn) AcceptStream(ctx context.Context) (moqtransport.Strea
 }
 
 func (c *webTransportConn) AcceptUniStream(ctx context.Context) (moqtransport.ReceiveStream, error) {
-	return c.session.AcceptUniStream(ctx)
+	s, err := c.session.AcceptUniStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &receiveStream{s}, nil
 }
 
 func (c *webTransportConn) SendDatagram(b []byte) error {